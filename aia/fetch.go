@@ -0,0 +1,210 @@
+// Package aia downloads the issuers of certificates in the trust
+// database that are missing from it, following the CA Issuers URLs
+// recorded in the aia table.
+package aia
+
+import (
+	"bytes"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// maxResponseSize bounds the responses read from CA Issuers URLs,
+// which should hold a handful of certificates at most.
+const maxResponseSize = 1 << 20
+
+// A MissingIssuer is an issuer that isn't in the database. SKI is the
+// AKI of the certificates it issued, and URL is the CA Issuers URL
+// recorded for it, if any. Fetched lists the certificates downloaded
+// from the URL that issued at least one of them; Error records why
+// none could be fetched.
+type MissingIssuer struct {
+	SKI          string                `json:"ski" yaml:"ski"`
+	URL          string                `json:"url" yaml:"url"`
+	Certificates []*diff.Certificate   `json:"certificates" yaml:"certificates"`
+	Fetched      []*diff.Certificate   `json:"fetched" yaml:"fetched"`
+	Error        string                `json:"error,omitempty" yaml:"error,omitempty"`
+	children     []*certdb.Certificate // the certificates it issued
+}
+
+// A Report lists the missing issuers and the certificates fetched for
+// them. Staged holds every fetched certificate, ready to be imported.
+type Report struct {
+	Missing int                 `json:"missing" yaml:"missing"`
+	Fetched int                 `json:"fetched" yaml:"fetched"`
+	Issuers []*MissingIssuer    `json:"issuers" yaml:"issuers"`
+	Staged  []*x509.Certificate `json:"-" yaml:"-"`
+}
+
+// ParseCertificates parses a CA Issuers response, which may hold a
+// DER certificate, PEM certificates, or a PKCS #7 bundle in either
+// encoding.
+func ParseCertificates(in []byte) ([]*x509.Certificate, error) {
+	if bytes.Contains(in, []byte("-----BEGIN")) {
+		return helpers.ParseCertificatesPEM(in)
+	}
+
+	certs, _, err := helpers.ParseCertificatesDER(in, "")
+	return certs, err
+}
+
+// Fetch downloads the certificates at a CA Issuers URL. Only HTTP
+// URLs are supported.
+func Fetch(client *http.Client, rawURL string) ([]*x509.Certificate, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("aia: unsupported URL scheme " + u.Scheme)
+	}
+
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aia: %s returned %s", rawURL, resp.Status)
+	}
+
+	in, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCertificates(in)
+}
+
+// Missing finds the certificates whose issuer isn't in the database,
+// grouped by issuer. Self-signed certificates, certificates without an
+// AKI, and certificates expired at the given time are skipped.
+func Missing(tx *sql.Tx, when int64) ([]*MissingIssuer, error) {
+	certs, err := certdb.AllCertificates(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, cert := range certs {
+		known[cert.SKI] = true
+	}
+
+	issuers := map[string]*MissingIssuer{}
+	for _, cert := range certs {
+		if cert.AKI == "" || cert.AKI == cert.SKI || known[cert.AKI] || cert.NotAfter <= when {
+			continue
+		}
+
+		issuer, ok := issuers[cert.AKI]
+		if !ok {
+			issuer = &MissingIssuer{
+				SKI:          cert.AKI,
+				Certificates: []*diff.Certificate{},
+				Fetched:      []*diff.Certificate{},
+			}
+
+			aia := &certdb.AIA{SKI: cert.AKI}
+			err = aia.Select(tx)
+			if err == nil {
+				issuer.URL = aia.URL
+			} else if err != sql.ErrNoRows {
+				return nil, err
+			}
+			issuers[cert.AKI] = issuer
+		}
+
+		issuer.Certificates = append(issuer.Certificates, diff.NewCertificate(cert))
+		issuer.children = append(issuer.children, cert)
+	}
+
+	var missing []*MissingIssuer
+	for _, issuer := range issuers {
+		missing = append(missing, issuer)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].SKI < missing[j].SKI
+	})
+	return missing, nil
+}
+
+// issued returns true if the CA certificate issued one of the
+// certificates.
+func issued(issuer *x509.Certificate, certs []*certdb.Certificate) bool {
+	if !issuer.BasicConstraintsValid || !issuer.IsCA {
+		return false
+	}
+
+	for _, cert := range certs {
+		if chain.SignedBy(cert.X509(), issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchMissing downloads the missing issuers from their CA Issuers
+// URLs. Only CA certificates whose signature on at least one of the
+// certificates they issued verifies are staged; the database isn't
+// changed.
+func FetchMissing(tx *sql.Tx, client *http.Client, when int64) (*Report, error) {
+	missing, err := Missing(tx, when)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Missing: len(missing),
+		Issuers: []*MissingIssuer{},
+	}
+
+	staged := map[string]bool{}
+	for _, issuer := range missing {
+		report.Issuers = append(report.Issuers, issuer)
+		if issuer.URL == "" {
+			issuer.Error = "no CA Issuers URL recorded"
+			continue
+		}
+
+		certs, err := Fetch(client, issuer.URL)
+		if err != nil {
+			issuer.Error = err.Error()
+			continue
+		}
+
+		for _, cert := range certs {
+			if !issued(cert, issuer.children) {
+				continue
+			}
+
+			issuer.Fetched = append(issuer.Fetched, diff.NewCertificate(certdb.NewCertificate(cert)))
+			if !staged[string(cert.Raw)] {
+				staged[string(cert.Raw)] = true
+				report.Staged = append(report.Staged, cert)
+			}
+		}
+
+		if len(issuer.Fetched) == 0 {
+			issuer.Error = "no certificate at the URL issued the certificates"
+			continue
+		}
+		report.Fetched++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,161 @@
+package aia
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+	"github.com/cloudflare/cfssl_trust/publish"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func withAIA(url string) certdbtest.Option {
+	return func(template *x509.Certificate) {
+		template.IssuingCertificateURL = []string{url}
+	}
+}
+
+// TestFetchMissing issues an intermediate from each of four roots
+// that aren't in the database: der, pem and pkcs7 are served in those
+// encodings, while forged serves a certificate with the right name
+// but the wrong key. A fifth intermediate has no AIA, and a sixth
+// points at a URL that doesn't exist.
+func TestFetchMissing(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	roots := map[string]*certdbtest.Identity{}
+	for _, cn := range []string{"der", "pem", "pkcs7", "forged", "none", "gone"} {
+		roots[cn], err = certdbtest.NewRoot(cn, date(2017, 1, 1), date(2030, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	impostor, err := certdbtest.NewRoot("forged", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs7, err := publish.EncodePKCS7([]*certdb.Certificate{certdb.NewCertificate(roots["pkcs7"].Cert)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string][]byte{
+		"/der":    roots["der"].Cert.Raw,
+		"/pem":    helpers.EncodeCertificatePEM(roots["pem"].Cert),
+		"/pkcs7":  pkcs7,
+		"/forged": impostor.Cert.Raw,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	var ints []*x509.Certificate
+	for cn, root := range roots {
+		var opts []certdbtest.Option
+		if cn != "none" {
+			opts = append(opts, withAIA(srv.URL+"/"+cn))
+		}
+
+		id, err := root.Issue(cn+" intermediate", date(2017, 1, 1), date(2030, 1, 1), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ints = append(ints, id.Cert)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), ints...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	report, err := FetchMissing(tx, srv.Client(), date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Missing != 6 || report.Fetched != 3 {
+		t.Fatalf("expected 3 of 6 missing issuers to be fetched, but have %d of %d",
+			report.Fetched, report.Missing)
+	}
+
+	staged := map[string]bool{}
+	for _, cert := range report.Staged {
+		staged[cert.Subject.CommonName] = true
+		if cert.Subject.CommonName == "forged" {
+			t.Fatal("the forged issuer shouldn't have been staged")
+		}
+	}
+
+	for _, cn := range []string{"der", "pem", "pkcs7"} {
+		if !staged[cn] {
+			t.Fatalf("expected %s to be staged", cn)
+		}
+	}
+
+	for _, issuer := range report.Issuers {
+		if len(issuer.Fetched) == 0 && issuer.Error == "" {
+			t.Fatalf("expected an error for issuer %s (%s)", issuer.SKI, issuer.URL)
+		}
+	}
+
+	// Once the issuers are imported, nothing is missing for them.
+	for _, cert := range report.Staged {
+		_, _, err = certdb.Import(tx, cert, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing, err := Missing(tx, date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missing) != 3 {
+		t.Fatalf("expected 3 issuers to still be missing, but have %d", len(missing))
+	}
+
+	// Expired certificates don't need their issuers.
+	missing, err = Missing(tx, date(2031, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("expected no issuers to be missing for expired certificates, but have %d", len(missing))
+	}
+}
+
+func TestFetchUnsupportedScheme(t *testing.T) {
+	_, err := Fetch(http.DefaultClient, "ldap://ldap.example.com/cn=CA")
+	if err == nil {
+		t.Fatal("expected LDAP URLs to be rejected")
+	}
+}
@@ -0,0 +1,308 @@
+// Package ccadb reconciles the trust database with the Common CA
+// Database's CSV reports of disclosed roots and intermediates.
+package ccadb
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/revocation"
+)
+
+// MechanismCCADB is the mechanism recorded for revocations found in
+// CCADB reports.
+const MechanismCCADB = "ccadb"
+
+// These are the revocation statuses CCADB reports.
+const (
+	StatusNotRevoked    = "Not Revoked"
+	StatusRevoked       = "Revoked"
+	StatusParentRevoked = "Parent Cert Revoked"
+)
+
+// These are the columns read from a CCADB report. Only the fingerprint
+// and revocation status are required.
+const (
+	columnFingerprint = "sha-256 fingerprint"
+	columnStatus      = "revocation status"
+	columnName        = "certificate name"
+	columnOwner       = "ca owner"
+	columnType        = "certificate record type"
+	columnRevokedAt   = "date of revocation"
+	columnReason      = "rfc 5280 revocation reason code"
+	columnConstrained = "technically constrained"
+	columnValidTo     = "valid to (gmt)"
+)
+
+// recordIntermediate is the record type of intermediates.
+const recordIntermediate = "Intermediate Certificate"
+
+// dateLayouts are the date formats found in CCADB reports.
+var dateLayouts = []string{"2006.01.02", "2006-01-02"}
+
+// A Record is a row of a CCADB report. Fingerprint is the lower-case
+// hex SHA-256 fingerprint of the certificate; RevokedAt and ValidTo
+// are nil if the report doesn't give them.
+type Record struct {
+	Name                   string     `json:"name" yaml:"name"`
+	Owner                  string     `json:"owner" yaml:"owner"`
+	Type                   string     `json:"type" yaml:"type"`
+	Fingerprint            string     `json:"fingerprint" yaml:"fingerprint"`
+	RevocationStatus       string     `json:"revocation_status" yaml:"revocation_status"`
+	RevokedAt              *time.Time `json:"revoked_at,omitempty" yaml:"revoked_at,omitempty"`
+	Reason                 string     `json:"reason,omitempty" yaml:"reason,omitempty"`
+	TechnicallyConstrained bool       `json:"technically_constrained" yaml:"technically_constrained"`
+	ValidTo                *time.Time `json:"valid_to,omitempty" yaml:"valid_to,omitempty"`
+}
+
+// Intermediate returns true if the record is for an intermediate.
+func (rec *Record) Intermediate() bool {
+	return strings.EqualFold(rec.Type, recordIntermediate)
+}
+
+// Revoked returns true if CCADB marks the certificate or its parent
+// revoked.
+func (rec *Record) Revoked() bool {
+	return strings.EqualFold(rec.RevocationStatus, StatusRevoked) ||
+		strings.EqualFold(rec.RevocationStatus, StatusParentRevoked)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate as it
+// is matched against CCADB records.
+func Fingerprint(cert *certdb.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// normaliseFingerprint lower-cases a fingerprint and strips any
+// separators.
+func normaliseFingerprint(in string) string {
+	in = strings.Replace(in, ":", "", -1)
+	in = strings.Replace(in, " ", "", -1)
+	return strings.ToLower(in)
+}
+
+func parseDate(in string) (*time.Time, error) {
+	if in == "" {
+		return nil, nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, in); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("ccadb: invalid date %s", in)
+}
+
+// ParseCSV reads a CCADB CSV report, such as the all certificate
+// records report. Columns are found by their header, so their order
+// doesn't matter.
+func ParseCSV(r io.Reader) ([]*Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Exports often start with a byte order mark.
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{columnFingerprint, columnStatus} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("ccadb: the report has no '%s' column", required)
+		}
+	}
+
+	var records []*Record
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		field := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		rec := &Record{
+			Name:                   field(columnName),
+			Owner:                  field(columnOwner),
+			Type:                   field(columnType),
+			Fingerprint:            normaliseFingerprint(field(columnFingerprint)),
+			RevocationStatus:       field(columnStatus),
+			Reason:                 field(columnReason),
+			TechnicallyConstrained: strings.EqualFold(field(columnConstrained), "true"),
+		}
+		if rec.Fingerprint == "" {
+			continue
+		}
+
+		rec.RevokedAt, err = parseDate(field(columnRevokedAt))
+		if err == nil {
+			rec.ValidTo, err = parseDate(field(columnValidTo))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// A Match is a certificate in an int release that CCADB marks
+// revoked. Recorded is set if the revocation was added to the
+// database; Skipped explains why it wasn't.
+type Match struct {
+	Record      *Record           `json:"record" yaml:"record"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+	Recorded    bool              `json:"recorded" yaml:"recorded"`
+	Skipped     string            `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// A Report reconciles an int release with a CCADB report. Revoked
+// lists the intermediates in the release that CCADB marks revoked or
+// parent-revoked; Missing lists the unrevoked, unexpired intermediates
+// disclosed to CCADB that aren't in the database at all.
+type Report struct {
+	Release *certdb.Release `json:"release" yaml:"release"`
+	Records int             `json:"records" yaml:"records"`
+	Matched int             `json:"matched" yaml:"matched"`
+	Revoked []*Match        `json:"revoked" yaml:"revoked"`
+	Missing []*Record       `json:"missing" yaml:"missing"`
+}
+
+// Reconcile matches the CCADB records to the certificates in the
+// database by SHA-256 fingerprint. If record is set, revocations are
+// recorded for the intermediates in the release that CCADB marks
+// revoked, effective from CCADB's revocation date or, if it has none,
+// the given time; certificates that are already revoked, or that share
+// their key with another certificate (as cross-signs do), are left
+// alone.
+func Reconcile(tx *sql.Tx, records []*Record, rel *certdb.Release, when time.Time, record bool) (*Report, error) {
+	report := &Report{
+		Release: rel,
+		Records: len(records),
+		Revoked: []*Match{},
+		Missing: []*Record{},
+	}
+
+	byFingerprint := map[string]*Record{}
+	for _, rec := range records {
+		byFingerprint[rec.Fingerprint] = rec
+	}
+
+	all, err := certdb.AllCertificates(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, cert := range all {
+		known[Fingerprint(cert)] = true
+	}
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cert := range certs {
+		rec, ok := byFingerprint[Fingerprint(cert)]
+		if !ok {
+			continue
+		}
+
+		report.Matched++
+		if !rec.Revoked() {
+			continue
+		}
+
+		match := &Match{
+			Record:      rec,
+			Certificate: diff.NewCertificate(cert),
+		}
+		report.Revoked = append(report.Revoked, match)
+		if !record {
+			continue
+		}
+
+		rev := &certdb.Revocation{SKI: cert.SKI}
+		err = rev.Select(tx)
+		if err == nil {
+			match.Skipped = fmt.Sprintf("already revoked (%s) as of %s", rev.Mechanism,
+				time.Unix(rev.RevokedAt, 0).UTC().Format(common.DateFormat))
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		shared, err := cert.SharesKey(tx)
+		if err != nil {
+			return nil, err
+		} else if shared {
+			match.Skipped = revocation.SkippedSharedKey
+			continue
+		}
+
+		revokedAt := when
+		if rec.RevokedAt != nil {
+			revokedAt = *rec.RevokedAt
+		}
+
+		reason := rec.Reason
+		if reason == "" {
+			reason = rec.RevocationStatus
+		}
+
+		err = cert.Revoke(tx, MechanismCCADB, reason, revokedAt.Unix())
+		if err != nil {
+			return nil, err
+		}
+		match.Recorded = true
+	}
+
+	for _, rec := range records {
+		if !rec.Intermediate() || rec.Revoked() || known[rec.Fingerprint] {
+			continue
+		}
+
+		if rec.ValidTo != nil && rec.ValidTo.Before(when) {
+			continue
+		}
+		report.Missing = append(report.Missing, rec)
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool {
+		if report.Missing[i].Owner != report.Missing[j].Owner {
+			return report.Missing[i].Owner < report.Missing[j].Owner
+		}
+		return report.Missing[i].Name < report.Missing[j].Name
+	})
+
+	return report, nil
+}
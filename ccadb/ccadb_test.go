@@ -0,0 +1,203 @@
+package ccadb
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+	"github.com/cloudflare/cfssl_trust/revocation"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	return strings.ToUpper(Fingerprint(certdb.NewCertificate(cert)))
+}
+
+const header = "\ufeffCA Owner,Certificate Name,Certificate Record Type,Revocation Status,SHA-256 Fingerprint,Date of Revocation,RFC 5280 Revocation Reason Code,Technically Constrained,Valid To (GMT)\n"
+
+func TestReconcile(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ints := map[string]*certdbtest.Identity{}
+	for _, name := range []string{"revoked", "orphaned", "fine", "undisclosed", "missing", "expired"} {
+		ints[name], err = root.Issue(name, date(2017, 1, 1), date(2030, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1),
+		ints["revoked"].Cert, ints["orphaned"].Cert, ints["fine"].Cert, ints["undisclosed"].Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fine intermediate's fingerprint is colon-separated, as
+	// some tools export them.
+	colons := fingerprint(ints["fine"].Cert)
+	var pairs []string
+	for i := 0; i < len(colons); i += 2 {
+		pairs = append(pairs, colons[i:i+2])
+	}
+
+	report := header +
+		fmt.Sprintf("Test,root,Root Certificate,Not Revoked,%s,,,,2035.01.01\n", fingerprint(root.Cert)) +
+		fmt.Sprintf("Test,revoked,Intermediate Certificate,Revoked,%s,2019.06.01,(1) keyCompromise,false,2030.01.01\n", fingerprint(ints["revoked"].Cert)) +
+		fmt.Sprintf("Test,orphaned,Intermediate Certificate,Parent Cert Revoked,%s,,,false,2030.01.01\n", fingerprint(ints["orphaned"].Cert)) +
+		fmt.Sprintf("Test,fine,Intermediate Certificate,Not Revoked,%s,,,true,2030.01.01\n", strings.Join(pairs, ":")) +
+		fmt.Sprintf("Test,missing,Intermediate Certificate,Not Revoked,%s,,,false,2030.01.01\n", fingerprint(ints["missing"].Cert)) +
+		fmt.Sprintf("Test,expired,Intermediate Certificate,Not Revoked,%s,,,false,2019.01.01\n", fingerprint(ints["expired"].Cert))
+
+	records, err := ParseCSV(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(records) != 6 {
+		t.Fatalf("expected 6 records, but have %d", len(records))
+	}
+
+	if !records[3].TechnicallyConstrained || records[1].RevokedAt == nil || !records[1].RevokedAt.Equal(date(2019, 6, 1)) {
+		t.Fatalf("records weren't parsed correctly: %+v, %+v", records[1], records[3])
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	when := date(2020, 1, 15)
+	result, err := Reconcile(tx, records, intRel, when, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Matched != 3 || len(result.Revoked) != 2 || len(result.Missing) != 1 || result.Missing[0].Name != "missing" {
+		t.Fatalf("expected 3 matches, 2 revoked and 1 missing, but have %+v", result)
+	}
+
+	isRevoked, err := certdb.NewCertificate(ints["revoked"].Cert).Revoked(tx, when.Unix())
+	if err != nil {
+		t.Fatal(err)
+	} else if isRevoked {
+		t.Fatal("expected nothing to be recorded without record")
+	}
+
+	result, err = Reconcile(tx, records, intRel, when, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*certdb.Revocation{
+		"revoked":  {RevokedAt: date(2019, 6, 1).Unix(), Reason: "(1) keyCompromise"},
+		"orphaned": {RevokedAt: when.Unix(), Reason: StatusParentRevoked},
+	}
+	for name, want := range expected {
+		rev := &certdb.Revocation{SKI: certdb.NewCertificate(ints[name].Cert).SKI}
+		err = rev.Select(tx)
+		if err != nil {
+			t.Fatalf("expected %s to be revoked, but have %v", name, err)
+		}
+
+		if rev.Mechanism != MechanismCCADB || rev.Reason != want.Reason || rev.RevokedAt != want.RevokedAt {
+			t.Fatalf("unexpected revocation for %s: %+v", name, rev)
+		}
+	}
+
+	// Reconciling again leaves the revocations alone.
+	result, err = Reconcile(tx, records, intRel, when, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range result.Revoked {
+		if match.Recorded || match.Skipped == "" {
+			t.Fatalf("expected %s to be skipped, but have %+v", match.Record.Name, match)
+		}
+	}
+}
+
+// TestReconcileSharedKey checks that recording a revoked cross-sign
+// doesn't revoke the self-signed root sharing its key.
+func TestReconcileSharedKey(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	oldRoot, err := certdbtest.NewRoot("old root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot, err := certdbtest.NewRoot("new root", date(2019, 1, 1), date(2040, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cross, err := oldRoot.CrossSign(newRoot, date(2019, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), oldRoot.Cert, newRoot.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), cross.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := header +
+		fmt.Sprintf("Test,cross,Intermediate Certificate,Revoked,%s,2019.06.01,(4) superseded,false,2030.01.01\n", fingerprint(cross.Cert))
+	records, err := ParseCSV(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	when := date(2020, 1, 15)
+	result, err := Reconcile(tx, records, intRel, when, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Revoked) != 1 || result.Revoked[0].Recorded || result.Revoked[0].Skipped != revocation.SkippedSharedKey {
+		t.Fatalf("expected the revoked cross-sign to be skipped, but have %+v", result.Revoked)
+	}
+
+	isRevoked, err := certdb.NewCertificate(newRoot.Cert).Revoked(tx, when.Unix())
+	if err != nil {
+		t.Fatal(err)
+	} else if isRevoked {
+		t.Fatal("expected the self-signed root sharing the cross-sign's key not to be revoked")
+	}
+}
@@ -0,0 +1,259 @@
+package chain
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ubiquity"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// A Chain is a chain built for a leaf, from the leaf to a root. Score
+// is CFSSL's cross-platform ubiquity score for the chain, and Expires
+// is when the first of its certificates expires.
+type Chain struct {
+	Certificates []*diff.Certificate `json:"certificates" yaml:"certificates"`
+	Score        int                 `json:"score" yaml:"score"`
+	Expires      time.Time           `json:"expires" yaml:"expires"`
+	certs        []*x509.Certificate
+}
+
+// A Build lists the chains built for a leaf against the int and ca
+// releases, best first. If no chain could be built, Problems explains
+// why; it also notes chains rejected because their root is distrusted
+// for the leaf.
+type Build struct {
+	Leaf          *diff.Certificate `json:"leaf" yaml:"leaf"`
+	Intermediates *certdb.Release   `json:"intermediates" yaml:"intermediates"`
+	Roots         *certdb.Release   `json:"roots" yaml:"roots"`
+	Chains        []*Chain          `json:"chains" yaml:"chains"`
+	Problems      []string          `json:"problems" yaml:"problems"`
+}
+
+// describe names a certificate in explanations.
+func describe(cert *x509.Certificate) string {
+	return fmt.Sprintf("'%s' (SKI=%s)", common.NameToString(cert.Subject),
+		certdb.NewCertificate(cert).SKI)
+}
+
+// compareChains ranks chains as CFSSL's bundler does: by the ubiquity
+// of their hash algorithms, then by how many platforms trust them,
+// then by how long they last, and finally by their length.
+func compareChains(chain1, chain2 []*x509.Certificate) int {
+	if cmp := ubiquity.CompareChainHashUbiquity(chain1, chain2); cmp != 0 {
+		return cmp
+	}
+
+	if cmp := ubiquity.CrossPlatformUbiquity(chain1) - ubiquity.CrossPlatformUbiquity(chain2); cmp != 0 {
+		return cmp
+	}
+
+	if cmp := ubiquity.CompareChainExpiry(chain1, chain2); cmp != 0 {
+		return cmp
+	}
+
+	return ubiquity.CompareChainLength(chain1, chain2)
+}
+
+// pool collects the certificates in a release that aren't revoked at
+// the given time; the revoked ones are returned separately.
+func pool(tx *sql.Tx, rel *certdb.Release, when int64) ([]*certdb.Certificate, []*certdb.Certificate, error) {
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var usable, revoked []*certdb.Certificate
+	for _, cert := range certs {
+		isRevoked, err := cert.Revoked(tx, when)
+		if err != nil {
+			return nil, nil, err
+		} else if isRevoked {
+			revoked = append(revoked, cert)
+			continue
+		}
+		usable = append(usable, cert)
+	}
+
+	return usable, revoked, nil
+}
+
+// BuildChains builds every chain from the leaf to a root in the ca
+// release, through the intermediates in the int release, that is
+// valid at the given time. Revoked certificates are left out of the
+// pools, and chains whose root is distrusted for certificates issued
+// as late as the leaf are rejected. Platform scores use the platforms
+// loaded into CFSSL's ubiquity package, if any.
+func BuildChains(tx *sql.Tx, leaf *x509.Certificate, intRel, caRel *certdb.Release, when time.Time) (*Build, error) {
+	build := &Build{
+		Leaf:          diff.NewCertificate(certdb.NewCertificate(leaf)),
+		Intermediates: intRel,
+		Roots:         caRel,
+		Chains:        []*Chain{},
+		Problems:      []string{},
+	}
+
+	intermediates, revokedInts, err := pool(tx, intRel, when.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	roots, revokedRoots, err := pool(tx, caRel, when.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	opts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
+		Roots:         x509.NewCertPool(),
+		CurrentTime:   when,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	for _, cert := range intermediates {
+		opts.Intermediates.AddCert(cert.X509())
+	}
+
+	rootsByRaw := map[string]*certdb.Certificate{}
+	for _, cert := range roots {
+		opts.Roots.AddCert(cert.X509())
+		rootsByRaw[string(cert.Raw)] = cert
+	}
+
+	chains, verifyErr := leaf.Verify(opts)
+	for _, certs := range chains {
+		root := rootsByRaw[string(certs[len(certs)-1].Raw)]
+		if root != nil {
+			d, err := certdb.NewCertificateRelease(root, caRel).Distrust(tx)
+			if err == nil && leaf.NotBefore.Unix() > d.DistrustAfter {
+				build.Problems = append(build.Problems, fmt.Sprintf("a chain to %s was rejected: the root is distrusted for certificates issued after %s",
+					describe(root.X509()), d.Time().Format(common.DateFormat)))
+				continue
+			} else if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		chain := &Chain{
+			Score:   ubiquity.CrossPlatformUbiquity(certs),
+			Expires: helpers.ExpiryTime(certs).UTC(),
+			certs:   certs,
+		}
+		for _, cert := range certs {
+			chain.Certificates = append(chain.Certificates, diff.NewCertificate(certdb.NewCertificate(cert)))
+		}
+		build.Chains = append(build.Chains, chain)
+	}
+
+	sort.SliceStable(build.Chains, func(i, j int) bool {
+		return compareChains(build.Chains[i].certs, build.Chains[j].certs) > 0
+	})
+
+	if len(build.Chains) > 0 {
+		return build, nil
+	}
+
+	if verifyErr != nil {
+		build.Problems = append(build.Problems, verifyErr.Error())
+	}
+
+	released := append(intermediates, roots...)
+	revoked := append(revokedInts, revokedRoots...)
+	explanations, err := explain(tx, leaf, released, revoked, rootsByRaw)
+	if err != nil {
+		return nil, err
+	}
+	build.Problems = append(build.Problems, explanations...)
+
+	return build, nil
+}
+
+// explain follows the issuers of the leaf through the releases, and
+// explains where the chain breaks off: an issuer that was revoked,
+// that is in the database but not in the releases, or that isn't in
+// the database at all.
+func explain(tx *sql.Tx, leaf *x509.Certificate, released, revoked []*certdb.Certificate, roots map[string]*certdb.Certificate) ([]string, error) {
+	var all []*certdb.Certificate
+	var problems []string
+	seen := map[string]bool{}
+
+	cert := leaf
+	for depth := 0; depth < maxPathLength; depth++ {
+		if roots[string(cert.Raw)] != nil {
+			problems = append(problems, describe(leaf)+" reaches the root "+describe(cert)+
+				", but the chain isn't valid; see the verification error")
+			return problems, nil
+		}
+		seen[string(cert.Raw)] = true
+
+		var issuer *x509.Certificate
+		for _, candidate := range released {
+			if !seen[string(candidate.Raw)] && SignedBy(cert, candidate.X509()) {
+				issuer = candidate.X509()
+				break
+			}
+		}
+
+		if issuer != nil {
+			cert = issuer
+			continue
+		}
+
+		for _, candidate := range revoked {
+			if SignedBy(cert, candidate.X509()) {
+				problems = append(problems, "the issuer of "+describe(cert)+", "+
+					describe(candidate.X509())+", is revoked")
+				return problems, nil
+			}
+		}
+
+		if all == nil {
+			var err error
+			all, err = certdb.AllCertificates(tx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, candidate := range all {
+			if !SignedBy(cert, candidate.X509()) {
+				continue
+			}
+
+			releases, err := candidate.Releases(tx)
+			if err != nil {
+				return nil, err
+			}
+
+			var names []string
+			for _, rel := range releases {
+				names = append(names, rel.Bundle+" "+rel.Version)
+			}
+			if len(names) == 0 {
+				names = append(names, "no release")
+			}
+
+			problems = append(problems, fmt.Sprintf("the issuer of %s, %s, is in the database but not in the releases (it is in %s; it expires %s)",
+				describe(cert), describe(candidate.X509()), strings.Join(names, ", "),
+				candidate.X509().NotAfter.UTC().Format(common.DateFormat)))
+			return problems, nil
+		}
+
+		problem := fmt.Sprintf("the issuer of %s, '%s' (AKI=%x), isn't in the database",
+			describe(cert), common.NameToString(cert.Issuer), cert.AuthorityKeyId)
+		if len(cert.IssuingCertificateURL) > 0 {
+			problem += "; it may be fetched from " + cert.IssuingCertificateURL[0]
+		}
+		problems = append(problems, problem)
+		return problems, nil
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func asLeaf(template *x509.Certificate) {
+	template.IsCA = false
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+}
+
+// TestBuildChains releases an intermediate issued by primary and
+// cross-signed by legacy, which expires sooner, and builds chains for
+// a leaf issued by the intermediate; then for a leaf whose issuer
+// isn't in the database, and one whose issuer isn't released.
+func TestBuildChains(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	primary, err := certdbtest.NewRoot("primary", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := certdbtest.NewRoot("legacy", date(2010, 1, 1), date(2028, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := primary.Issue("intermediate", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crossSigned, err := legacy.CrossSign(intermediate, date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unreleased, err := primary.Issue("unreleased", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stranger, err := certdbtest.NewRoot("stranger", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := map[string]*certdbtest.Identity{}
+	issuers := map[string]*certdbtest.Identity{
+		"leaf":       intermediate,
+		"unreleased": unreleased,
+		"stranger":   stranger,
+	}
+	for name, issuer := range issuers {
+		leaves[name], err = issuer.Issue(name+" leaf", date(2020, 1, 1), date(2021, 1, 1), asLeaf,
+			func(template *x509.Certificate) {
+				template.IssuingCertificateURL = []string{"http://aia.example.com/" + name}
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	caRel, err := certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), primary.Cert, legacy.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), intermediate.Cert, crossSigned.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2019.1.0", date(2019, 1, 1), unreleased.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	build, err := BuildChains(tx, leaves["leaf"].Cert, intRel, caRel, date(2020, 6, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(build.Chains) != 2 || len(build.Problems) != 0 {
+		t.Fatalf("expected 2 chains and no problems, but have %d and %v", len(build.Chains), build.Problems)
+	}
+
+	// Both chains are equally ubiquitous, so the one lasting
+	// longer wins.
+	if root := build.Chains[0].Certificates[2]; root.Subject != "/primary/O=cfssl_trust test" {
+		t.Fatalf("expected the chain to primary to rank first, but have %s", root.Subject)
+	}
+
+	// Distrusting legacy for the leaf rejects its chain.
+	cr := certdb.NewCertificateRelease(certdb.NewCertificate(legacy.Cert), caRel)
+	_, err = cr.SetDistrust(tx, date(2019, 1, 1).Unix(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build, err = BuildChains(tx, leaves["leaf"].Cert, intRel, caRel, date(2020, 6, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(build.Chains) != 1 || len(build.Problems) != 1 || !strings.Contains(build.Problems[0], "distrusted") {
+		t.Fatalf("expected 1 chain and a distrust problem, but have %d and %v", len(build.Chains), build.Problems)
+	}
+
+	build, err = BuildChains(tx, leaves["stranger"].Cert, intRel, caRel, date(2020, 6, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := build.Problems[len(build.Problems)-1]
+	if len(build.Chains) != 0 || !strings.Contains(last, "isn't in the database") ||
+		!strings.Contains(last, "http://aia.example.com/stranger") {
+		t.Fatalf("expected the stranger's issuer to be missing, but have %v", build.Problems)
+	}
+
+	build, err = BuildChains(tx, leaves["unreleased"].Cert, intRel, caRel, date(2020, 6, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last = build.Problems[len(build.Problems)-1]
+	if len(build.Chains) != 0 || !strings.Contains(last, "not in the releases (it is in int 2019.1.0") {
+		t.Fatalf("expected the unreleased issuer to be found in int 2019.1.0, but have %v", build.Problems)
+	}
+}
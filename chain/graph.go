@@ -0,0 +1,178 @@
+package chain
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// A GraphNode is a certificate in the issuer graph. Its ID is the SKI
+// and hex-encoded serial number. Root is set for self-signed
+// certificates. SharedKey is set when other certificates in the graph
+// have the same public key, and CrossSigned when some of them were
+// issued by a different issuer.
+type GraphNode struct {
+	ID          string            `json:"id" yaml:"id"`
+	Root        bool              `json:"root" yaml:"root"`
+	CrossSigned bool              `json:"cross_signed" yaml:"cross_signed"`
+	SharedKey   bool              `json:"shared_key" yaml:"shared_key"`
+	Expired     bool              `json:"expired" yaml:"expired"`
+	Revoked     bool              `json:"revoked" yaml:"revoked"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+}
+
+// A GraphEdge links a certificate to the certificate that issued it.
+type GraphEdge struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// A Graph is the issuer graph of a set of certificates.
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes" yaml:"nodes"`
+	Edges []*GraphEdge `json:"edges" yaml:"edges"`
+}
+
+func nodeID(cert *certdb.Certificate) string {
+	return fmt.Sprintf("%s:%x", cert.SKI, cert.Serial)
+}
+
+// BuildGraph builds the issuer graph of the certificates: every
+// certificate is linked to each of the others whose signature on it
+// verifies. Expiry and revocation are checked as of the given time.
+func BuildGraph(tx *sql.Tx, certs []*certdb.Certificate, when int64) (*Graph, error) {
+	graph := &Graph{
+		Nodes: []*GraphNode{},
+		Edges: []*GraphEdge{},
+	}
+
+	var nodes []*node
+	byKey := map[string][]*certdb.Certificate{}
+	for _, cert := range certs {
+		nodes = append(nodes, &node{cert: cert})
+		key := string(cert.X509().RawSubjectPublicKeyInfo)
+		byKey[key] = append(byKey[key], cert)
+	}
+	linkIssuers(nodes)
+
+	for _, n := range nodes {
+		x509Cert := n.cert.X509()
+		revoked, err := n.cert.Revoked(tx, when)
+		if err != nil {
+			return nil, err
+		}
+
+		gn := &GraphNode{
+			ID:          nodeID(n.cert),
+			Root:        SignedBy(x509Cert, x509Cert),
+			Expired:     n.cert.NotAfter <= when,
+			Revoked:     revoked,
+			Certificate: diff.NewCertificate(n.cert),
+		}
+
+		for _, other := range byKey[string(x509Cert.RawSubjectPublicKeyInfo)] {
+			if other == n.cert {
+				continue
+			}
+
+			gn.SharedKey = true
+			if string(other.X509().RawIssuer) != string(x509Cert.RawIssuer) {
+				gn.CrossSigned = true
+			}
+		}
+		graph.Nodes = append(graph.Nodes, gn)
+
+		for _, issuer := range n.issuers {
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From: gn.ID,
+				To:   nodeID(issuer.cert),
+			})
+		}
+	}
+
+	return graph, nil
+}
+
+// quoteDOT quotes a string as a DOT identifier; newlines become line
+// breaks in labels.
+func quoteDOT(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + strings.Replace(s, "\n", `\n`, -1) + `"`
+}
+
+// attributes returns the DOT attributes for a node: roots have a
+// double border, cross-signed certificates are blue, certificates
+// sharing a key are bold, and expired or revoked ones are dashed and
+// grey or red.
+func (gn *GraphNode) attributes() string {
+	label := gn.Certificate.Subject + "\nSKI " + gn.Certificate.SKI
+	var notes []string
+	if gn.Root {
+		notes = append(notes, "root")
+	}
+	if gn.CrossSigned {
+		notes = append(notes, "cross-signed")
+	} else if gn.SharedKey {
+		notes = append(notes, "shared key")
+	}
+	if gn.Expired {
+		notes = append(notes, "expired")
+	}
+	if gn.Revoked {
+		notes = append(notes, "revoked")
+	}
+	if len(notes) > 0 {
+		label += "\n(" + strings.Join(notes, ", ") + ")"
+	}
+
+	attrs := []string{"label=" + quoteDOT(label)}
+	if gn.Root {
+		attrs = append(attrs, "peripheries=2")
+	}
+	if gn.CrossSigned {
+		attrs = append(attrs, "color=blue")
+	}
+	if gn.SharedKey {
+		attrs = append(attrs, "penwidth=2")
+	}
+
+	switch {
+	case gn.Revoked:
+		attrs = append(attrs, "style=dashed", "fontcolor=red")
+	case gn.Expired:
+		attrs = append(attrs, "style=dashed", "fontcolor=grey")
+	}
+
+	return strings.Join(attrs, ", ")
+}
+
+// WriteDOT writes the graph in Graphviz's DOT language, with edges
+// pointing from each certificate to its issuer.
+func (graph *Graph) WriteDOT(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "digraph issuers {\n\tnode [shape=box];")
+	if err != nil {
+		return err
+	}
+
+	for _, gn := range graph.Nodes {
+		_, err = fmt.Fprintf(w, "\t%s [%s];\n", quoteDOT(gn.ID), gn.attributes())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		_, err = fmt.Fprintf(w, "\t%s -> %s;\n", quoteDOT(edge.From), quoteDOT(edge.To))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+// TestBuildGraph builds the graph of two roots, old and new, where new
+// is cross-signed by old, and an intermediate issued by new; old
+// expired before the graph is built.
+func TestBuildGraph(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	oldRoot, err := certdbtest.NewRoot("old", date(2010, 1, 1), date(2019, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot, err := certdbtest.NewRoot("new", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crossSigned, err := oldRoot.CrossSign(newRoot, date(2017, 1, 1), date(2019, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := newRoot.Issue("intermediate", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1),
+		oldRoot.Cert, newRoot.Cert, crossSigned.Cert, intermediate.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := BuildGraph(tx, certs, date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(graph.Nodes) != 4 {
+		t.Fatalf("expected 4 nodes, but have %d", len(graph.Nodes))
+	}
+
+	nodes := map[string]*GraphNode{}
+	for _, gn := range graph.Nodes {
+		name := gn.Certificate.Cert.X509().Subject.CommonName
+		if name == "new" && !gn.Root {
+			name = "new cross-signed"
+		}
+		nodes[name] = gn
+	}
+
+	if !nodes["old"].Root || !nodes["old"].Expired || nodes["old"].SharedKey {
+		t.Fatal("expected old to be an expired root with a key of its own")
+	}
+
+	if !nodes["new"].Root || !nodes["new"].CrossSigned || !nodes["new"].SharedKey {
+		t.Fatal("expected new to be a cross-signed root")
+	}
+
+	if cross := nodes["new cross-signed"]; cross == nil || cross.Root || !cross.CrossSigned || !cross.Expired {
+		t.Fatal("expected the cross-sign of new to be an expired, cross-signed intermediate")
+	}
+
+	if nodes["intermediate"].Root || nodes["intermediate"].CrossSigned || nodes["intermediate"].SharedKey {
+		t.Fatal("expected intermediate to be an ordinary intermediate")
+	}
+
+	// The intermediate verifies under both certificates for new's
+	// key, and the cross-sign under old.
+	edges := map[string]int{}
+	for _, edge := range graph.Edges {
+		edges[edge.From]++
+	}
+
+	if len(graph.Edges) != 3 || edges[nodes["intermediate"].ID] != 2 || edges[nodes["new cross-signed"].ID] != 1 {
+		t.Fatalf("expected 3 edges, 2 from the intermediate, but have %d", len(graph.Edges))
+	}
+
+	buf := &bytes.Buffer{}
+	err = graph.WriteDOT(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph issuers {") || strings.Count(dot, " -> ") != 3 ||
+		!strings.Contains(dot, "(root, cross-signed)") {
+		t.Fatalf("unexpected DOT output:\n%s", dot)
+	}
+}
@@ -0,0 +1,289 @@
+// Package chain checks how the certificates in the trust database
+// chain to each other, verifying the signature on every link.
+package chain
+
+import (
+	"bytes"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// These are the results of verifying an intermediate's chains.
+const (
+	// StatusValid intermediates have a chain to a root in which
+	// no certificate is expired or revoked.
+	StatusValid = "valid"
+
+	// StatusExpiredOrRevoked intermediates only chain to roots
+	// through certificates that are expired or revoked.
+	StatusExpiredOrRevoked = "expired-or-revoked"
+
+	// StatusOrphaned intermediates don't chain to any root.
+	StatusOrphaned = "orphaned"
+)
+
+// maxPathLength bounds the chains that are followed; real chains are
+// much shorter, but cross-signs can make the graph arbitrarily deep.
+const maxPathLength = 8
+
+// An Intermediate describes the chains from an intermediate to the
+// roots. PathLength is the number of certificates above the
+// intermediate in its shortest chain, counting the root, preferring
+// valid chains; it is zero for orphaned intermediates. Roots lists the
+// SKIs of the roots those chains end in.
+type Intermediate struct {
+	Status      string            `json:"status" yaml:"status"`
+	PathLength  int               `json:"path_length" yaml:"path_length"`
+	Roots       []string          `json:"roots" yaml:"roots"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+}
+
+// A Report describes the chains from the intermediates in an int
+// release to the roots in a ca release.
+type Report struct {
+	Intermediates    *certdb.Release `json:"intermediates" yaml:"intermediates"`
+	Roots            *certdb.Release `json:"roots" yaml:"roots"`
+	Valid            int             `json:"valid" yaml:"valid"`
+	ExpiredOrRevoked int             `json:"expired_or_revoked" yaml:"expired_or_revoked"`
+	Orphaned         int             `json:"orphaned" yaml:"orphaned"`
+	Certificates     []*Intermediate `json:"certificates" yaml:"certificates"`
+}
+
+// Failed returns true if any intermediate lacks a valid chain.
+func (report *Report) Failed() bool {
+	return report.ExpiredOrRevoked > 0 || report.Orphaned > 0
+}
+
+// A node is a certificate in the issuer graph.
+type node struct {
+	cert    *certdb.Certificate
+	root    bool
+	invalid bool // expired or revoked
+	issuers []*node
+}
+
+// SignedBy returns true if parent issued child: the names and key
+// identifiers must match, and parent's key must verify the signature
+// on child.
+func SignedBy(child, parent *x509.Certificate) bool {
+	if !bytes.Equal(child.RawIssuer, parent.RawSubject) {
+		return false
+	}
+
+	if len(child.AuthorityKeyId) > 0 && len(parent.SubjectKeyId) > 0 &&
+		!bytes.Equal(child.AuthorityKeyId, parent.SubjectKeyId) {
+		return false
+	}
+
+	// CheckSignature, unlike CheckSignatureFrom, still accepts
+	// SHA-1 signatures, which many older chains rely on.
+	return parent.CheckSignature(child.SignatureAlgorithm, child.RawTBSCertificate, child.Signature) == nil
+}
+
+// linkIssuers connects every node to the nodes that issued it,
+// looking candidates up by the AKI; certificates without an AKI are
+// matched against every node. Certificates for the same key aren't
+// linked: a self-signed root would otherwise verify under its own
+// cross-signs.
+func linkIssuers(nodes []*node) {
+	bySKI := map[string][]*node{}
+	for _, n := range nodes {
+		bySKI[n.cert.SKI] = append(bySKI[n.cert.SKI], n)
+	}
+
+	for _, n := range nodes {
+		candidates := nodes
+		if n.cert.AKI != "" {
+			candidates = bySKI[n.cert.AKI]
+		}
+
+		for _, parent := range candidates {
+			if bytes.Equal(n.cert.X509().RawSubjectPublicKeyInfo, parent.cert.X509().RawSubjectPublicKeyInfo) {
+				continue
+			}
+
+			if SignedBy(n.cert.X509(), parent.cert.X509()) {
+				n.issuers = append(n.issuers, parent)
+			}
+		}
+	}
+}
+
+// path is a chain from an intermediate to a root.
+type path struct {
+	length int
+	valid  bool
+	root   *node
+}
+
+// paths finds the chains from n to a root, not revisiting the nodes
+// already on the chain.
+func paths(n *node, seen map[*node]bool, length int, valid bool) []path {
+	if n.root {
+		return []path{{length: length, valid: valid, root: n}}
+	}
+
+	if length >= maxPathLength {
+		return nil
+	}
+
+	seen[n] = true
+	defer delete(seen, n)
+
+	var found []path
+	for _, parent := range n.issuers {
+		if seen[parent] {
+			continue
+		}
+
+		found = append(found, paths(parent, seen, length+1, valid && !parent.invalid)...)
+	}
+	return found
+}
+
+// verifyIntermediate classifies the chains found for an intermediate.
+func verifyIntermediate(n *node) *Intermediate {
+	found := paths(n, map[*node]bool{}, 0, true)
+	result := &Intermediate{
+		Status:      StatusOrphaned,
+		Roots:       []string{},
+		Certificate: diff.NewCertificate(n.cert),
+	}
+	if len(found) == 0 {
+		return result
+	}
+
+	var anyValid bool
+	for _, p := range found {
+		if p.valid {
+			anyValid = true
+			break
+		}
+	}
+
+	result.Status = StatusExpiredOrRevoked
+	if anyValid {
+		result.Status = StatusValid
+	}
+
+	roots := map[string]bool{}
+	for _, p := range found {
+		if anyValid && !p.valid {
+			continue
+		}
+
+		if result.PathLength == 0 || p.length < result.PathLength {
+			result.PathLength = p.length
+		}
+
+		if !roots[p.root.cert.SKI] {
+			roots[p.root.cert.SKI] = true
+			result.Roots = append(result.Roots, p.root.cert.SKI)
+		}
+	}
+	sort.Strings(result.Roots)
+
+	return result
+}
+
+// invalid returns true if the certificate is expired or revoked at
+// the given time.
+func invalid(tx *sql.Tx, cert *certdb.Certificate, when int64) (bool, error) {
+	if cert.NotAfter <= when {
+		return true, nil
+	}
+
+	return cert.Revoked(tx, when)
+}
+
+// Verify checks that every intermediate in the int release chains to
+// a root in the ca release, as of the given time. Chains may pass
+// through other intermediates in the release. Certificates expired or
+// revoked at that time don't make a chain invalid when they are the
+// intermediate being checked; the expiring command reports those.
+func Verify(tx *sql.Tx, intRel, caRel *certdb.Release, when int64) (*Report, error) {
+	if intRel.Bundle != "int" || caRel.Bundle != "ca" {
+		return nil, errors.New("chain: intermediates must be verified against a ca release")
+	}
+
+	intermediates, err := certdb.CollectRelease(intRel.Bundle, intRel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := certdb.CollectRelease(caRel.Bundle, caRel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*node
+	for _, cert := range roots {
+		nodes = append(nodes, &node{cert: cert, root: true})
+	}
+
+	var intNodes []*node
+	for _, cert := range intermediates {
+		intNodes = append(intNodes, &node{cert: cert})
+	}
+	nodes = append(nodes, intNodes...)
+
+	for _, n := range nodes {
+		n.invalid, err = invalid(tx, n.cert, when)
+		if err != nil {
+			return nil, err
+		}
+	}
+	linkIssuers(nodes)
+
+	report := &Report{
+		Intermediates: intRel,
+		Roots:         caRel,
+		Certificates:  []*Intermediate{},
+	}
+
+	for _, n := range intNodes {
+		result := verifyIntermediate(n)
+		switch result.Status {
+		case StatusValid:
+			report.Valid++
+		case StatusExpiredOrRevoked:
+			report.ExpiredOrRevoked++
+		case StatusOrphaned:
+			report.Orphaned++
+		}
+		report.Certificates = append(report.Certificates, result)
+	}
+
+	return report, nil
+}
+
+// MatchingRelease returns the ca release that an int release's
+// intermediates should chain to: the ca release with the same version
+// if there is one, or else the latest ca release made no later than
+// the int release.
+func MatchingRelease(db *sql.DB, intRel *certdb.Release) (*certdb.Release, error) {
+	caRel, err := certdb.FetchRelease(db, "ca", intRel.Version)
+	if err == nil {
+		return caRel, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	releases, err := certdb.AllReleases(db, "ca")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range releases {
+		if rel.ReleasedAt <= intRel.ReleasedAt {
+			return rel, nil
+		}
+	}
+
+	return nil, errors.New("chain: no ca release matches int release " + intRel.Version)
+}
@@ -0,0 +1,184 @@
+package chain
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// TestVerify checks the intermediates under:
+//
+//   - good, a valid root, which issued direct and, through it, nested;
+//   - expired, a root expired by the time of the check, which issued
+//     stale;
+//   - revoked, a revoked root, which issued withdrawn;
+//   - dropped, a root left out of the ca release, which issued orphan.
+//
+// forged claims to be issued by good, but is signed by another key.
+func TestVerify(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	roots := map[string]*certdbtest.Identity{}
+	for _, cn := range []string{"good", "revoked", "dropped"} {
+		roots[cn], err = certdbtest.NewRoot(cn, date(2017, 1, 1), date(2030, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots["expired"], err = certdbtest.NewRoot("expired", date(2017, 1, 1), date(2019, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuers := map[string]*certdbtest.Identity{
+		"direct":    roots["good"],
+		"stale":     roots["expired"],
+		"withdrawn": roots["revoked"],
+		"orphan":    roots["dropped"],
+	}
+
+	ints := map[string]*certdbtest.Identity{}
+	for cn, issuer := range issuers {
+		ints[cn], err = issuer.Issue(cn, date(2017, 1, 1), date(2030, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ints["nested"], err = ints["direct"].Issue("nested", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impostor, err := certdbtest.NewRoot("good", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ints["forged"], err = impostor.Issue("forged", date(2017, 1, 1), date(2030, 1, 1), func(template *x509.Certificate) {
+		template.AuthorityKeyId = roots["good"].Cert.SubjectKeyId
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caRel, err := certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1),
+		roots["good"].Cert, roots["expired"].Cert, roots["revoked"].Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var intCerts []*x509.Certificate
+	for _, id := range ints {
+		intCerts = append(intCerts, id.Cert)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), intCerts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	revoked := certdb.NewCertificate(roots["revoked"].Cert)
+	err = revoked.Revoke(tx, "test", "test", date(2019, 6, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify(tx, intRel, caRel, date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		status string
+		length int
+	}{
+		"direct":    {StatusValid, 1},
+		"nested":    {StatusValid, 2},
+		"stale":     {StatusExpiredOrRevoked, 1},
+		"withdrawn": {StatusExpiredOrRevoked, 1},
+		"orphan":    {StatusOrphaned, 0},
+		"forged":    {StatusOrphaned, 0},
+	}
+
+	if len(report.Certificates) != len(expected) {
+		t.Fatalf("expected %d intermediates, but have %d", len(expected), len(report.Certificates))
+	}
+
+	for _, result := range report.Certificates {
+		cn := result.Certificate.Cert.X509().Subject.CommonName
+		if result.Status != expected[cn].status || result.PathLength != expected[cn].length {
+			t.Fatalf("expected %s to be %s with path length %d, but have %s with path length %d",
+				cn, expected[cn].status, expected[cn].length, result.Status, result.PathLength)
+		}
+	}
+
+	if report.Valid != 2 || report.ExpiredOrRevoked != 2 || report.Orphaned != 2 || !report.Failed() {
+		t.Fatalf("expected 2 valid, 2 expired or revoked, and 2 orphaned intermediates, but have %d, %d, and %d",
+			report.Valid, report.ExpiredOrRevoked, report.Orphaned)
+	}
+}
+
+func TestMatchingRelease(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.3.0", date(2020, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.2.0", date(2020, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caRel, err := MatchingRelease(db, intRel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if caRel.Version != "2020.1.0" {
+		t.Fatalf("expected int 2020.2.0 to match ca 2020.1.0, but have %s", caRel.Version)
+	}
+
+	intRel, err = certdbtest.AddRelease(db, "int", "2020.3.0", date(2020, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caRel, err = MatchingRelease(db, intRel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if caRel.Version != "2020.3.0" {
+		t.Fatalf("expected int 2020.3.0 to match ca 2020.3.0, but have %s", caRel.Version)
+	}
+}
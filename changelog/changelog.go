@@ -0,0 +1,328 @@
+// Package changelog produces release notes for trust store releases,
+// covering both the root and intermediate bundles.
+package changelog
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// Bundles lists the bundles covered by a changelog, in the order they
+// are reported.
+var Bundles = []string{"ca", "int"}
+
+// Revocation describes the revocation recorded for a certificate.
+type Revocation struct {
+	RevokedAt time.Time `json:"revoked_at" yaml:"revoked_at"`
+	Mechanism string    `json:"mechanism" yaml:"mechanism"`
+	Reason    string    `json:"reason" yaml:"reason"`
+}
+
+// Certificate is a certificate added to or removed from a release,
+// along with its revocation, if any.
+type Certificate struct {
+	diff.Certificate `yaml:",inline"`
+	Revocation       *Revocation `json:"revocation,omitempty" yaml:"revocation,omitempty"`
+}
+
+// Counts summarises the changes to a bundle.
+type Counts struct {
+	Total           int            `json:"total" yaml:"total"`
+	Added           int            `json:"added" yaml:"added"`
+	Removed         int            `json:"removed" yaml:"removed"`
+	RemovedByReason map[string]int `json:"removed_by_reason" yaml:"removed_by_reason"`
+}
+
+// Bundle lists the changes to one bundle. From is empty if To is the
+// first release of the bundle.
+type Bundle struct {
+	Bundle  string         `json:"bundle" yaml:"bundle"`
+	From    string         `json:"from" yaml:"from"`
+	To      string         `json:"to" yaml:"to"`
+	Counts  Counts         `json:"counts" yaml:"counts"`
+	Added   []*Certificate `json:"added" yaml:"added"`
+	Removed []*Certificate `json:"removed" yaml:"removed"`
+}
+
+// Changelog contains the release notes for a release or a range of
+// releases. Bundles that don't have the release are left out.
+type Changelog struct {
+	From    string    `json:"from,omitempty" yaml:"from,omitempty"`
+	To      string    `json:"to" yaml:"to"`
+	Bundles []*Bundle `json:"bundles" yaml:"bundles"`
+}
+
+func lookupRevocation(tx *sql.Tx, ski string) (*Revocation, error) {
+	rev := &certdb.Revocation{SKI: ski}
+	err := rev.Select(tx)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &Revocation{
+		RevokedAt: time.Unix(rev.RevokedAt, 0).UTC(),
+		Mechanism: rev.Mechanism,
+		Reason:    rev.Reason,
+	}, nil
+}
+
+func annotate(tx *sql.Tx, certs []*diff.Certificate) ([]*Certificate, error) {
+	annotated := make([]*Certificate, 0, len(certs))
+	for _, cert := range certs {
+		rev, err := lookupRevocation(tx, cert.SKI)
+		if err != nil {
+			return nil, err
+		}
+
+		annotated = append(annotated, &Certificate{
+			Certificate: *cert,
+			Revocation:  rev,
+		})
+	}
+
+	return annotated, nil
+}
+
+// previousVersion returns the release of the bundle preceding rel, or
+// an empty string if rel is the first release.
+func previousVersion(db *sql.DB, rel *certdb.Release) (string, error) {
+	prev, err := rel.Previous(db)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return prev.Version, nil
+}
+
+// New builds the changelog for the changes between the from and to
+// releases of each bundle. If from is empty, each bundle's release is
+// compared to the bundle's previous release; otherwise, bundles
+// without a from release are left out. The window should match the
+// expiration window used when rolling the releases.
+func New(db *sql.DB, from, to string, window time.Duration) (*Changelog, error) {
+	cl := &Changelog{
+		From:    from,
+		To:      to,
+		Bundles: []*Bundle{},
+	}
+
+	// The previous releases are looked up before starting the
+	// transaction, as Previous runs its own.
+	fromVersions := map[string]string{}
+	for _, b := range Bundles {
+		rel, err := certdb.FetchRelease(db, b, to)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if from == "" {
+			fromVersions[b], err = previousVersion(db, rel)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// A bundle without the from release can't be compared,
+		// but the other bundle still gets its notes.
+		_, err = certdb.FetchRelease(db, b, from)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fromVersions[b] = from
+	}
+
+	if len(fromVersions) == 0 {
+		if from != "" {
+			return nil, errors.New("changelog: no bundle has both release " + from + " and release " + to)
+		}
+		return nil, errors.New("changelog: release " + to + " doesn't exist")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, b := range Bundles {
+		fromVersion, ok := fromVersions[b]
+		if !ok {
+			continue
+		}
+
+		d, err := diff.Releases(tx, b, fromVersion, to, window)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle := &Bundle{
+			Bundle: b,
+			From:   fromVersion,
+			To:     to,
+			Counts: Counts{
+				Total:           d.Total,
+				Added:           len(d.Added),
+				Removed:         len(d.Removed),
+				RemovedByReason: map[string]int{},
+			},
+		}
+
+		for _, cert := range d.Removed {
+			bundle.Counts.RemovedByReason[cert.Reason]++
+		}
+
+		bundle.Added, err = annotate(tx, d.Added)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.Removed, err = annotate(tx, d.Removed)
+		if err != nil {
+			return nil, err
+		}
+
+		cl.Bundles = append(cl.Bundles, bundle)
+	}
+
+	return cl, tx.Commit()
+}
+
+// escapeMarkdown escapes the characters in s that would break a
+// Markdown table cell.
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+}
+
+func (c *Counts) summary() string {
+	s := fmt.Sprintf("%d certificates; %d added, %d removed", c.Total, c.Added, c.Removed)
+	if c.Removed == 0 {
+		return s + "."
+	}
+
+	reasons := make([]string, 0, len(c.RemovedByReason))
+	for reason := range c.RemovedByReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%d %s", c.RemovedByReason[reason], reason)
+	}
+
+	return s + " (" + strings.Join(reasons, ", ") + ")."
+}
+
+func (cert *Certificate) revocationNote() string {
+	if cert.Revocation == nil {
+		return ""
+	}
+
+	rev := cert.Revocation
+	note := fmt.Sprintf("revoked %s via %s", rev.RevokedAt.Format("2006-01-02"), rev.Mechanism)
+	if rev.Reason != "" {
+		note += ": " + rev.Reason
+	}
+	return escapeMarkdown(note)
+}
+
+func writeTable(w io.Writer, certs []*Certificate, removed bool) error {
+	header := "| Subject | SKI | Serial | Expires |"
+	rule := "| --- | --- | --- | --- |"
+	if removed {
+		header += " Reason |"
+		rule += " --- |"
+	} else {
+		header += " Notes |"
+		rule += " --- |"
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n%s\n", header, rule)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		last := cert.revocationNote()
+		if removed {
+			last = cert.Reason
+			if note := cert.revocationNote(); note != "" {
+				last += " (" + note + ")"
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "| %s | `%s` | `%s` | %s | %s |\n",
+			escapeMarkdown(cert.Subject), cert.SKI, cert.Serial,
+			cert.NotAfter.Format(common.DateFormat), last)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteMarkdown writes the changelog as Markdown release notes.
+func (cl *Changelog) WriteMarkdown(w io.Writer) error {
+	title := "Trust store release " + cl.To
+	if cl.From != "" {
+		title = "Trust store changes from " + cl.From + " to " + cl.To
+	}
+
+	_, err := fmt.Fprintf(w, "# %s\n", title)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range cl.Bundles {
+		from := b.From
+		if from == "" {
+			from = "(initial release)"
+		}
+
+		_, err = fmt.Fprintf(w, "\n## %s bundle (%s → %s)\n\n%s\n",
+			b.Bundle, from, b.To, b.Counts.summary())
+		if err != nil {
+			return err
+		}
+
+		if len(b.Added) > 0 {
+			if _, err = fmt.Fprintf(w, "\n### Added\n\n"); err != nil {
+				return err
+			}
+
+			if err = writeTable(w, b.Added, false); err != nil {
+				return err
+			}
+		}
+
+		if len(b.Removed) > 0 {
+			if _, err = fmt.Fprintf(w, "\n### Removed\n\n"); err != nil {
+				return err
+			}
+
+			if err = writeTable(w, b.Removed, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
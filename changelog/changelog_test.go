@@ -0,0 +1,127 @@
+package changelog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestChangelog(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("Root", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distrusted, err := certdbtest.NewRoot("Distrusted | Root", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := root.Issue("Intermediate", date(2017, 1, 1), date(2025, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.6.0", date(2017, 6, 1), root.Cert, distrusted.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.8.0", date(2017, 8, 1), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2017.8.0", date(2017, 8, 2), intermediate.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = certdb.NewCertificate(distrusted.Cert).Revoke(tx, "manual", "CA distrusted", date(2017, 7, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err := New(db, "", "2017.8.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cl.Bundles) != 2 {
+		t.Fatalf("expected both bundles in the changelog, but have %d", len(cl.Bundles))
+	}
+
+	ca := cl.Bundles[0]
+	if ca.From != "2017.6.0" || ca.Counts.Removed != 1 || ca.Counts.RemovedByReason[certdb.ExcludedRevoked] != 1 {
+		t.Fatalf("expected a single revoked root to be removed since 2017.6.0, have %+v", ca.Counts)
+	}
+
+	if ca.Removed[0].Revocation == nil || ca.Removed[0].Revocation.Reason != "CA distrusted" {
+		t.Fatal("expected the removed root to carry its revocation")
+	}
+
+	ints := cl.Bundles[1]
+	if ints.From != "" || ints.Counts.Added != 1 || ints.Counts.Total != 1 {
+		t.Fatalf("expected the first int release to add a single intermediate, have %+v", ints.Counts)
+	}
+
+	buf := &bytes.Buffer{}
+	err = cl.WriteMarkdown(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := buf.String()
+	for _, expected := range []string{
+		"# Trust store release 2017.8.0",
+		"## ca bundle (2017.6.0 → 2017.8.0)",
+		"1 certificates; 0 added, 1 removed (1 revoked).",
+		`/Distrusted \| Root/O=cfssl\_trust test`,
+		"revoked (revoked 2017-07-01 via manual: CA distrusted)",
+		"## int bundle ((initial release) → 2017.8.0)",
+	} {
+		if !strings.Contains(md, expected) {
+			t.Fatalf("expected the changelog to contain '%s':\n%s", expected, md)
+		}
+	}
+
+	// The int bundle has no 2017.6.0 release, so only the ca
+	// bundle is covered.
+	cl, err = New(db, "2017.6.0", "2017.8.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cl.Bundles) != 1 || cl.Bundles[0].Bundle != "ca" || cl.Bundles[0].Counts.Removed != 1 {
+		t.Fatalf("expected only the ca bundle in the changelog, but have %d bundles", len(cl.Bundles))
+	}
+
+	_, err = New(db, "", "2019.1.0", 0)
+	if err == nil {
+		t.Fatal("building a changelog for a missing release should fail")
+	}
+}
@@ -1,46 +1,122 @@
 package cli
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/publish"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var (
+	bundleFormat            string
+	bundlePassword          string
+	bundlePurpose           string
+	bundleGoPackage         string
+	bundleIncludeDistrusted bool
+)
+
 var bundleCmd = &cobra.Command{
 	Use:   "bundle",
 	Short: "Emit a certificate bundle.",
 	Long: `Emit either a root or intermediate bundle for a given release. If given a
-filename, the bundle will be written to that file.`,
+filename, the bundle will be written to that file.
+
+The bundle is written as concatenated PEM certificates by default. The
+--format flag selects another encoding:
+
+	pem        concatenated PEM certificates
+	pkcs7      a degenerate (certificates-only) PKCS #7 bundle, DER-encoded
+	pkcs7-pem  the same PKCS #7 bundle, PEM-encoded
+	pkcs12     a PKCS #12 truststore of trusted certificate entries
+	hashdir    an OpenSSL CApath directory, as laid out by c_rehash
+	manifest   a JSON manifest of the certificates and their trust
+	go         Go source for an x509.CertPool of the certificates
+
+A hashdir bundle is written to the named directory, one certificate per
+file named after the OpenSSL hash of its subject. Hashed files left over
+from previous releases are removed so that the directory matches the
+release; other files are left alone.
+
+PKCS #12 truststores are protected with the --password, which defaults
+to the Java truststore default of "changeit".
+
+The --purpose flag limits the bundle to the certificates trusted for a
+purpose (serverAuth, clientAuth, emailProtection, codeSigning,
+timeStamping or OCSPSigning) in the release. Certificates imported
+without purposes are trusted for every purpose.
+
+Certificates can be partially distrusted in a release (see 'distrust'):
+certificates they issued after the distrust date are no longer trusted.
+The manifest records the distrust date, and the go format adds such
+certificates with x509.CertPool.AddCertWithConstraint (Go 1.22 or later)
+so that only leaves issued before the date are accepted; the generated
+package is named by --go-package. The other formats can't express a
+distrust date, so a partially distrusted certificate is kept until its
+distrust date and left out of releases made on or after it, unless
+--include-distrusted is given.
+
+Examples:
+
+	$ cfssl-trust -b ca -r 2024.4.1 bundle --format pkcs7 ca-bundle.p7b
+	$ cfssl-trust -b ca bundle --format pkcs12 --password secret truststore.p12
+	$ cfssl-trust -b ca -r 2024.4.1 bundle --format hashdir /etc/ssl/certs/trust
+	$ cfssl-trust -b ca -r 2024.4.1 bundle --purpose serverAuth tls-roots.pem
+	$ cfssl-trust -b ca -r 2024.4.1 bundle --format go --go-package roots roots.go
+`,
 	Run: buildBundle,
 }
 
 func init() {
+	bundleCmd.Flags().StringVar(&bundleFormat, "format", publish.FormatPEM, "bundle format ("+strings.Join(publish.Formats, ", ")+")")
+	bundleCmd.Flags().StringVar(&bundlePassword, "password", "changeit", "password for PKCS #12 truststores")
+	bundleCmd.Flags().StringVar(&bundlePurpose, "purpose", "", "only include certificates trusted for this purpose")
+	bundleCmd.Flags().StringVar(&bundleGoPackage, "go-package", "roots", "package name for the go format")
+	bundleCmd.Flags().BoolVar(&bundleIncludeDistrusted, "include-distrusted", false, "keep partially distrusted certificates in formats that can't express distrust")
 	rootCmd.AddCommand(bundleCmd)
 }
 
-func encodeBundle(certs []*certdb.Certificate) string {
-	var buf = &bytes.Buffer{}
-	for _, cert := range certs {
-		p := &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: cert.Raw,
-		}
+func writeHashDir(certs []*certdb.Certificate, args []string) error {
+	if len(args) != 1 {
+		return errors.New("a hashdir bundle must be written to a single directory")
+	}
 
-		err := pem.Encode(buf, p)
-		if err != nil {
-			// A bytes.Buffer write should never fail.
-			panic("cfssl-trust: write to *bytes.Buffer should never fail")
-		}
+	result, err := publish.WriteHashDir(args[0], certs)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range result.Removed {
+		fmt.Printf("- removed stale certificate %s\n", name)
 	}
 
-	return buf.String()
+	fmt.Printf("Wrote %d certificates to %s: %d updated, %d unchanged, %d removed.\n",
+		len(certs), args[0], len(result.Written), len(result.Unchanged), len(result.Removed))
+	return nil
+}
+
+// encodeBundle encodes the certificates in the selected format,
+// loading the release's trust in them for the formats that carry it.
+func encodeBundle(tx *sql.Tx, rel *certdb.Release, certs []*certdb.Certificate) ([]byte, error) {
+	if !publish.IsEntryFormat(bundleFormat) {
+		return publish.Encode(certs, bundleFormat, bundlePassword)
+	}
+
+	entries, err := publish.LoadEntries(tx, rel, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundleFormat == publish.FormatGo {
+		return publish.EncodeGo(rel, entries, bundleGoPackage)
+	}
+	return publish.EncodeManifest(rel, entries)
 }
 
 func buildBundle(cmd *cobra.Command, args []string) {
@@ -70,7 +146,47 @@ func buildBundle(cmd *cobra.Command, args []string) {
 		}
 	}()
 
-	certs, err := certdb.CollectRelease(bundle, bundleRelease, tx)
+	var certs []*certdb.Certificate
+	if bundlePurpose != "" {
+		certs, err = certdb.CollectPurpose(bundle, bundleRelease, bundlePurpose, tx)
+	} else {
+		certs, err = certdb.CollectRelease(bundle, bundleRelease, tx)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	rel := &certdb.Release{Bundle: bundle, Version: bundleRelease}
+	err = rel.Select(tx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if !publish.IsEntryFormat(bundleFormat) && !bundleIncludeDistrusted {
+		var distrusted []*certdb.Certificate
+		certs, distrusted, err = certdb.ExcludeDistrusted(tx, rel, certs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, cert := range distrusted {
+			fmt.Printf("- left out partially distrusted certificate %s\n", cert.SKI)
+		}
+	}
+
+	if bundleFormat == publish.FormatHashDir {
+		err = writeHashDir(certs, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	encoded, err := encodeBundle(tx, rel, certs)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 		os.Exit(1)
@@ -78,12 +194,17 @@ func buildBundle(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("Selected %d certificates for this release.\n", len(certs))
 
-	pemBundle := encodeBundle(certs)
 	switch len(args) {
 	case 0:
-		fmt.Println(pemBundle)
+		// Binary bundles would be mixed up with the messages
+		// written to standard output.
+		if publish.IsBinaryFormat(bundleFormat) {
+			fmt.Fprintf(os.Stderr, "[!] %s bundles must be written to a file.\n", bundleFormat)
+			os.Exit(1)
+		}
+		fmt.Println(string(encoded))
 	case 1:
-		err = ioutil.WriteFile(args[0], []byte(pemBundle), 0644)
+		err = ioutil.WriteFile(args[0], encoded, 0644)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 			os.Exit(1)
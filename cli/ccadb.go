@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/ccadb"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ccadbRecord bool
+
+var ccadbCmd = &cobra.Command{
+	Use:   "ccadb <report.csv>",
+	Short: "Reconcile an int release with a CCADB CSV report.",
+	Long: `Read a CSV report exported from the Common CA Database (such as the
+all certificate records report) and match its rows to the certificates in
+the database by SHA-256 fingerprint. The command reports:
+
+  - the intermediates in the int release (the latest, unless -r is
+    given) that CCADB marks revoked or parent-revoked;
+  - the unrevoked, unexpired intermediates disclosed to CCADB that aren't
+    in the database at all.
+
+With --record, revocations are recorded for the revoked intermediates,
+with the mechanism 'ccadb', CCADB's revocation reason (or status), and
+its revocation date (or now, if it gives none). Certificates that are
+already revoked are left alone, as are certificates sharing their key
+with another certificate, such as cross-signs, since recording their
+revocation would revoke the others too.
+
+Examples:
+
+	$ cfssl-trust ccadb AllCertificateRecordsReport.csv
+	$ cfssl-trust -r 2025.2.0 ccadb --record AllCertificateRecordsReport.csv
+`,
+	Run: reconcileCCADB,
+}
+
+func init() {
+	ccadbCmd.Flags().BoolVar(&ccadbRecord, "record", false, "record revocations for the intermediates CCADB marks revoked")
+	rootCmd.AddCommand(ccadbCmd)
+}
+
+func writeCCADBReport(w io.Writer, report *ccadb.Report) error {
+	_, err := fmt.Fprintf(w, "%d CCADB records, %d matching certificates in int %s\n",
+		report.Records, report.Matched, report.Release.Version)
+	if err != nil {
+		return err
+	}
+
+	if len(report.Revoked) > 0 {
+		_, err = fmt.Fprintln(w, "Marked revoked in CCADB:")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, match := range report.Revoked {
+		line := fmt.Sprintf("\t- SKI=%s, subject='%s': %s", match.Certificate.SKI,
+			match.Certificate.Subject, match.Record.RevocationStatus)
+		if match.Record.RevokedAt != nil {
+			line += " as of " + match.Record.RevokedAt.Format(common.DateFormat)
+		}
+		if match.Recorded {
+			line += " (recorded)"
+		} else if match.Skipped != "" {
+			line += " (skipped: " + match.Skipped + ")"
+		}
+
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(report.Missing) > 0 {
+		_, err = fmt.Fprintln(w, "Disclosed intermediates missing from the database:")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rec := range report.Missing {
+		constrained := ""
+		if rec.TechnicallyConstrained {
+			constrained = " (technically constrained)"
+		}
+
+		_, err = fmt.Fprintf(w, "\t- %s: '%s', SHA-256 %s%s\n", rec.Owner, rec.Name, rec.Fingerprint, constrained)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reconcileCCADB(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'ccadb' requires the path to a CCADB CSV report.")
+		os.Exit(1)
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	records, err := ccadb.ParseCSV(in)
+	in.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s: %s\n", args[0], err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var rel *certdb.Release
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, "int")
+	} else {
+		rel, err = certdb.FetchRelease(db, "int", bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	report, err := ccadb.Reconcile(tx, records, rel, time.Now(), ccadbRecord)
+	cleanup(tx, db, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeCCADBReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/platform"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var chainMetadata string
+
+var chainCmd = &cobra.Command{
+	Use:   "chain <leaf.pem>",
+	Short: "Build the chains for a leaf certificate against a release.",
+	Long: `Build every valid chain for a leaf certificate (the first certificate
+in the file) using the intermediates in an int release (the latest,
+unless -r is given) and the roots in the matching ca release, as for
+'verify-chains'. Revoked certificates are left out, as are chains whose
+root is distrusted for certificates issued as late as the leaf.
+
+Chains are ranked as CFSSL's bundler ranks them: by the ubiquity of their
+hash algorithms, then by their cross-platform ubiquity score against the
+platforms in ca-bundle.crt.metadata (--metadata), then by expiry. If no
+chain can be built, the command explains where the chain breaks off and
+exits with a non-zero status.
+
+Example:
+
+	$ cfssl-trust -r 2025.2.0 chain leaf.pem
+`,
+	Run: buildChains,
+}
+
+func init() {
+	chainCmd.Flags().StringVar(&chainMetadata, "metadata", "ca-bundle.crt.metadata", "metadata listing the platforms chains are scored against")
+	rootCmd.AddCommand(chainCmd)
+}
+
+func writeBuild(w io.Writer, build *chain.Build) error {
+	_, err := fmt.Fprintf(w, "Chains for '%s' (SKI=%s) against int %s and ca %s:\n",
+		build.Leaf.Subject, build.Leaf.SKI, build.Intermediates.Version, build.Roots.Version)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range build.Chains {
+		_, err = fmt.Fprintf(w, "%d. score %d, expires %s\n", i+1, c.Score, c.Expires.Format(common.DateFormat))
+		if err != nil {
+			return err
+		}
+
+		for _, cert := range c.Certificates {
+			_, err = fmt.Fprintf(w, "\t- SKI=%s, subject='%s'\n", cert.SKI, cert.Subject)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, problem := range build.Problems {
+		_, err = fmt.Fprintf(w, "! %s\n", problem)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%d chains built.\n", len(build.Chains))
+	return err
+}
+
+func buildChains(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'chain' requires the path to a leaf certificate.")
+		os.Exit(1)
+	}
+
+	in, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	certs, err := helpers.ParseCertificatesPEM(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	} else if len(certs) == 0 {
+		fmt.Fprintf(os.Stderr, "[!] No certificates found in %s.\n", args[0])
+		os.Exit(1)
+	}
+
+	if chainMetadata != "" {
+		err = platform.LoadPlatforms(chainMetadata)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var intRel *certdb.Release
+	if bundleRelease == "" {
+		intRel, err = certdb.LatestRelease(db, "int")
+	} else {
+		intRel, err = certdb.FetchRelease(db, "int", bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	caRel, err := chain.MatchingRelease(db, intRel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	build, err := chain.BuildChains(tx, certs[0], intRel, caRel, time.Now())
+	tx.Rollback()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(build, func(w io.Writer) error {
+		return writeBuild(w, build)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(build.Chains) == 0 {
+		os.Exit(1)
+	}
+}
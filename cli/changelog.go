@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/changelog"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var changelogWindow string
+
+var changelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Generate release notes.",
+	Long: `Generate release notes for the ca and int bundles, listing the
+certificates added and removed with their subjects, SKIs, serial numbers,
+expiry dates, and any recorded revocations.
+
+Given a single release, the release notes cover the changes since the
+previous release of each bundle; given two releases, they cover the
+changes between them, leaving out a bundle that lacks the earlier
+release. If no release is given, the latest ca release is
+used. As with 'diff', pass the expiration window the releases were
+rolled with to --window.
+
+The release notes are written as Markdown by default, or as JSON or
+YAML with --output.
+
+Examples:
+
+	$ cfssl-trust changelog 2024.4.1
+	$ cfssl-trust changelog --output json 2024.3.0 2024.4.1
+`,
+	Run: showChangelog,
+}
+
+func init() {
+	changelogCmd.Flags().StringVar(&changelogWindow, "window", "0h", "expiration window used when rolling the releases")
+	rootCmd.AddCommand(changelogCmd)
+}
+
+func showChangelog(cmd *cobra.Command, args []string) {
+	for _, version := range args {
+		if _, err := release.Parse(version); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] Invalid release '%s'.\n", version)
+			fmt.Fprintf(os.Stderr, "\tReason: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	window, err := time.ParseDuration(changelogWindow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var from, to string
+	switch len(args) {
+	case 0:
+		latest, err := certdb.LatestRelease(db, "ca")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+		to = latest.Version
+	case 1:
+		to = args[0]
+	case 2:
+		from, to = args[0], args[1]
+	default:
+		fmt.Fprintln(os.Stderr, "[!] Too many arguments passed to 'changelog'.")
+		os.Exit(1)
+	}
+
+	cl, err := changelog.New(db, from, to, window)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(cl, cl.WriteMarkdown)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
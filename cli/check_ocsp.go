@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/revocation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ocspTimeout string
+
+var checkOCSPCmd = &cobra.Command{
+	Use:   "check-ocsp",
+	Short: "Check the OCSP status of the intermediates in a release.",
+	Long: `Check the status of each intermediate in an int release (the latest,
+unless -r is given) that has an OCSP URL with its responder. Requests are
+built with the intermediate's issuer from the database, and the responses
+must be signed by the issuer (or a responder it delegated OCSP signing
+to) and current.
+
+Intermediates the responder reports revoked are recorded in the database
+with the mechanism 'ocsp', the response's revocation reason, and its
+revocation date, so that the next release roll skips them. Certificates
+that are already revoked are left alone, as are cross-signs and other
+certificates sharing their key with another certificate, since recording
+their revocation would exclude the others too. The command exits with a
+non-zero status if any check fails.
+
+The same check can be made before a release is rolled with
+'release --check-ocsp'.
+
+Example:
+
+	$ cfssl-trust -r 2025.2.0 check-ocsp
+`,
+	Run: checkOCSP,
+}
+
+func init() {
+	checkOCSPCmd.Flags().StringVar(&ocspTimeout, "timeout", "10s", "timeout for each OCSP request")
+	rootCmd.AddCommand(checkOCSPCmd)
+}
+
+// runOCSPChecks checks the OCSP status of the certificates in the
+// release, recording any revocations.
+func runOCSPChecks(db *sql.DB, rel *certdb.Release) (*revocation.OCSPReport, error) {
+	timeout, err := time.ParseDuration(ocspTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := revocation.CheckOCSP(tx, &http.Client{Timeout: timeout}, certs, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return report, tx.Commit()
+}
+
+func writeOCSPReport(w io.Writer, report *revocation.OCSPReport) error {
+	for _, result := range report.Checks {
+		if result.Status == revocation.StatusGood {
+			continue
+		}
+
+		line := fmt.Sprintf("%s SKI=%s, subject='%s'", result.Status,
+			result.Certificate.SKI, result.Certificate.Subject)
+		if result.Status == revocation.StatusRevoked {
+			line += fmt.Sprintf(": %s as of %s", result.Reason,
+				result.RevokedAt.Format(common.DateFormat))
+		}
+		if result.Error != "" {
+			line += " (" + result.Error + ")"
+		}
+
+		_, err := fmt.Fprintf(w, "%s\n", line)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d certificates checked: %d good, %d revoked, %d unknown, %d failed\n",
+		report.Checked, report.Good, report.Revoked, report.Unknown, report.Failed)
+	return err
+}
+
+func checkOCSP(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'check-ocsp' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var rel *certdb.Release
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, "int")
+	} else {
+		rel, err = certdb.FetchRelease(db, "int", bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	report, err := runOCSPChecks(db, rel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeOCSPReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
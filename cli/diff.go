@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var diffWindow string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes between two releases.",
+	Long: `Show the certificates added to and removed from a bundle between two
+releases. Each removed certificate is classified using the same rules as
+'release': revoked, expired, not yet valid, or (if none of those apply)
+removed by hand. If the later release was rolled with an expiration
+window, pass the same window with --window so that certificates skipped
+as expiring are classified as expired.
+
+Examples:
+
+	$ cfssl-trust -b ca diff 2024.3.0 2024.4.1
+	$ cfssl-trust -b int diff --window 504h --output json 2024.3.0 2024.4.1
+`,
+	Run: showDiff,
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffWindow, "window", "0h", "expiration window used when rolling the later release")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func writeDiff(w io.Writer, d *diff.Diff) error {
+	_, err := fmt.Fprintf(w, "Changes in the %s bundle from %s to %s:\n", d.Bundle, d.From, d.To)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%d certificates added:\n", len(d.Added))
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range d.Added {
+		_, err = fmt.Fprintf(w, "\t+ SKI=%s, serial=%s, subject='%s'\n",
+			cert.SKI, cert.Serial, cert.Subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%d certificates removed:\n", len(d.Removed))
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range d.Removed {
+		_, err = fmt.Fprintf(w, "\t- %s: SKI=%s, serial=%s, subject='%s'\n",
+			cert.Reason, cert.SKI, cert.Serial, cert.Subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func showDiff(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "[!] 'diff' requires two releases.")
+		os.Exit(1)
+	}
+
+	for _, version := range args {
+		if _, err := release.Parse(version); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] Invalid release '%s'.\n", version)
+			fmt.Fprintf(os.Stderr, "\tReason: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	window, err := time.ParseDuration(diffWindow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer tx.Rollback()
+
+	d, err := diff.Releases(tx, bundle, args[0], args[1], window)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(d, func(w io.Writer) error {
+		return writeDiff(w, d)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	distrustSerial string
+	distrustAfter  string
+	distrustReason string
+	distrustClear  bool
+)
+
+var distrustCmd = &cobra.Command{
+	Use:   "distrust",
+	Short: "Record a partial distrust date for a certificate in a release.",
+	Long: `Record that certificates issued under the certificate with the given SKI
+after a date are no longer trusted, while those issued before it still
+are. This is how root programs phase out a CA: unlike a revocation, the
+certificate stays in the release, and the distrust date is carried into
+the releases rolled from it.
+
+The distrust is recorded in the release given by -r, or the latest
+release of the bundle. Dates may be given as YYYY-MM-DD or as a full
+timestamp (e.g. 2017-03-22T21:24:00+0000). Passing --clear removes the
+distrust date, trusting the certificate fully again.
+
+The distrust date is shown by 'info', written to the manifest and go
+bundle formats, and decides whether the certificate is left out of PEM
+bundles (see 'bundle').
+
+Examples:
+
+	$ cfssl-trust -b ca -r 2025.2.0 distrust --after 2024-11-30 \
+		--reason "CA phased out" 5673586495f9921ab0122a046279a14015882149
+	$ cfssl-trust -b ca distrust --clear 5673586495f9921ab0122a046279a14015882149
+`,
+	Run: distrust,
+}
+
+func init() {
+	distrustCmd.Flags().StringVarP(&distrustSerial, "serial", "s", "", "serial number of the certificate (hex)")
+	distrustCmd.Flags().StringVar(&distrustAfter, "after", "", "date after which issued certificates are distrusted")
+	distrustCmd.Flags().StringVar(&distrustReason, "reason", "", "reason for the distrust")
+	distrustCmd.Flags().BoolVar(&distrustClear, "clear", false, "remove the distrust date")
+	rootCmd.AddCommand(distrustCmd)
+}
+
+func distrust(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'distrust' requires a single SKI.")
+		os.Exit(1)
+	}
+
+	if (distrustAfter == "") == !distrustClear {
+		fmt.Fprintln(os.Stderr, "[!] 'distrust' requires exactly one of --after or --clear.")
+		os.Exit(1)
+	}
+
+	var after int64
+	if distrustAfter != "" {
+		when, err := common.ParseDate(distrustAfter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+		after = when.Unix()
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	cert, err := lookupCertificate(db, args[0], distrustSerial)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var rel *certdb.Release
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(db, bundle, bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	cr := certdb.NewCertificateRelease(cert, rel)
+	changed := true
+	if distrustClear {
+		err = cr.ClearDistrust(tx)
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("certificate %s isn't distrusted in %s release %s", cert.SKI, rel.Bundle, rel.Version)
+		}
+	} else {
+		changed, err = cr.SetDistrust(tx, after, distrustReason)
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("certificate %s isn't in %s release %s", cert.SKI, rel.Bundle, rel.Version)
+		}
+	}
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case distrustClear:
+		fmt.Printf("Distrust for certificate %s removed from %s release %s.\n", cert.SKI, rel.Bundle, rel.Version)
+	case !changed:
+		fmt.Printf("Certificate %s was already distrusted after %s in %s release %s.\n", cert.SKI,
+			time.Unix(after, 0).UTC().Format(common.DateFormat), rel.Bundle, rel.Version)
+	default:
+		fmt.Printf("Certificate %s distrusted after %s in %s release %s.\n", cert.SKI,
+			time.Unix(after, 0).UTC().Format(common.DateFormat), rel.Bundle, rel.Version)
+	}
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/cloudflare/cfssl_trust/dump"
@@ -21,6 +22,13 @@ func init() {
 	rootCmd.AddCommand(dumpCmd)
 }
 
+// dumpedCertificates is the structured form of the dump output; PEM
+// holds every certificate with the SKI.
+type dumpedCertificates struct {
+	SKI string `json:"ski" yaml:"ski"`
+	PEM string `json:"pem" yaml:"pem"`
+}
+
 func dumper(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		os.Exit(0)
@@ -51,13 +59,29 @@ func dumper(cmd *cobra.Command, args []string) {
 		}
 	}()
 
+	var dumped []*dumpedCertificates
 	for _, ski := range args {
-		cert, err := dump.CertPEM(tx, ski)
+		var cert []byte
+		cert, err = dump.CertPEM(tx, ski)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Println(string(cert))
+		dumped = append(dumped, &dumpedCertificates{SKI: ski, PEM: string(cert)})
+	}
+
+	err = writeOutput(dumped, func(w io.Writer) error {
+		for _, d := range dumped {
+			_, err := fmt.Fprintln(w, d.PEM)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
 	}
 }
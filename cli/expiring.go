@@ -3,11 +3,13 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
 	"time"
 
 	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/info"
 	"github.com/cloudflare/cfssl_trust/model/certdb"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,63 +27,29 @@ func init() {
 	rootCmd.AddCommand(expiringCmd)
 }
 
-func showExpiredCert(cert *certdb.Certificate, reason string) {
+func showExpiredCert(w io.Writer, cert *certdb.Certificate, reason string) error {
 	serial := big.NewInt(0)
 	serial.SetBytes(cert.Serial)
-	fmt.Printf("%s (SKI=%s, serial=%s, subject='%s')\n", reason, cert.SKI, serial, common.NameToString(cert.X509().Subject))
+	_, err := fmt.Fprintf(w, "%s (SKI=%s, serial=%s, subject='%s')\n", reason, cert.SKI, serial, common.NameToString(cert.X509().Subject))
+	return err
 }
 
-func scanBundleForExpirations(db *sql.DB, window time.Duration) (expired int, revoked int, err error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return expired, revoked, err
-	}
-	defer tx.Rollback()
-
-	rel := &certdb.Release{
-		Bundle:  bundle,
-		Version: bundleRelease,
-	}
-
-	err = rel.Select(tx)
-	if err != nil {
-		return expired, revoked, err
-	}
-
-	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
-	if err != nil {
-		return expired, revoked, err
-	}
-
-	expiresAt := time.Now().Add(window)
-	for _, cert := range certs {
-		if isRevoked, err := cert.Revoked(tx, rel.ReleasedAt); err != nil {
-			return expired, revoked, err
-		} else if isRevoked {
-			showExpiredCert(cert, "revoked certificate")
-			revoked++
-			continue
-		}
-
-		if cert.NotAfter <= expiresAt.Unix() {
-			showExpiredCert(cert, "expired certificate")
-			expired++
-			continue
-		}
-
-		if cert.NotBefore > rel.ReleasedAt {
-			showExpiredCert(cert, "certificate that isn't valid at the time of release")
-			expired++
-			continue
+func writeExpiringReport(w io.Writer, report *info.ExpiringReport) error {
+	for _, expiring := range report.Certificates {
+		err := showExpiredCert(w, expiring.Cert, skipReasons[expiring.Reason])
+		if err != nil {
+			return err
 		}
 	}
 
-	err = tx.Commit()
+	_, err := fmt.Fprintln(w, "Release:", report.Release.Bundle, report.Release.Version)
 	if err != nil {
-		return expired, revoked, err
+		return err
 	}
 
-	return expired, revoked, err
+	_, err = fmt.Fprintf(w, "%d certificates expiring.\n%d certificates revoked.\n",
+		report.Expired, report.Revoked)
+	return err
 }
 
 func expiring(cmd *cobra.Command, args []string) {
@@ -92,15 +60,6 @@ func expiring(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	if bundleRelease == "" {
-		latest, err := certdb.LatestRelease(db, bundle)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
-			os.Exit(1)
-		}
-		bundleRelease = latest.Version
-	}
-
 	window := 30 * 24 * time.Hour
 	if len(args) > 0 {
 		window, err = time.ParseDuration(args[0])
@@ -110,13 +69,17 @@ func expiring(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	expired, revoked, err := scanBundleForExpirations(db, window)
+	report, err := info.Expiring(db, bundle, bundleRelease, window)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Release:", bundle, bundleRelease)
-	fmt.Printf("%d certificates expiring.\n%d certificates revoked.\n",
-		expired, revoked)
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeExpiringReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/aia"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	fetchAIATimeout string
+	fetchAIAImport  bool
+)
+
+var fetchAIACmd = &cobra.Command{
+	Use:   "fetch-aia",
+	Short: "Download missing issuers from their AIA CA Issuers URLs.",
+	Long: `Find the certificates in the database whose issuer isn't in the
+database, and download the issuers from the CA Issuers URLs recorded when
+the certificates were imported. Responses may be DER or PEM certificates,
+or PKCS #7 bundles. Only CA certificates whose signature on a certificate
+they issued verifies are kept.
+
+The fetched issuers are staged in a PEM file (aia-intermediates.pem, unless
+another path is given) for 'publish --intermediates' or 'import'; with
+--import, they are imported into the int release given with -r instead.
+
+Examples:
+
+	$ cfssl-trust fetch-aia new-intermediates.pem
+	$ cfssl-trust -r 2025.2.0 fetch-aia --import
+`,
+	Run: fetchAIA,
+}
+
+func init() {
+	fetchAIACmd.Flags().StringVar(&fetchAIATimeout, "timeout", "10s", "timeout for each download")
+	fetchAIACmd.Flags().BoolVar(&fetchAIAImport, "import", false, "import the issuers into the int release instead of staging them")
+	rootCmd.AddCommand(fetchAIACmd)
+}
+
+func writeAIAReport(w io.Writer, report *aia.Report) error {
+	for _, issuer := range report.Issuers {
+		if issuer.Error != "" {
+			_, err := fmt.Fprintf(w, "! issuer %s of %d certificates (%s): %s\n",
+				issuer.SKI, len(issuer.Certificates), issuer.URL, issuer.Error)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, cert := range issuer.Fetched {
+			_, err := fmt.Fprintf(w, "+ fetched SKI=%s, serial=%s, subject='%s' from %s\n",
+				cert.SKI, cert.Serial, cert.Subject, issuer.URL)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d issuers missing.\n%d issuers fetched.\n", report.Missing, report.Fetched)
+	return err
+}
+
+func fetchAIA(cmd *cobra.Command, args []string) {
+	staging := "aia-intermediates.pem"
+	switch {
+	case len(args) > 1:
+		fmt.Fprintln(os.Stderr, "[!] 'fetch-aia' takes at most the path to stage the issuers in.")
+		os.Exit(1)
+	case len(args) == 1 && fetchAIAImport:
+		fmt.Fprintln(os.Stderr, "[!] Issuers are either staged or imported, not both.")
+		os.Exit(1)
+	case len(args) == 1:
+		staging = args[0]
+	}
+
+	if fetchAIAImport && bundleRelease == "" {
+		fmt.Fprintln(os.Stderr, "[!] Importing the issuers requires an int release (pass -r).")
+		os.Exit(1)
+	}
+
+	timeout, err := time.ParseDuration(fetchAIATimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	report, err := aia.FetchMissing(tx, client, time.Now().Unix())
+	if err != nil {
+		cleanup(tx, db, err)
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeAIAReport(w, report)
+	})
+	if err != nil {
+		cleanup(tx, db, err)
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(report.Staged) == 0 {
+		cleanup(tx, db, nil)
+		return
+	}
+
+	if !fetchAIAImport {
+		err = ioutil.WriteFile(staging, helpers.EncodeCertificatesPEM(report.Staged), 0644)
+		cleanup(tx, db, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Staged %d issuers in %s.\n", len(report.Staged), staging)
+		return
+	}
+
+	rel, err := certdb.NewRelease("int", bundleRelease)
+	if err == nil {
+		_, err = certdb.Ensure(rel, tx)
+	}
+
+	for _, cert := range report.Staged {
+		if err != nil {
+			break
+		}
+		_, _, err = certdb.Import(tx, cert, rel)
+	}
+
+	cleanup(tx, db, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d issuers into int release %s.\n", len(report.Staged), bundleRelease)
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var graphAll bool
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Export the issuer graph of a release.",
+	Long: `Build the issuer graph of a release (the latest release of the bundle,
+unless -r is given) or, with --all, of every certificate in the database.
+Graphs of int releases include the roots of the matching ca release, as
+for 'verify-chains'. Certificates are linked to their issuers by AKI and
+SKI, and every signature is verified.
+
+The graph is written in Graphviz's DOT language, or as JSON or YAML with
+--output. Roots, cross-signed certificates (those sharing a key with a
+certificate from another issuer), certificates sharing a key, and expired
+or revoked certificates are marked.
+
+Examples:
+
+	$ cfssl-trust -b int -r 2025.2.0 graph | dot -Tsvg > int.svg
+	$ cfssl-trust graph --all --output json
+`,
+	Run: showGraph,
+}
+
+func init() {
+	graphCmd.Flags().BoolVar(&graphAll, "all", false, "graph every certificate in the database")
+	rootCmd.AddCommand(graphCmd)
+}
+
+// graphReleases returns the releases to graph: the selected release
+// and, for int releases, the matching ca release. It returns nothing
+// with --all.
+func graphReleases(db *sql.DB) ([]*certdb.Release, error) {
+	if graphAll {
+		return nil, nil
+	}
+
+	var rel *certdb.Release
+	var err error
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(db, bundle, bundleRelease)
+	}
+	if err != nil || rel.Bundle != "int" {
+		return []*certdb.Release{rel}, err
+	}
+
+	caRel, err := chain.MatchingRelease(db, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*certdb.Release{caRel, rel}, nil
+}
+
+// graphCertificates collects the certificates in the releases, or
+// every certificate in the database if there are none.
+func graphCertificates(tx *sql.Tx, releases []*certdb.Release) ([]*certdb.Certificate, error) {
+	if len(releases) == 0 {
+		return certdb.AllCertificates(tx)
+	}
+
+	var certs []*certdb.Certificate
+	seen := map[string]bool{}
+	for _, rel := range releases {
+		relCerts, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		// A certificate may be in both the ca and int releases.
+		for _, cert := range relCerts {
+			key := cert.SKI + ":" + string(cert.Serial)
+			if !seen[key] {
+				seen[key] = true
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	return certs, nil
+}
+
+func showGraph(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'graph' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	if graphAll && bundleRelease != "" {
+		fmt.Fprintln(os.Stderr, "[!] --all graphs the whole database; don't select a release.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	releases, err := graphReleases(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var graph *chain.Graph
+	certs, err := graphCertificates(tx, releases)
+	if err == nil {
+		graph, err = chain.BuildGraph(tx, certs, time.Now().Unix())
+	}
+	tx.Rollback()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(graph, graph.WriteDOT)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -6,55 +6,83 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/lint"
 	"github.com/cloudflare/cfssl_trust/model/certdb"
 	_ "github.com/mattn/go-sqlite3" // load sql driver
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var (
+	importPurposes []string
+	importForce    bool
+)
+
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Import certificates into the database.",
-	Long:  "Import certificates into the database, marking them under a release as needed.",
-	Run:   importer,
+	Long: `Import certificates into the database, marking them under a release as needed.
+
+By default, certificates are trusted for every purpose in the release.
+The --purpose flag restricts them to the given purposes (serverAuth,
+clientAuth, emailProtection, codeSigning, timeStamping or OCSPSigning);
+it may be repeated or given a comma-separated list.
+
+Certificates are linted for the bundle before anything is imported, as
+with 'lint'. Any findings are printed, and nothing is imported if a
+certificate has errors, unless --force is given.
+
+Example:
+
+	$ cfssl-trust -b ca -r 2025.2.0 import --purpose serverAuth,emailProtection roots.pem
+`,
+	Run: importer,
 }
 
 func init() {
+	importCmd.Flags().StringSliceVar(&importPurposes, "purpose", nil, "purposes the certificates are trusted for in the release")
+	importCmd.Flags().BoolVar(&importForce, "force", false, "import certificates even if linting finds errors")
 	rootCmd.AddCommand(importCmd)
 }
 
-func importCertificate(tx *sql.Tx, cert *x509.Certificate, rel *certdb.Release) error {
+func importCertificate(tx *sql.Tx, cert *x509.Certificate, rel *certdb.Release, purposes []string) error {
 	fmt.Printf("- importing serial %s SKI %x\n", cert.SerialNumber, cert.SubjectKeyId)
-	c := certdb.NewCertificate(cert)
-	_, err := certdb.Ensure(c, tx)
-	if err != nil {
+	c, _, err := certdb.Import(tx, cert, rel)
+	if err != nil || len(purposes) == 0 {
 		return err
 	}
 
-	aia := certdb.NewAIA(c)
-	if aia != nil {
-		_, err = certdb.Ensure(aia, tx)
-		if err != nil {
-			return err
-		}
-	}
+	_, err = certdb.NewCertificateRelease(c, rel).SetPurposes(tx, purposes)
+	return err
+}
 
-	// The rest of the function deals with inserting the
-	// certificate into the relevant release table. The assumption
-	// here is that the release exists in the DB.
-	if rel == nil {
-		return nil
+// lintImports lints the certificates for the bundle, printing any
+// findings, and returns the number of certificates with errors.
+func lintImports(certs []*x509.Certificate) (int, error) {
+	var results []*lint.Result
+	for _, cert := range certs {
+		result := lint.Certificate(cert, bundle, time.Now())
+		if len(result.Findings) > 0 {
+			results = append(results, result)
+		}
 	}
 
-	cr := certdb.NewCertificateRelease(c, rel)
-	_, err = certdb.Ensure(cr, tx)
-	return err
-
+	return lintErrors(results), writeLintResults(os.Stderr, results)
 }
 
 func importer(cmd *cobra.Command, args []string) {
+	purposes, err := certdb.ParsePurposes(importPurposes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	} else if len(purposes) > 0 && bundleRelease == "" {
+		fmt.Fprintln(os.Stderr, "[!] Purposes can only be set when importing into a release (pass -r).")
+		os.Exit(1)
+	}
+
 	dbPath := viper.GetString("database.path")
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -96,6 +124,7 @@ func importer(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	var certs []*x509.Certificate
 	for _, path := range args {
 		fileContents, err := ioutil.ReadFile(path)
 		if err != nil {
@@ -103,18 +132,28 @@ func importer(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 
-		certs, err := helpers.ParseCertificatesPEM(fileContents)
+		fileCerts, err := helpers.ParseCertificatesPEM(fileContents)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 			os.Exit(1)
 		}
+		certs = append(certs, fileCerts...)
+	}
 
-		for _, x509Cert := range certs {
-			err := importCertificate(tx, x509Cert, rel)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[!] %s\n", err)
-				os.Exit(1)
-			}
+	failed, err := lintImports(certs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	} else if failed > 0 && !importForce {
+		fmt.Fprintf(os.Stderr, "[!] %d certificates failed linting; pass --force to import them anyway.\n", failed)
+		os.Exit(1)
+	}
+
+	for _, x509Cert := range certs {
+		err := importCertificate(tx, x509Cert, rel, purposes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
 		}
 	}
 
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/nss"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importNSSCmd = &cobra.Command{
+	Use:   "import-nss",
+	Short: "Import certificates and trust from NSS's certdata.txt.",
+	Long: `Import the certificates in a local copy of Mozilla's certdata.txt,
+recording the trust NSS assigns to each of them: the trust for server
+authentication, email protection, and code signing, and any dates after
+which certificates they issue are distrusted. Trust records for
+certificates that certdata.txt doesn't include, such as explicitly
+distrusted intermediates, are recorded against the matching certificate
+in the database if there is one.
+
+If a release is given, the certificates NSS trusts as roots are added to
+it; the release must be a ca release. Distrusted certificates are stored
+but never added to a release.
+
+Example:
+
+	$ cfssl-trust -b ca -r 2025.2.0 import-nss certdata.txt
+`,
+	Run: importNSS,
+}
+
+func init() {
+	rootCmd.AddCommand(importNSSCmd)
+}
+
+// describeTrust summarises the trust for an entry.
+func describeTrust(e *nss.Entry) string {
+	desc := fmt.Sprintf("server-auth %s, email-protection %s, code-signing %s",
+		e.ServerAuth, e.EmailProtection, e.CodeSigning)
+	if !e.ServerDistrustAfter.IsZero() {
+		desc += ", server-auth distrusted after " + e.ServerDistrustAfter.UTC().Format(common.DateFormat)
+	}
+	if !e.EmailDistrustAfter.IsZero() {
+		desc += ", email-protection distrusted after " + e.EmailDistrustAfter.UTC().Format(common.DateFormat)
+	}
+	return desc
+}
+
+func importNSS(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'import-nss' requires the path to certdata.txt.")
+		os.Exit(1)
+	}
+
+	if bundleRelease != "" && bundle != "ca" {
+		fmt.Fprintln(os.Stderr, "[!] NSS roots can only be added to a ca release (pass -b ca).")
+		os.Exit(1)
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := nss.Parse(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var rel *certdb.Release
+	if bundleRelease != "" {
+		rel, err = certdb.NewRelease(bundle, bundleRelease)
+		if err == nil {
+			_, err = certdb.Ensure(rel, tx)
+		}
+	}
+
+	var imported []*nss.Imported
+	if err == nil {
+		imported, err = nss.Import(tx, entries, rel)
+	}
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var anchors, added, changed, skipped int
+	for _, result := range imported {
+		e := result.Entry
+		if result.Certificate == nil {
+			skipped++
+			fmt.Printf("- skipping \"%s\" (serial %x): no matching certificate in the database\n", e.Label, e.Serial)
+			continue
+		}
+
+		action := "unchanged"
+		if result.Changed {
+			action = "recorded"
+			changed++
+		}
+
+		if e.TrustAnchor() {
+			anchors++
+		}
+		if result.Added {
+			added++
+		}
+
+		fmt.Printf("- %s \"%s\" SKI %s: %s\n", action, e.Label, result.Certificate.SKI, describeTrust(e))
+	}
+
+	summary := []string{
+		fmt.Sprintf("%d entries", len(imported)),
+		fmt.Sprintf("%d trusted roots", anchors),
+		fmt.Sprintf("%d trust changes", changed),
+	}
+	if rel != nil {
+		summary = append(summary, fmt.Sprintf("%d added to %s-%s", added, rel.Bundle, rel.Version))
+	}
+	if skipped > 0 {
+		summary = append(summary, fmt.Sprintf("%d skipped", skipped))
+	}
+	fmt.Printf("Imported %s.\n", strings.Join(summary, ", "))
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/platform"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importPlatformsCmd = &cobra.Command{
+	Use:   "import-platforms",
+	Short: "Record which platform trust stores contain each certificate.",
+	Long: `Read the keystores listed in ca-bundle.crt.metadata (by default, the one
+in the current directory) and record, for each certificate in the
+database, the platform trust stores that contain it. Platforms are named
+after their keystore, e.g. nss for certdata/trusted_roots/nss.pem.
+
+Certificates in a keystore that aren't in the database are counted but
+not imported. Records for certificates that have been dropped from a
+keystore are removed, so the command can be re-run whenever the
+keystores are updated.
+
+The platforms are shown by 'info', and can be searched for with the
+platform: search term.
+
+Example:
+
+	$ cfssl-trust import-platforms ca-bundle.crt.metadata
+`,
+	Run: importPlatforms,
+}
+
+func init() {
+	rootCmd.AddCommand(importPlatformsCmd)
+}
+
+func importPlatforms(cmd *cobra.Command, args []string) {
+	metadata := "ca-bundle.crt.metadata"
+	switch len(args) {
+	case 0:
+	case 1:
+		metadata = args[0]
+	default:
+		fmt.Fprintln(os.Stderr, "[!] 'import-platforms' takes at most the path to ca-bundle.crt.metadata.")
+		os.Exit(1)
+	}
+
+	keystores, err := platform.LoadMetadata(metadata)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	results, err := platform.Import(tx, keystores)
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, result := range results {
+		fmt.Printf("%s (%s): %d certificates, %d recorded, %d removed, %d not in the database.\n",
+			result.Platform, strings.Join(result.Names, ", "), result.Total,
+			len(result.Added), len(result.Removed), result.Unknown)
+		for _, src := range result.Removed {
+			fmt.Printf("- removed SKI %s serial %x\n", src.SKI, src.Serial)
+		}
+	}
+}
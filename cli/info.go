@@ -3,6 +3,7 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/cloudflare/cfssl_trust/info"
@@ -22,15 +23,23 @@ func init() {
 	rootCmd.AddCommand(infoCmd)
 }
 
-func showInfoForCertificates(db *sql.DB, certs []*certdb.Certificate) error {
+func loadCertificateMetadata(db *sql.DB, certs []*certdb.Certificate) ([]*info.CertificateMetadata, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	metadata := make([]*info.CertificateMetadata, 0, len(certs))
 	for _, cert := range certs {
-		err := info.WriteCertificateInformation(os.Stdout, db, cert)
+		cm, err := info.LoadCertificateMetadata(tx, cert)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		metadata = append(metadata, cm)
 	}
 
-	return nil
+	return metadata, tx.Commit()
 }
 
 func showInfo(cmd *cobra.Command, args []string) {
@@ -45,17 +54,33 @@ func showInfo(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	var certs []*certdb.Certificate
 	for _, ski := range args {
-		certs, err := certdb.FindCertificateBySKI(db, ski)
+		found, err := certdb.FindCertificateBySKI(db, ski)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 			os.Exit(1)
 		}
+		certs = append(certs, found...)
+	}
 
-		err = showInfoForCertificates(db, certs)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
-			os.Exit(1)
+	metadata, err := loadCertificateMetadata(db, certs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(metadata, func(w io.Writer) error {
+		for _, cert := range certs {
+			err := info.WriteCertificateInformation(w, db, cert)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
 	}
 }
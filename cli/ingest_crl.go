@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/revocation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ingestCRLCmd = &cobra.Command{
+	Use:   "ingest-crl <file>...",
+	Short: "Record the revocations listed on CRLs.",
+	Long: `Read CRLs (DER, or one or more PEM-encoded CRLs per file), verify each
+CRL's signature against its issuer in the database, and revoke the
+certificates that issuer issued whose serial numbers are listed. The
+revocations are recorded with the mechanism 'crl', the CRL entry's reason
+code as the reason, and its revocation date as the effective date.
+
+Certificates that are already revoked are left alone; use 'revoke --amend'
+to change their revocation. Entries that only put a certificate on hold
+(certificateHold or removeFromCRL) aren't recorded. Revocations are
+recorded by SKI, so certificates that share their key with another
+certificate, such as cross-signs, are reported but not recorded; revoke
+them by hand if every certificate with the key should go.
+
+Example:
+
+	$ curl -so root.crl http://crl.example.com/root.crl
+	$ cfssl-trust ingest-crl root.crl
+`,
+	Run: ingestCRL,
+}
+
+func init() {
+	rootCmd.AddCommand(ingestCRLCmd)
+}
+
+func writeCRLReports(w io.Writer, reports []*revocation.CRLReport) error {
+	for _, report := range reports {
+		_, err := fmt.Fprintf(w, "CRL from '%s' (SKI=%s), updated %s: %d entries, %d certificates in the database\n",
+			report.Issuer.Subject, report.Issuer.SKI, report.ThisUpdate.Format(common.DateFormat),
+			report.Listed, len(report.Matched))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range report.Matched {
+			status := "revoked"
+			if !entry.Recorded {
+				status = "skipped: " + entry.Skipped
+			}
+
+			_, err = fmt.Fprintf(w, "\t- SKI=%s, subject='%s': %s as of %s (%s)\n",
+				entry.Certificate.SKI, entry.Certificate.Subject, entry.Reason,
+				entry.RevokedAt.Format(common.DateFormat), status)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ingestCRLFile ingests each of the CRLs in a file.
+func ingestCRLFile(tx *sql.Tx, path string) ([]*revocation.CRLReport, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	crls, err := revocation.ParseCRLs(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*revocation.CRLReport
+	for _, crl := range crls {
+		report, err := revocation.IngestCRL(tx, crl)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func ingestCRL(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'ingest-crl' requires at least one CRL file.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	reports := []*revocation.CRLReport{}
+	for _, path := range args {
+		var fileReports []*revocation.CRLReport
+		fileReports, err = ingestCRLFile(tx, path)
+		if err != nil {
+			err = fmt.Errorf("%s: %s", path, err)
+			break
+		}
+		reports = append(reports, fileReports...)
+	}
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(reports, func(w io.Writer) error {
+		return writeCRLReports(w, reports)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/lint"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the certificates in a release for problems.",
+	Long: `Lint the certificates in a release (the latest release of the bundle,
+unless -r is given). Every certificate must be a CA certificate allowed to
+sign certificates, with an RSA key of at least 2048 bits or a P-256 or
+P-384 key, a signature algorithm stronger than SHA-1, and a validity
+period covering the present. Roots must be self-signed. Weak signatures
+and missing basicConstraints extensions on self-signed roots, missing
+keyUsage extensions, and self-signed certificates in the int bundle are
+warnings; everything else is an error.
+
+The same checks are run by 'import', which refuses certificates with
+errors unless --force is given. The command exits with a non-zero status
+if any certificate has errors.
+
+Example:
+
+	$ cfssl-trust -b ca -r 2025.2.0 lint
+`,
+	Run: lintRelease,
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
+
+func writeLintResults(w io.Writer, results []*lint.Result) error {
+	for _, result := range results {
+		_, err := fmt.Fprintf(w, "SKI=%s, serial=%s, subject='%s':\n",
+			result.Certificate.SKI, result.Certificate.Serial, result.Certificate.Subject)
+		if err != nil {
+			return err
+		}
+
+		for _, finding := range result.Findings {
+			_, err = fmt.Fprintf(w, "\t%s: [%s] %s\n", finding.Severity, finding.Check, finding.Message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lintErrors counts the certificates with errors.
+func lintErrors(results []*lint.Result) int {
+	var count int
+	for _, result := range results {
+		if result.Errors() > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func lintRelease(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'lint' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var rel *certdb.Release
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(db, bundle, bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	results, err := lint.Release(tx, rel, time.Now())
+	tx.Rollback()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(results, func(w io.Writer) error {
+		return writeLintResults(w, results)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if lintErrors(results) > 0 {
+		os.Exit(1)
+	}
+}
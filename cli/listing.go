@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/publish"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var listingCmd = &cobra.Command{
+	Use:   "listing",
+	Short: "Write a human-readable listing of a release.",
+	Long: `Write a human-readable listing of every certificate in a release,
+including its subject and issuer, serial number, validity period, key and
+signature algorithms, SKI and AKI, fingerprints, and extensions. This is
+the listing written to certdata/ when a release is published. If no
+release is given with -r, the latest release of the bundle is listed.
+
+If PEM files are given, their certificates are listed instead.
+
+Examples:
+
+	$ cfssl-trust -b ca listing > certdata/ca-bundle.txt
+	$ cfssl-trust listing NEW_ROOTS.pem
+`,
+	Run: writeListing,
+}
+
+func init() {
+	rootCmd.AddCommand(listingCmd)
+}
+
+func listFiles(paths []string) error {
+	for _, path := range paths {
+		in, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		listing, err := info.ListBundle(filepath.Base(path), in)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(listing)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listRelease(db *sql.DB) error {
+	var rel *certdb.Release
+	var err error
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(db, bundle, bundleRelease)
+	}
+
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("release %s-%s doesn't exist", bundle, bundleRelease)
+	} else if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return err
+	}
+
+	return info.WriteListing(os.Stdout, publish.Files[rel.Bundle], certs)
+}
+
+func writeListing(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		err := listFiles(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	err = listRelease(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	logSKI    string
+	logSerial string
+	logSince  string
+	logUntil  string
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the audit log.",
+	Long: `Show the audit log of changes made to the database: imports, release
+rolls, revocations, and removals, along with who made them and when.
+
+Entries can be filtered by certificate (--ski, and optionally --serial),
+by release (-r), and by date (--since and --until, given as YYYY-MM-DD
+or as a full timestamp). The bundle (-b) is only used as a filter if it
+is given explicitly.
+
+Examples:
+
+	$ cfssl-trust log --ski 5673586495f9921ab0122a046279a14015882149
+	$ cfssl-trust -b ca -r 2017.2.0 log
+	$ cfssl-trust log --since 2017-01-01 --until 2017-02-01
+
+The actor recorded for changes defaults to the current user, and can be
+set with --actor; a note (such as a ticket reference) can be attached to
+changes with --note.
+`,
+	Run: showLog,
+}
+
+func init() {
+	logCmd.Flags().StringVar(&logSKI, "ski", "", "show entries for the certificate with this SKI")
+	logCmd.Flags().StringVarP(&logSerial, "serial", "s", "", "show entries for the certificate with this serial number (hex)")
+	logCmd.Flags().StringVar(&logSince, "since", "", "show entries logged on or after this date")
+	logCmd.Flags().StringVar(&logUntil, "until", "", "show entries logged on or before this date")
+	rootCmd.AddCommand(logCmd)
+}
+
+func parseLogFilter() (*certdb.AuditFilter, error) {
+	filter := &certdb.AuditFilter{
+		Release: bundleRelease,
+		SKI:     logSKI,
+	}
+
+	if rootCmd.PersistentFlags().Changed("bundle") {
+		filter.Bundle = bundle
+	}
+
+	var err error
+	if logSerial != "" {
+		filter.Serial, err = parseSerial(logSerial)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if logSince != "" {
+		since, err := common.ParseDate(logSince)
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = since.Unix()
+	}
+
+	if logUntil != "" {
+		until, err := common.ParseDate(logUntil)
+		if err != nil {
+			return nil, err
+		}
+		filter.Until = until.Unix()
+	}
+
+	return filter, nil
+}
+
+func writeAuditEntry(entry *certdb.AuditEntry) {
+	fmt.Printf("%s %s %s", time.Unix(entry.LoggedAt, 0).UTC().Format(common.DateFormat),
+		entry.Actor, entry.Operation)
+	if entry.Bundle != "" {
+		fmt.Printf(" bundle=%s", entry.Bundle)
+	}
+	if entry.Release != "" {
+		fmt.Printf(" release=%s", entry.Release)
+	}
+	if entry.SKI != "" {
+		fmt.Printf(" SKI=%s", entry.SKI)
+	}
+	if len(entry.Serial) > 0 {
+		fmt.Printf(" serial=%x", entry.Serial)
+	}
+	if entry.Note != "" {
+		fmt.Printf(" (%s)", entry.Note)
+	}
+	fmt.Println()
+}
+
+func showLog(cmd *cobra.Command, args []string) {
+	filter, err := parseLogFilter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer tx.Rollback()
+
+	entries, err := certdb.QueryAuditLog(tx, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, entry := range entries {
+		writeAuditEntry(entry)
+	}
+}
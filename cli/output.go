@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// outputFormat is the format read commands write their results in:
+// text for people, or json or yaml for scripts.
+var outputFormat string
+
+var outputFormats = map[string]bool{
+	"text": true,
+	"json": true,
+	"yaml": true,
+}
+
+// writeOutput writes v to standard output in the selected structured
+// format, or calls text to write it for people.
+func writeOutput(v interface{}, text func(w io.Writer) error) error {
+	switch outputFormat {
+	case "text":
+		return text(os.Stdout)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		return fmt.Errorf("unknown output format %s (valid formats are text|json|yaml)", outputFormat)
+	}
+}
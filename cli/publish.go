@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/publish"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	publishWindow        string
+	publishRoots         []string
+	publishIntermediates []string
+	publishDir           string
+	publishListings      bool
+	publishSkipUnchanged bool
+	publishSummary       string
+	publishForce         bool
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Roll and publish a new trust store release.",
+	Long: `Roll new int and ca releases from the latest releases, import any new
+roots and intermediates into them, and write out the ca-bundle.crt and
+int-bundle.crt bundles along with their certdata/*.txt listings.
+
+Both bundles are released under the same version, following the latest
+release of either. Certificates that have been revoked, or that expire
+within the --window, aren't carried over. The database changes are
+committed and the files moved into place only once every step has
+succeeded.
+
+New roots and intermediates are linted as by 'import', and nothing is
+published if any have errors unless --force is given.
+
+With --skip-unchanged, the release is abandoned if neither bundle
+differs from the files already published, leaving the database
+untouched. A machine-readable summary of the release can be written
+with --summary.
+
+Examples:
+
+	$ cfssl-trust publish --window 504h
+	$ cfssl-trust publish --roots NEW_ROOTS.pem --intermediates NEW_INTERMEDIATES.pem
+	$ cfssl-trust publish --skip-unchanged --summary release.json
+`,
+	Run: publishRelease,
+}
+
+func init() {
+	publishCmd.Flags().StringVar(&publishWindow, "window", "0h", "minimum time certificates must be valid for to be included")
+	publishCmd.Flags().StringSliceVar(&publishRoots, "roots", nil, "PEM files of new roots to add to the ca release")
+	publishCmd.Flags().StringSliceVar(&publishIntermediates, "intermediates", nil, "PEM files of new intermediates to add to the int release")
+	publishCmd.Flags().StringVar(&publishDir, "dir", ".", "directory to write the bundles to")
+	publishCmd.Flags().BoolVar(&publishListings, "listings", true, "write the certdata listings of the bundles")
+	publishCmd.Flags().BoolVar(&publishSkipUnchanged, "skip-unchanged", false, "don't release if the bundles haven't changed")
+	publishCmd.Flags().StringVar(&publishSummary, "summary", "", "write a JSON summary of the release to this file")
+	publishCmd.Flags().BoolVar(&publishForce, "force", false, "import new certificates even if they fail linting")
+	rootCmd.AddCommand(publishCmd)
+}
+
+func showPublishedBundle(bundle *publish.Bundle) {
+	fmt.Printf("Rolled %s release %s from %s: %d certificates rolled, %d skipped, %d imported.\n",
+		bundle.Bundle, bundle.To, bundle.From, bundle.Rolled, len(bundle.Skipped), len(bundle.Imported))
+	for _, skipped := range bundle.Skipped {
+		showSkippedCert(skipped.Cert, skipReasons[skipped.Reason])
+	}
+
+	for _, imported := range bundle.Imported {
+		serial := big.NewInt(0)
+		serial.SetBytes(imported.Cert.Serial)
+		fmt.Printf("- imported serial %s SKI %s\n", serial, imported.SKI)
+	}
+
+	for _, distrusted := range bundle.Distrusted {
+		serial := big.NewInt(0)
+		serial.SetBytes(distrusted.Cert.Serial)
+		fmt.Printf("- left distrusted serial %s SKI %s out of the PEM bundle\n", serial, distrusted.SKI)
+	}
+}
+
+func writePublishSummary(summary *publish.Summary) error {
+	f, err := os.Create(publishSummary)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(summary)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func publishRelease(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'publish' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	window, err := time.ParseDuration(publishWindow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	opts := &publish.Options{
+		Window: window,
+		Imports: map[string][]string{
+			"ca":  publishRoots,
+			"int": publishIntermediates,
+		},
+		Dir:           publishDir,
+		SkipUnchanged: publishSkipUnchanged,
+		Force:         publishForce,
+	}
+
+	if publishListings {
+		opts.Lister = info.ListBundle
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Rolling trust store release at %s.\n", time.Now().Format(common.DateFormat))
+	summary, err := publish.Publish(db, opts)
+	if lerr, ok := err.(*publish.LintError); ok {
+		writeLintResults(os.Stderr, lerr.Results)
+		fmt.Fprintf(os.Stderr, "[!] %d certificates failed linting; pass --force to publish them anyway.\n", lerr.Failed)
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, bundle := range summary.Bundles {
+		writeLintResults(os.Stderr, bundle.Lint)
+		showPublishedBundle(bundle)
+	}
+
+	if summary.Published {
+		for _, bundle := range summary.Bundles {
+			fmt.Printf("Wrote %s (%d certificates).\n", bundle.Path, bundle.Total)
+			if bundle.Listing != "" {
+				fmt.Printf("Wrote %s.\n", bundle.Listing)
+			}
+		}
+		fmt.Println("Published trust store release", summary.Version)
+	} else {
+		fmt.Println("No changes to the bundles; not publishing release", summary.Version)
+	}
+
+	if publishSummary != "" {
+		err = writePublishSummary(summary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+	}
+}
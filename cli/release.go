@@ -9,6 +9,7 @@ import (
 
 	"github.com/cloudflare/cfssl_trust/common"
 	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/publish"
 	"github.com/cloudflare/cfssl_trust/release"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -50,19 +51,25 @@ certificates from 2017.2.0 into this new release:
 Note that this command will print the SKI, serial number, and subject
 of any certificates that were skipped, and will print a count of the
 certificates included and skipped.
+
+With --check-ocsp, the OCSP status of the intermediates in the previous
+int release is checked first, as with 'check-ocsp', so that those
+reported revoked are skipped. Failed checks are reported, but don't stop
+the roll. The new release is only created once the checks have run.
  `, Run: rollRelease}
 
+var releaseCheckOCSP bool
+
 func init() {
+	releaseCmd.Flags().BoolVar(&releaseCheckOCSP, "check-ocsp", false, "check the OCSP status of the intermediates before rolling")
+	releaseCmd.Flags().StringVar(&ocspTimeout, "ocsp-timeout", "10s", "timeout for each OCSP request")
 	rootCmd.AddCommand(releaseCmd)
 }
 
+// getReleaseForRoll returns the releases to roll from and into. A new
+// release isn't stored here; copyCertificates creates it along with
+// its certificates, so nothing is left behind if the roll fails.
 func getReleaseForRoll(db *sql.DB, releaseName string) (from, to *certdb.Release, err error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, nil, err
-	}
-	defer tx.Rollback()
-
 	var rel release.Release
 
 	// An empty release version implies that cfssl-trust should
@@ -87,16 +94,6 @@ func getReleaseForRoll(db *sql.DB, releaseName string) (from, to *certdb.Release
 		if err != nil {
 			return nil, nil, err
 		}
-
-		_, err = certdb.Ensure(to, tx)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		err = tx.Commit()
-		if err != nil {
-			return nil, nil, err
-		}
 	} else {
 		// If a release version is provided, then take that as
 		// the version to roll the certificates into, and use
@@ -118,6 +115,14 @@ func getReleaseForRoll(db *sql.DB, releaseName string) (from, to *certdb.Release
 	return from, to, err
 }
 
+// skipReasons describes each of the reasons a certificate may be
+// excluded from a release.
+var skipReasons = map[string]string{
+	certdb.ExcludedRevoked:     "revoked certificate",
+	certdb.ExcludedExpired:     "expired certificate",
+	certdb.ExcludedNotYetValid: "certificate that isn't valid at the time of release",
+}
+
 func showSkippedCert(cert *certdb.Certificate, reason string) {
 	serial := big.NewInt(0)
 	serial.SetBytes(cert.Serial)
@@ -131,40 +136,18 @@ func copyCertificates(db *sql.DB, from, to *certdb.Release, window time.Duration
 	}
 	defer tx.Rollback()
 
-	certs, err := certdb.CollectRelease(from.Bundle, from.Version, tx)
+	_, err = certdb.Ensure(to, tx)
 	if err != nil {
 		return err
 	}
 
-	var skipped, included int
-	releaseWindow := to.ReleasedAt + int64(window.Seconds())
-	for _, cert := range certs {
-		if isRevoked, err := cert.Revoked(tx, releaseWindow); err != nil {
-			return err
-		} else if isRevoked {
-			showSkippedCert(cert, "revoked certificate")
-			skipped++
-			continue
-		}
-
-		if cert.NotAfter <= releaseWindow {
-			showSkippedCert(cert, "expired certificate")
-			skipped++
-			continue
-		}
-
-		if cert.NotBefore > to.ReleasedAt {
-			showSkippedCert(cert, "certificate that isn't valid at the time of release")
-			skipped++
-			continue
-		}
+	roll, err := publish.RollRelease(tx, from, to, window)
+	if err != nil {
+		return err
+	}
 
-		cr := certdb.NewCertificateRelease(cert, to)
-		_, err = certdb.Ensure(cr, tx)
-		if err != nil {
-			return err
-		}
-		included++
+	for _, skipped := range roll.Skipped {
+		showSkippedCert(skipped.Cert, skipReasons[skipped.Reason])
 	}
 
 	err = tx.Commit()
@@ -172,7 +155,7 @@ func copyCertificates(db *sql.DB, from, to *certdb.Release, window time.Duration
 		return err
 	}
 
-	fmt.Printf("%d certificates rolled\n%d certificates skipped\n", included, skipped)
+	fmt.Printf("%d certificates rolled\n%d certificates skipped\n", len(roll.Included), len(roll.Skipped))
 	return nil
 }
 
@@ -193,12 +176,28 @@ func rollRelease(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if releaseCheckOCSP && bundle != "int" {
+		fmt.Fprintln(os.Stderr, "[!] --check-ocsp only applies to int releases.")
+		os.Exit(1)
+	}
+
 	from, to, err := getReleaseForRoll(db, bundleRelease)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 		os.Exit(1)
 	}
 
+	if releaseCheckOCSP {
+		report, err := runOCSPChecks(db, from)
+		if err == nil {
+			err = writeOCSPReport(os.Stdout, report)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	err = copyCertificates(db, from, to, window)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
@@ -3,9 +3,11 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/info"
 	"github.com/cloudflare/cfssl_trust/model/certdb"
 	"github.com/cloudflare/cfssl_trust/release"
 	"github.com/spf13/cobra"
@@ -23,6 +25,12 @@ func init() {
 	rootCmd.AddCommand(releaseInfoCmd)
 }
 
+// releaseContents is the structured form of the release-info output.
+type releaseContents struct {
+	Release      *certdb.Release             `json:"release" yaml:"release"`
+	Certificates []*info.CertificateMetadata `json:"certificates" yaml:"certificates"`
+}
+
 func releaseInfo(cmd *cobra.Command, args []string) {
 	switch len(args) {
 	case 0: // Don't do anything.
@@ -74,12 +82,44 @@ func releaseInfo(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("%d certificates in release %s-%s:\n", len(certs),
-		rel.Bundle, rel.Version)
-	for _, cert := range certs {
-		xc := cert.X509()
-		fmt.Printf("SKI: %s\tSerial: %s\tSubject: %s\n",
-			cert.SKI, xc.SerialNumber, common.NameToString(xc.Subject))
+	contents := &releaseContents{
+		Release:      rel,
+		Certificates: make([]*info.CertificateMetadata, 0, len(certs)),
+	}
+
+	// The metadata includes each certificate's releases, which
+	// the text output doesn't need.
+	if outputFormat != "text" {
+		for _, cert := range certs {
+			cm, err := info.LoadCertificateMetadata(tx, cert)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+				os.Exit(1)
+			}
+			contents.Certificates = append(contents.Certificates, cm)
+		}
 	}
 	tx.Commit()
+
+	err = writeOutput(contents, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%d certificates in release %s-%s:\n", len(certs),
+			rel.Bundle, rel.Version)
+		if err != nil {
+			return err
+		}
+
+		for _, cert := range certs {
+			xc := cert.X509()
+			_, err = fmt.Fprintf(w, "SKI: %s\tSerial: %s\tSubject: %s\n",
+				cert.SKI, xc.SerialNumber, common.NameToString(xc.Subject))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
 }
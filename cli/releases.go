@@ -3,6 +3,7 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/cloudflare/cfssl_trust/model/certdb"
@@ -35,7 +36,21 @@ func listReleases(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	for _, rel := range releases {
-		fmt.Println("-", rel.Version)
+	if releases == nil {
+		releases = []*certdb.Release{}
+	}
+
+	err = writeOutput(releases, func(w io.Writer) error {
+		for _, rel := range releases {
+			_, err := fmt.Fprintln(w, "-", rel.Version)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
 	}
 }
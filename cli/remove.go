@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/publish"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	removeSerial     string
+	removeAllBundles bool
+	removeBackup     bool
+	removeRegenerate bool
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a certificate from a bundle.",
+	Long: `Remove the certificate with the given SKI from a bundle. If a release
+is selected (e.g. with -r), the certificate is only removed from that
+release; otherwise, it is removed from every release of the bundle.
+Passing --all-bundles removes the certificate from both the ca and int
+bundles.
+
+If the SKI is shared by several certificates, the serial number (in hex)
+can be used to select one of them; otherwise, all of them are removed.
+Once a certificate no longer belongs to any release, it is deleted from
+the database.
+
+By default, a copy of the database is made before anything is removed.
+If --regenerate is passed, the bundle files in the current directory
+(ca-bundle.crt and int-bundle.crt) and their listings in certdata/ are
+rewritten from the latest release of each affected bundle, as 'publish'
+would write them.
+
+Examples:
+
+	$ cfssl-trust -b ca remove --regenerate \
+		--serial D27FBBC1DE359E5216AD6149586099C4 \
+		5673586495f9921ab0122a046279a14015882149
+	$ cfssl-trust remove --all-bundles 5673586495f9921ab0122a046279a14015882149
+`,
+	Run: remove,
+}
+
+func init() {
+	removeCmd.Flags().StringVarP(&removeSerial, "serial", "s", "", "serial number of the certificate (hex)")
+	removeCmd.Flags().BoolVar(&removeAllBundles, "all-bundles", false, "remove the certificate from both the ca and int bundles")
+	removeCmd.Flags().BoolVar(&removeBackup, "backup", true, "back up the database before removing anything")
+	removeCmd.Flags().BoolVar(&removeRegenerate, "regenerate", false, "rewrite the bundle files for the affected bundles")
+	rootCmd.AddCommand(removeCmd)
+}
+
+// backupDatabase copies the database to a timestamped file next to
+// it, returning the path to the copy.
+func backupDatabase(dbPath string) (string, error) {
+	backupPath := fmt.Sprintf("%s.backup.%s", dbPath, time.Now().Format("20060102_150405"))
+
+	in, err := os.Open(dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+
+	return backupPath, out.Close()
+}
+
+func removeCertificates(tx *sql.Tx, certs []*certdb.Certificate, bundles []string) error {
+	for _, cert := range certs {
+		for _, b := range bundles {
+			removed, deleted, err := cert.Remove(tx, b, bundleRelease)
+			if err != nil {
+				return err
+			}
+
+			for _, rel := range removed {
+				fmt.Printf("- removed SKI %s serial %x from %s release %s\n",
+					cert.SKI, cert.Serial, rel.Bundle, rel.Version)
+			}
+
+			if deleted {
+				fmt.Printf("- certificate SKI %s serial %x is no longer in any release; deleted it\n",
+					cert.SKI, cert.Serial)
+			}
+		}
+	}
+
+	return nil
+}
+
+// regenerateBundle rewrites the bundle file and its certdata listing
+// from the latest release of the bundle, as publish would write them.
+func regenerateBundle(db *sql.DB, b string) error {
+	rel, err := certdb.LatestRelease(db, b)
+	if err == sql.ErrNoRows {
+		fmt.Printf("No %s releases found; not regenerating %s.\n", b, publish.Files[b])
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	certs, _, err := publish.BundleCertificates(tx, rel)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Regenerating %s (release %s, %d certificates).\n",
+		publish.Files[b], rel.Version, len(certs))
+	pemBundle := publish.EncodeBundle(certs)
+	err = ioutil.WriteFile(publish.Files[b], pemBundle, 0644)
+	if err != nil {
+		return err
+	}
+
+	listing, err := info.ListBundle(publish.Files[b], pemBundle)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(publish.ListingDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	listingPath := filepath.Join(publish.ListingDir, publish.ListingFile(b))
+	fmt.Printf("Regenerating %s.\n", listingPath)
+	return ioutil.WriteFile(listingPath, listing, 0644)
+}
+
+func remove(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'remove' requires a single SKI.")
+		os.Exit(1)
+	}
+	ski := args[0]
+
+	bundles := []string{bundle}
+	if removeAllBundles {
+		bundles = []string{"ca", "int"}
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	certs, err := certdb.FindCertificateBySKI(db, ski)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if removeSerial != "" {
+		serial, err := parseSerial(removeSerial)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+
+		var matched []*certdb.Certificate
+		for _, cert := range certs {
+			if bytes.Equal(cert.Serial, serial) {
+				matched = append(matched, cert)
+			}
+		}
+		certs = matched
+	}
+
+	if len(certs) == 0 {
+		fmt.Fprintf(os.Stderr, "[!] no matching certificates with SKI %s\n", ski)
+		os.Exit(1)
+	}
+
+	for _, cert := range certs {
+		fmt.Printf("Removing %s (SKI=%s, serial=%x)\n",
+			common.NameToString(cert.X509().Subject), cert.SKI, cert.Serial)
+	}
+
+	if removeBackup {
+		backupPath, err := backupDatabase(dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] failed to back up database: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Database backed up to", backupPath)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = removeCertificates(tx, certs, bundles)
+	if err != nil {
+		tx.Rollback()
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] failed to commit transaction: %s\n", err)
+		os.Exit(1)
+	}
+
+	if removeRegenerate {
+		for _, b := range bundles {
+			err = regenerateBundle(db, b)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	db.Close()
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	revokeSerial    string
+	revokeMechanism string
+	revokeReason    string
+	revokeAt        string
+	revokeAmend     bool
+)
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Record a certificate revocation.",
+	Long: `Record the revocation of the certificate with the given SKI. Revoked
+certificates are skipped by 'release' and reported by 'expiring' once the
+revocation has taken effect.
+
+The effective date may be in the past or the future; a future date
+allows a scheduled distrust to be recorded ahead of time. Dates may be
+given as YYYY-MM-DD or as a full timestamp (e.g. 2017-03-22T21:24:00+0000).
+If no date is given, the revocation takes effect immediately.
+
+If the SKI is shared by several certificates, the serial number (in hex)
+can be used to select one of them. Note that revocations are recorded
+by SKI, so all certificates with that SKI will be treated as revoked.
+
+An existing revocation can be changed by passing --amend; only the
+mechanism, reason, and date given are changed.
+
+Examples:
+
+	$ cfssl-trust revoke --reason "CA distrusted" --at 2017-09-01 \
+		5673586495f9921ab0122a046279a14015882149
+	$ cfssl-trust revoke --amend --at 2017-10-01 \
+		5673586495f9921ab0122a046279a14015882149
+`,
+	Run: revoke,
+}
+
+var unrevokeCmd = &cobra.Command{
+	Use:   "unrevoke",
+	Short: "Remove a certificate revocation.",
+	Long: `Remove the revocation recorded for the certificate with the given SKI,
+allowing it to be carried into future releases again.`,
+	Run: unrevoke,
+}
+
+func init() {
+	revokeCmd.Flags().StringVarP(&revokeSerial, "serial", "s", "", "serial number of the certificate (hex)")
+	revokeCmd.Flags().StringVarP(&revokeMechanism, "mechanism", "m", "manual", "mechanism by which the revocation was discovered")
+	revokeCmd.Flags().StringVar(&revokeReason, "reason", "", "reason for the revocation")
+	revokeCmd.Flags().StringVar(&revokeAt, "at", "", "date the revocation takes effect (default now)")
+	revokeCmd.Flags().BoolVar(&revokeAmend, "amend", false, "update an existing revocation")
+	rootCmd.AddCommand(revokeCmd)
+
+	unrevokeCmd.Flags().StringVarP(&revokeSerial, "serial", "s", "", "serial number of the certificate (hex)")
+	rootCmd.AddCommand(unrevokeCmd)
+}
+
+// parseSerial converts a hex-encoded serial number into the form
+// stored in the database.
+func parseSerial(in string) ([]byte, error) {
+	serial, ok := big.NewInt(0).SetString(in, 16)
+	if !ok {
+		return nil, errors.New("invalid serial number " + in + " (expected hex)")
+	}
+
+	// This mirrors certdb.NewCertificate's handling of the
+	// NOT NULL constraint.
+	if serial.Sign() == 0 {
+		return []byte{0}, nil
+	}
+	return serial.Bytes(), nil
+}
+
+// lookupCertificate finds the certificate with the given SKI and,
+// if provided, hex-encoded serial number.
+func lookupCertificate(db *sql.DB, ski, serial string) (*certdb.Certificate, error) {
+	certs, err := certdb.FindCertificateBySKI(db, ski)
+	if err != nil {
+		return nil, err
+	}
+
+	if serial == "" {
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("no certificate with SKI %s", ski)
+		}
+		return certs[0], nil
+	}
+
+	serialBytes, err := parseSerial(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cert := range certs {
+		if bytes.Equal(cert.Serial, serialBytes) {
+			return cert, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no certificate with SKI %s and serial %s", ski, serial)
+}
+
+// amendRevocation changes an existing revocation, keeping its
+// mechanism, reason, and effective date unless their flags were given.
+// rev is updated to match.
+func amendRevocation(tx *sql.Tx, flags *pflag.FlagSet, cert *certdb.Certificate, rev *certdb.Revocation, when time.Time) error {
+	var err error
+	if flags.Changed("mechanism") {
+		rev.Mechanism, err = flags.GetString("mechanism")
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.Changed("reason") {
+		rev.Reason, err = flags.GetString("reason")
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.Changed("at") {
+		rev.RevokedAt = when.Unix()
+	}
+
+	return cert.AmendRevocation(tx, rev.Mechanism, rev.Reason, rev.RevokedAt)
+}
+
+func revoke(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'revoke' requires a single SKI.")
+		os.Exit(1)
+	}
+
+	when := time.Now()
+	if revokeAt != "" {
+		var err error
+		when, err = common.ParseDate(revokeAt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	cert, err := lookupCertificate(db, args[0], revokeSerial)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	rev := &certdb.Revocation{SKI: cert.SKI}
+	err = rev.Select(tx)
+	switch {
+	case err == sql.ErrNoRows && revokeAmend:
+		err = fmt.Errorf("certificate %s hasn't been revoked", cert.SKI)
+	case err == sql.ErrNoRows:
+		err = cert.Revoke(tx, revokeMechanism, revokeReason, when.Unix())
+	case err == nil && !revokeAmend:
+		err = fmt.Errorf("certificate %s was already revoked at %s; use --amend to change the revocation",
+			cert.SKI, time.Unix(rev.RevokedAt, 0).UTC().Format(common.DateFormat))
+	case err == nil:
+		err = amendRevocation(tx, cmd.Flags(), cert, rev, when)
+		when = time.Unix(rev.RevokedAt, 0)
+	}
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Certificate %s revoked as of %s.\n", cert.SKI,
+		when.UTC().Format(common.DateFormat))
+}
+
+func unrevoke(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "[!] 'unrevoke' requires a single SKI.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	cert, err := lookupCertificate(db, args[0], revokeSerial)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = cert.Unrevoke(tx)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("certificate %s hasn't been revoked", cert.SKI)
+	}
+	cleanup(tx, db, err)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Revocation for certificate %s removed.\n", cert.SKI)
+}
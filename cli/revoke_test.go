@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+	"github.com/spf13/pflag"
+)
+
+// TestAmendRevocationDate amends only the date of a revocation, as in
+// 'revoke --amend --at 2017-10-01 <SKI>', and checks that the
+// mechanism and reason survive.
+func TestAmendRevocationDate(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("root", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.1.0", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	cert := certdb.NewCertificate(root.Cert)
+	err = cert.Revoke(tx, "crl", "keyCompromise", time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := pflag.NewFlagSet("revoke", pflag.ContinueOnError)
+	flags.String("mechanism", "manual", "")
+	flags.String("reason", "", "")
+	flags.String("at", "", "")
+	err = flags.Parse([]string{"--at", "2017-10-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when, err := common.ParseDate("2017-10-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev := &certdb.Revocation{SKI: cert.SKI}
+	err = rev.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = amendRevocation(tx, flags, cert, rev, when)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev = &certdb.Revocation{SKI: cert.SKI}
+	err = rev.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.Mechanism != "crl" || rev.Reason != "keyCompromise" || rev.RevokedAt != when.Unix() {
+		t.Fatalf("expected only the date to change, but have %+v", rev)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl_trust/config"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
 	"github.com/cloudflare/cfssl_trust/release"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,6 +19,8 @@ var (
 	dbFile        string
 	bundle        string
 	bundleRelease string
+	auditActor    string
+	auditNote     string
 )
 
 func root(cmd *cobra.Command, args []string) {
@@ -34,10 +37,41 @@ var configLocations = []string{
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "cfssl-trust",
-	Short: "Manage a trust database for root and intermediate bundles.",
-	Long:  ``,
-	Run:   root,
+	Use:              "cfssl-trust",
+	Short:            "Manage a trust database for root and intermediate bundles.",
+	Long:             ``,
+	PersistentPreRun: checkSchema,
+	Run:              root,
+}
+
+// checkSchema refuses to run commands against a database that hasn't
+// been migrated to the current schema, rather than letting them fail
+// part way through. Databases that don't exist yet are left to the
+// command; setup is what migrates them.
+func checkSchema(cmd *cobra.Command, args []string) {
+	if cmd == setupCmd || cmd.Name() == "help" {
+		return
+	}
+
+	dbPath := viper.GetString("database.path")
+	if dbPath == "" {
+		return
+	} else if _, err := os.Stat(dbPath); err != nil {
+		return
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	err = certdb.CheckSchema(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
 }
 
 // Execute runs the cfssl-trust binary
@@ -84,8 +118,12 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "f", "", "config file (default is /etc/cfssl/cfssl-trust.yaml)")
 	rootCmd.PersistentFlags().StringVarP(&dbFile, "db", "d", "", "path to trust database")
 	rootCmd.PersistentFlags().StringVarP(&bundleRelease, "release", "r", "", "select a release")
+	rootCmd.PersistentFlags().StringVar(&auditActor, "actor", "", "name recorded in the audit log (default is the current user)")
+	rootCmd.PersistentFlags().StringVar(&auditNote, "note", "", "note recorded in the audit log with any changes")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format (text, json or yaml)")
 
 	viper.BindPFlag("database.path", rootCmd.PersistentFlags().Lookup("db"))
+	viper.BindPFlag("audit.actor", rootCmd.PersistentFlags().Lookup("actor"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -109,6 +147,16 @@ func initConfig() {
 		log.Info("cfssl-trust: loading from config file ", viper.ConfigFileUsed())
 	}
 
+	if actor := viper.GetString("audit.actor"); actor != "" {
+		certdb.AuditActor = actor
+	}
+	certdb.AuditNote = auditNote
+
+	if !outputFormats[outputFormat] {
+		fmt.Fprintf(os.Stderr, "[!] Unknown output format '%s' (valid formats are text|json|yaml).\n", outputFormat)
+		os.Exit(1)
+	}
+
 	if bundleRelease != "" {
 		rel, err := release.Parse(bundleRelease)
 		if err != nil {
@@ -116,6 +164,10 @@ func initConfig() {
 			fmt.Fprintf(os.Stderr, "\tReason: %s\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("selected release", rel)
+
+		// Structured output shouldn't be mixed with chatter.
+		if outputFormat == "text" {
+			fmt.Println("selected release", rel)
+		}
 	}
 }
@@ -3,6 +3,7 @@ package cli
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/cloudflare/cfssl_trust/info"
@@ -23,6 +24,8 @@ have the form type:regexp, e.g. ski:01234567. The supported types are:
 	- issuer
 	- release
 	- bundle
+	- platform (a platform trust store recorded by import-platforms,
+	  e.g. nss, windows or kitkat)
 
 Multiple search terms are supported; for example "ski:1234567 issuer:Example".
 
@@ -43,10 +46,6 @@ func init() {
 }
 
 func search(cmd *cobra.Command, args []string) {
-	if len(args) == 0 {
-		os.Exit(0)
-	}
-
 	dbPath := viper.GetString("database.path")
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -54,17 +53,28 @@ func search(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	results, err := info.Query(db, args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
-		os.Exit(1)
-	}
-
-	for _, cert := range results {
-		err = info.WriteCertificateMetadata(os.Stdout, cert)
+	// With no search terms there is nothing to match, but the JSON and
+	// YAML output should still be an empty list rather than null.
+	results := []*info.CertificateMetadata{}
+	if len(args) != 0 {
+		results, err = info.Query(db, args)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
 			os.Exit(1)
 		}
 	}
+
+	err = writeOutput(results, func(w io.Writer) error {
+		for _, cert := range results {
+			err := info.WriteCertificateMetadata(w, cert)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serveAddress string
+
+// These bound how long a client may take to send a request and to read
+// the response, so slow clients can't tie up connections.
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Second
+	serveWriteTimeout      = time.Minute
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the trust database over HTTP.",
+	Long: `Serve a read-only HTTP API over the trust database. The API lists
+releases, serves the PEM bundle for a release, looks up certificates by
+SKI, runs the same searches as 'search', and reports expiring
+certificates:
+
+	GET /releases?bundle=int
+	GET /bundles/{bundle}/{version}
+	GET /certificates/{ski}[?format=pem]
+	GET /search?q=type:regexp[&q=...]
+	GET /expiring?bundle=int[&version=...][&window=720h]
+
+Certificates and releases are returned as JSON in the same form as the
+--output json flag. Bundles may be requested with "latest" as the
+version, and carry an ETag derived from their SHA-256 digest.
+
+Examples:
+
+	$ cfssl-trust -d cert.db serve --listen 127.0.0.1:8080
+	$ curl http://127.0.0.1:8080/bundles/ca/latest > ca-bundle.crt
+`,
+	Run: serve,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddress, "listen", "127.0.0.1:8080", "address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'serve' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	// The API never writes, so open the database read-only.
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	fmt.Printf("Serving %s on %s.\n", dbPath, serveAddress)
+	srv := &http.Server{
+		Addr:              serveAddress,
+		Handler:           server.New(db),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	err = srv.ListenAndServe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/platform"
+	"github.com/cloudflare/cfssl_trust/successor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	successorsWindow   string
+	successorsMetadata string
+	successorsFetch    bool
+)
+
+var successorsCmd = &cobra.Command{
+	Use:   "successors",
+	Short: "Look for replacements for expiring (and revoked) certificates.",
+	Long: `Pair each certificate that 'expiring' reports with the certificates that
+could replace it: certificates with the same subject that aren't revoked
+and remain valid past the window and past the certificate itself. They
+are looked for in the database and in the platform keystores listed in
+ca-bundle.crt.metadata (--metadata), and, with --fetch, at the CA Issuers
+URL recorded for the certificates the expiring certificate issued.
+Successors with the same key are listed first; certificates without any
+successor are flagged.
+
+Example:
+
+	$ cfssl-trust -b int successors --window 720h --fetch
+`,
+	Run: successors,
+}
+
+func init() {
+	successorsCmd.Flags().StringVar(&successorsWindow, "window", "720h", "list certificates expiring within this window")
+	successorsCmd.Flags().StringVar(&successorsMetadata, "metadata", "ca-bundle.crt.metadata", "metadata listing the platform keystores to search")
+	successorsCmd.Flags().BoolVar(&successorsFetch, "fetch", false, "fetch the CA Issuers URLs of the certificates the expiring ones issued")
+	rootCmd.AddCommand(successorsCmd)
+}
+
+func writeSuccessorReport(w io.Writer, report *successor.Report) error {
+	for _, expiring := range report.Certificates {
+		cert := expiring.Certificate
+		_, err := fmt.Fprintf(w, "%s (SKI=%s, serial=%s, subject='%s')\n",
+			skipReasons[expiring.Reason], cert.SKI, cert.Serial, cert.Subject)
+		if err != nil {
+			return err
+		}
+
+		if expiring.AIAError != "" {
+			_, err = fmt.Fprintf(w, "\t! failed to fetch CA Issuers URL: %s\n", expiring.AIAError)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(expiring.Successors) == 0 {
+			_, err = fmt.Fprintln(w, "\t! no replacement found")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, candidate := range expiring.Successors {
+			source := candidate.Source
+			switch {
+			case candidate.Platform != "":
+				source += " " + candidate.Platform
+			case candidate.URL != "":
+				source += " " + candidate.URL
+			}
+
+			key := "new key"
+			if candidate.SameKey {
+				key = "same key"
+			}
+
+			_, err = fmt.Fprintf(w, "\t-> %s: SKI=%s, serial=%s, %s, expires %s\n", source,
+				candidate.Certificate.SKI, candidate.Certificate.Serial, key,
+				candidate.Certificate.NotAfter.Format(common.DateFormat))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "Release:", report.Release.Bundle, report.Release.Version)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%d certificates with successors.\n%d certificates without a replacement.\n",
+		report.Replaced, report.Unreplaced)
+	return err
+}
+
+func successors(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "[!] 'successors' doesn't take any arguments.")
+		os.Exit(1)
+	}
+
+	window, err := time.ParseDuration(successorsWindow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	opts := &successor.Options{}
+	if successorsMetadata != "" {
+		opts.Keystores, err = platform.LoadMetadata(successorsMetadata)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if successorsFetch {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	report, err := successor.Find(db, bundle, bundleRelease, window, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeSuccessorReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/platform"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ubiquityMissing bool
+
+var ubiquityCmd = &cobra.Command{
+	Use:   "ubiquity",
+	Short: "Report which platforms trust the roots in a ca release.",
+	Long: `Load the platforms listed in ca-bundle.crt.metadata (by default, the one
+in the current directory) and report, for every root in a ca release,
+the platforms that trust it and CFSSL's weighted ubiquity score: the
+total weight of the platforms that trust the root and support its hash
+and key algorithms. Roots that no platform keystore trusts are listed
+separately, as are the roots of each keystore (shared by one or more
+platforms) that are missing from the release; pass --missing to list
+them.
+
+The release is given with -r; by default, the latest ca release is
+used. Roots are matched to keystores by their public key, as in CFSSL.
+
+Example:
+
+	$ cfssl-trust -r 2025.2.0 ubiquity --missing ca-bundle.crt.metadata
+`,
+	Run: ubiquityReport,
+}
+
+func init() {
+	ubiquityCmd.Flags().BoolVar(&ubiquityMissing, "missing", false, "list the keystore roots missing from the release")
+	rootCmd.AddCommand(ubiquityCmd)
+}
+
+func writeUbiquityReport(w io.Writer, report *platform.UbiquityReport) error {
+	_, err := fmt.Fprintf(w, "Release: %s %s\n", report.Release.Bundle, report.Release.Version)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range report.Roots {
+		desc := fmt.Sprintf("- %s (SKI=%s): score %d/%d, trusted by %d of %d platforms",
+			root.Certificate.Subject, root.Certificate.SKI, root.Score, report.MaxScore,
+			len(root.Trusted), len(root.Trusted)+len(root.Untrusted))
+		if len(root.Untrusted) > 0 {
+			desc += "; not trusted by " + strings.Join(root.Untrusted, ", ")
+		}
+
+		_, err = fmt.Fprintln(w, desc)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%d roots trusted by no platform keystore.\n", len(report.Untrusted))
+	if err != nil {
+		return err
+	}
+
+	for _, root := range report.Untrusted {
+		_, err = fmt.Fprintf(w, "- %s (SKI=%s)\n", root.Certificate.Subject, root.Certificate.SKI)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, coverage := range report.Keystores {
+		_, err = fmt.Fprintf(w, "%s (%s): %d of %d keystore roots missing from the release.\n",
+			filepath.Base(coverage.Keystore), strings.Join(coverage.Platforms, ", "), len(coverage.Missing), coverage.Total)
+		if err != nil {
+			return err
+		}
+
+		if !ubiquityMissing {
+			continue
+		}
+
+		for _, root := range coverage.Missing {
+			_, err = fmt.Fprintf(w, "- %s (SKI=%s, expires %s)\n", root.Subject, root.SKI,
+				root.NotAfter.Format(common.DateFormat))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func ubiquityReport(cmd *cobra.Command, args []string) {
+	metadata := "ca-bundle.crt.metadata"
+	switch len(args) {
+	case 0:
+	case 1:
+		metadata = args[0]
+	default:
+		fmt.Fprintln(os.Stderr, "[!] 'ubiquity' takes at most the path to ca-bundle.crt.metadata.")
+		os.Exit(1)
+	}
+
+	err := platform.LoadPlatforms(metadata)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var rel *certdb.Release
+	if bundleRelease == "" {
+		rel, err = certdb.LatestRelease(db, "ca")
+	} else {
+		rel, err = certdb.FetchRelease(db, "ca", bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	tx.Rollback()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	report, err := platform.Ubiquity(rel, certs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeUbiquityReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var verifyChainsCARelease string
+
+var verifyChainsCmd = &cobra.Command{
+	Use:   "verify-chains",
+	Short: "Check that the intermediates in a release chain to the roots.",
+	Long: `Check that every intermediate in an int release (the latest, unless -r
+is given) chains to a root in the matching ca release: the ca release
+with the same version, or else the latest ca release made before it.
+--ca-release selects the ca release explicitly. Chains are built from
+AKI to SKI links, may pass through other intermediates in the release,
+and every signature along them is verified.
+
+Orphaned intermediates, which don't chain to any root, and those whose
+chains all pass through an expired or revoked certificate are listed,
+along with the number of intermediates at each path length. The command
+exits with a non-zero status if any are found, so that it can be run
+in CI.
+
+Example:
+
+	$ cfssl-trust -r 2025.2.0 verify-chains
+`,
+	Run: verifyChains,
+}
+
+func init() {
+	verifyChainsCmd.Flags().StringVar(&verifyChainsCARelease, "ca-release", "", "ca release to verify against")
+	rootCmd.AddCommand(verifyChainsCmd)
+}
+
+func writeChainReport(w io.Writer, report *chain.Report) error {
+	_, err := fmt.Fprintf(w, "Verifying int %s against ca %s.\n",
+		report.Intermediates.Version, report.Roots.Version)
+	if err != nil {
+		return err
+	}
+
+	lengths := map[int]int{}
+	for _, result := range report.Certificates {
+		if result.Status == chain.StatusValid {
+			lengths[result.PathLength]++
+			continue
+		}
+
+		_, err = fmt.Fprintf(w, "%s (SKI=%s, serial=%s, subject='%s')\n", result.Status,
+			result.Certificate.SKI, result.Certificate.Serial, result.Certificate.Subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	var keys []int
+	for length := range lengths {
+		keys = append(keys, length)
+	}
+	sort.Ints(keys)
+
+	for _, length := range keys {
+		_, err = fmt.Fprintf(w, "%d intermediates with path length %d.\n", lengths[length], length)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%d intermediates valid.\n%d intermediates chain only through expired or revoked certificates.\n%d intermediates orphaned.\n",
+		report.Valid, report.ExpiredOrRevoked, report.Orphaned)
+	return err
+}
+
+func verifyChains(cmd *cobra.Command, args []string) {
+	dbPath := viper.GetString("database.path")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var intRel *certdb.Release
+	if bundleRelease == "" {
+		intRel, err = certdb.LatestRelease(db, "int")
+	} else {
+		intRel, err = certdb.FetchRelease(db, "int", bundleRelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	var caRel *certdb.Release
+	if verifyChainsCARelease == "" {
+		caRel, err = chain.MatchingRelease(db, intRel)
+	} else {
+		caRel, err = certdb.FetchRelease(db, "ca", verifyChainsCARelease)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	report, err := chain.Verify(tx, intRel, caRel, time.Now().Unix())
+	tx.Rollback()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	err = writeOutput(report, func(w io.Writer) error {
+		return writeChainReport(w, report)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %s\n", err)
+		os.Exit(1)
+	}
+
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
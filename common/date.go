@@ -0,0 +1,28 @@
+package common
+
+import (
+	"errors"
+	"time"
+)
+
+// dateFormats lists the formats accepted by ParseDate, in the order
+// they are tried.
+var dateFormats = []string{
+	DateFormat,
+	time.RFC3339,
+	"2006-01-02",
+}
+
+// ParseDate parses a date given on the command line. It accepts
+// DateFormat, RFC 3339 timestamps, and plain YYYY-MM-DD dates (which
+// are taken to be midnight UTC).
+func ParseDate(in string) (time.Time, error) {
+	for _, format := range dateFormats {
+		t, err := time.Parse(format, in)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("common: invalid date " + in + " (expected YYYY-MM-DD or " + DateFormat + ")")
+}
@@ -0,0 +1,137 @@
+// Package diff compares the certificates in two releases of a bundle,
+// explaining why each removed certificate was dropped.
+package diff
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// ReasonRemoved is given for certificates that were dropped from a
+// release even though they would have been carried over by a release
+// roll; that is, they were removed by hand.
+const ReasonRemoved = "removed"
+
+// Certificate describes a certificate that was added to or removed
+// from a release. Serial numbers are hex-encoded.
+type Certificate struct {
+	SKI       string    `json:"ski" yaml:"ski"`
+	Serial    string    `json:"serial" yaml:"serial"`
+	Subject   string    `json:"subject" yaml:"subject"`
+	Issuer    string    `json:"issuer" yaml:"issuer"`
+	NotBefore time.Time `json:"not_before" yaml:"not_before"`
+	NotAfter  time.Time `json:"not_after" yaml:"not_after"`
+
+	// Reason is one of the certdb.Excluded* reasons or
+	// ReasonRemoved; it is only set for removed certificates.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+
+	Cert *certdb.Certificate `json:"-" yaml:"-"`
+}
+
+// NewCertificate describes a certificate from the database.
+func NewCertificate(cert *certdb.Certificate) *Certificate {
+	x509Cert := cert.X509()
+	return &Certificate{
+		SKI:       cert.SKI,
+		Serial:    fmt.Sprintf("%x", cert.Serial),
+		Subject:   common.NameToString(x509Cert.Subject),
+		Issuer:    common.NameToString(x509Cert.Issuer),
+		NotBefore: time.Unix(cert.NotBefore, 0).UTC(),
+		NotAfter:  time.Unix(cert.NotAfter, 0).UTC(),
+		Cert:      cert,
+	}
+}
+
+// Diff lists the certificates added and removed between two releases
+// of a bundle. Total is the number of certificates in the later
+// release.
+type Diff struct {
+	Bundle  string         `json:"bundle" yaml:"bundle"`
+	From    string         `json:"from" yaml:"from"`
+	To      string         `json:"to" yaml:"to"`
+	Total   int            `json:"total" yaml:"total"`
+	Added   []*Certificate `json:"added" yaml:"added"`
+	Removed []*Certificate `json:"removed" yaml:"removed"`
+}
+
+func certKey(cert *certdb.Certificate) string {
+	return fmt.Sprintf("%s:%x", cert.SKI, cert.Serial)
+}
+
+// Releases compares two releases of a bundle. Removed certificates are
+// classified using the same rules as a release roll, applied at the
+// time the later release was made; window should match the expiration
+// window used when rolling it. If from is empty, the later release is
+// treated as the first release of the bundle, and every certificate in
+// it is listed as added.
+func Releases(tx *sql.Tx, bundle, from, to string, window time.Duration) (*Diff, error) {
+	toRel := &certdb.Release{Bundle: bundle, Version: to}
+	err := toRel.Select(tx)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("diff: release " + bundle + "-" + to + " doesn't exist")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fromCerts []*certdb.Certificate
+	if from != "" {
+		fromCerts, err = certdb.CollectRelease(bundle, from, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	toCerts, err := certdb.CollectRelease(bundle, to, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{
+		Bundle:  bundle,
+		From:    from,
+		To:      to,
+		Total:   len(toCerts),
+		Added:   []*Certificate{},
+		Removed: []*Certificate{},
+	}
+
+	inFrom := map[string]bool{}
+	for _, cert := range fromCerts {
+		inFrom[certKey(cert)] = true
+	}
+
+	inTo := map[string]bool{}
+	for _, cert := range toCerts {
+		inTo[certKey(cert)] = true
+		if !inFrom[certKey(cert)] {
+			d.Added = append(d.Added, NewCertificate(cert))
+		}
+	}
+
+	for _, cert := range fromCerts {
+		if inTo[certKey(cert)] {
+			continue
+		}
+
+		reason, err := cert.Excluded(tx, toRel.ReleasedAt, window)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason == "" {
+			reason = ReasonRemoved
+		}
+
+		removed := NewCertificate(cert)
+		removed.Reason = reason
+		d.Removed = append(d.Removed, removed)
+	}
+
+	return d, nil
+}
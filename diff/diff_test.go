@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// TestReleases builds three releases:
+//
+//   - 2017.6.0 contains kept, removed, and revoked;
+//   - 2017.8.0 contains added, revoked having been revoked in July and
+//     removed having been dropped by hand;
+//   - 2018.6.0 is empty, as added expired in May.
+func TestReleases(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var certs = map[string]*certdbtest.Identity{}
+	for _, cn := range []string{"kept", "removed", "revoked"} {
+		certs[cn], err = certdbtest.NewRoot(cn, date(2017, 1, 1), date(2020, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	certs["added"], err = certdbtest.NewRoot("added", date(2017, 1, 1), date(2018, 5, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.6.0", date(2017, 6, 1),
+		certs["kept"].Cert, certs["removed"].Cert, certs["revoked"].Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.8.0", date(2017, 8, 1),
+		certs["kept"].Cert, certs["added"].Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2018.6.0", date(2018, 6, 1),
+		certs["kept"].Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	revoked := certdb.NewCertificate(certs["revoked"].Cert)
+	err = revoked.Revoke(tx, "test", "test", date(2017, 7, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Releases(tx, "ca", "2017.6.0", "2017.8.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Added) != 1 || d.Added[0].Subject != "/added/O=cfssl_trust test" {
+		t.Fatalf("expected 'added' to be the only added certificate, but have %d added", len(d.Added))
+	}
+
+	reasons := map[string]string{}
+	for _, cert := range d.Removed {
+		reasons[cert.Cert.X509().Subject.CommonName] = cert.Reason
+	}
+
+	expected := map[string]string{
+		"removed": ReasonRemoved,
+		"revoked": certdb.ExcludedRevoked,
+	}
+	if len(reasons) != len(expected) {
+		t.Fatalf("expected %d removed certificates, but have %d", len(expected), len(reasons))
+	}
+
+	for cn, reason := range expected {
+		if reasons[cn] != reason {
+			t.Fatalf("expected %s to be removed as %s, but have '%s'", cn, reason, reasons[cn])
+		}
+	}
+
+	d, err = Releases(tx, "ca", "2017.8.0", "2018.6.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Added) != 0 || len(d.Removed) != 1 || d.Removed[0].Reason != certdb.ExcludedExpired {
+		t.Fatalf("expected a single expired certificate to be removed, have %d added and %d removed",
+			len(d.Added), len(d.Removed))
+	}
+
+	// With a long enough window, "removed" would have been
+	// skipped as expiring when the release was rolled.
+	d, err = Releases(tx, "ca", "2017.6.0", "2017.8.0", 3*365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cert := range d.Removed {
+		if cert.Cert.X509().Subject.CommonName == "removed" && cert.Reason != certdb.ExcludedExpired {
+			t.Fatalf("expected removed to be classified as expired, but have %s", cert.Reason)
+		}
+	}
+
+	d, err = Releases(tx, "ca", "", "2017.6.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Added) != 3 || len(d.Removed) != 0 || d.Total != 3 {
+		t.Fatalf("expected every certificate in the first release to be added, but have %d added", len(d.Added))
+	}
+
+	_, err = Releases(tx, "ca", "2017.6.0", "2019.1.0", 0)
+	if err == nil {
+		t.Fatal("diffing against a missing release should fail")
+	}
+}
@@ -9,9 +9,12 @@ require (
 	github.com/mattn/go-sqlite3 v1.2.0
 	github.com/prometheus/client_golang v1.14.0
 	github.com/spf13/cobra v0.0.0-20170425164442-6ed17b5128e8
+	github.com/spf13/pflag v0.0.0-20170418052314-2300d0f8576f
 	github.com/spf13/viper v0.0.0-20170417080815-0967fc9aceab
+	golang.org/x/crypto v0.33.0
 	golang.org/x/lint v0.0.0-20200302205851-738671d3881b
 	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.2.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -36,12 +39,9 @@ require (
 	github.com/spf13/afero v0.0.0-20170217164146-9be650865eab // indirect
 	github.com/spf13/cast v1.1.0 // indirect
 	github.com/spf13/jwalterweatherman v0.0.0-20170109133355-fa7ca7e836cf // indirect
-	github.com/spf13/pflag v0.0.0-20170418052314-2300d0f8576f // indirect
-	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	golang.org/x/tools v0.24.1 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
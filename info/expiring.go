@@ -0,0 +1,102 @@
+package info
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// An ExpiringCertificate is a certificate that won't be included in
+// the next release. The reason is one of the certdb.Excluded* reasons.
+type ExpiringCertificate struct {
+	Reason      string               `json:"reason" yaml:"reason"`
+	Certificate *CertificateMetadata `json:"certificate" yaml:"certificate"`
+	Cert        *certdb.Certificate  `json:"-" yaml:"-"`
+}
+
+// An ExpiringReport lists the certificates in a release that won't
+// be carried over into the next release.
+type ExpiringReport struct {
+	Release      *certdb.Release        `json:"release" yaml:"release"`
+	Window       string                 `json:"window" yaml:"window"`
+	Expired      int                    `json:"expired" yaml:"expired"`
+	Revoked      int                    `json:"revoked" yaml:"revoked"`
+	Certificates []*ExpiringCertificate `json:"certificates" yaml:"certificates"`
+}
+
+func (report *ExpiringReport) add(tx *sql.Tx, cert *certdb.Certificate, reason string) error {
+	cm, err := LoadCertificateMetadata(tx, cert)
+	if err != nil {
+		return err
+	}
+
+	if reason == certdb.ExcludedRevoked {
+		report.Revoked++
+	} else {
+		report.Expired++
+	}
+
+	report.Certificates = append(report.Certificates, &ExpiringCertificate{
+		Reason:      reason,
+		Certificate: cm,
+		Cert:        cert,
+	})
+	return nil
+}
+
+// Expiring looks for the certificates in a release that have been
+// revoked, or that expire within the window from now. If version is
+// empty, the latest release of the bundle is used.
+func Expiring(db *sql.DB, bundle, version string, window time.Duration) (*ExpiringReport, error) {
+	var rel *certdb.Release
+	var err error
+	if version == "" {
+		rel, err = certdb.LatestRelease(db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(db, bundle, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExpiringReport{
+		Release:      rel,
+		Window:       window.String(),
+		Certificates: []*ExpiringCertificate{},
+	}
+
+	expiresAt := time.Now().Add(window)
+	for _, cert := range certs {
+		var reason string
+		if isRevoked, err := cert.Revoked(tx, rel.ReleasedAt); err != nil {
+			return nil, err
+		} else if isRevoked {
+			reason = certdb.ExcludedRevoked
+		} else if cert.NotAfter <= expiresAt.Unix() {
+			reason = certdb.ExcludedExpired
+		} else if cert.NotBefore > rel.ReleasedAt {
+			reason = certdb.ExcludedNotYetValid
+		} else {
+			continue
+		}
+
+		err = report.add(tx, cert, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, tx.Commit()
+}
@@ -3,10 +3,12 @@ package info
 import (
 	"crypto/x509"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cloudflare/cfssl_trust/common"
@@ -38,15 +40,55 @@ func writeCertificateReleases(w io.Writer, tx *sql.Tx, cert *certdb.Certificate)
 	}
 
 	for _, rel := range releases {
-		_, err = fmt.Fprintf(w, "\t- %s %s (%s)\n",
+		cr := certdb.NewCertificateRelease(cert, rel)
+		purposes, err := cr.Purposes(tx)
+		if err != nil {
+			return err
+		}
+
+		distrust, err := cr.Distrust(tx)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "\t- %s %s (%s)%s%s\n",
 			rel.Version, rel.Bundle,
-			time.Unix(rel.ReleasedAt, 0).UTC().Format(common.DateFormat))
+			time.Unix(rel.ReleasedAt, 0).UTC().Format(common.DateFormat),
+			describePurposes(purposes), describeDistrust(distrust))
 		if err != nil {
-			break
+			return err
 		}
 	}
 
-	return err
+	return nil
+}
+
+// describePurposes lists the purposes a certificate is trusted for in
+// a release; nothing is written if it is trusted for every purpose.
+func describePurposes(purposes []string) string {
+	if len(purposes) == 0 {
+		return ""
+	}
+	return " trusted for " + strings.Join(purposes, ", ")
+}
+
+// describeDistrust gives the date after which certificates issued
+// under a certificate are distrusted in a release, if any.
+func describeDistrust(d *certdb.Distrust) string {
+	if d == nil {
+		return ""
+	}
+
+	s := ", distrusted after " + d.Time().Format(common.DateFormat)
+	if d.Reason != "" {
+		s += " (" + d.Reason + ")"
+	}
+	return s
+}
+
+// releaseKey identifies a release in CertificateMetadata.Purposes.
+func releaseKey(rel *certdb.Release) string {
+	return rel.Bundle + "-" + rel.Version
 }
 
 // WriteCertificateInformation pretty prints details about the given certificate
@@ -69,7 +111,38 @@ func WriteCertificateInformation(w io.Writer, db *sql.DB, cert *certdb.Certifica
 		return err
 	}
 
-	return nil
+	platforms, err := certificatePlatforms(tx, cert)
+	if err != nil {
+		return err
+	}
+
+	return writePlatforms(w, "", platforms)
+}
+
+// certificatePlatforms lists the platform trust stores that contain
+// the certificate.
+func certificatePlatforms(tx *sql.Tx, cert *certdb.Certificate) ([]string, error) {
+	sources, err := cert.Sources(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []string
+	for _, src := range sources {
+		platforms = append(platforms, src.Platform)
+	}
+	return platforms, nil
+}
+
+// writePlatforms lists the platforms, if any, with the given
+// indentation.
+func writePlatforms(w io.Writer, indent string, platforms []string) error {
+	if len(platforms) == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "%sPlatforms: %s\n", indent, strings.Join(platforms, ", "))
+	return err
 }
 
 // CertificateMetadata pairs the AKI, SKI, and Serial Number with
@@ -80,7 +153,89 @@ type CertificateMetadata struct {
 	Subject  string
 	Issuer   string
 	Releases []*certdb.Release
-	cert     *certdb.Certificate
+
+	// Purposes lists the purposes the certificate is trusted for
+	// in each release, keyed by bundle-version (e.g.
+	// "ca-2025.1.0"); releases that trust the certificate for
+	// every purpose are left out.
+	Purposes map[string][]string
+
+	// Distrusts holds the partial distrust of the certificate in
+	// each release that records one, keyed like Purposes.
+	Distrusts map[string]*certdb.Distrust
+
+	// Platforms lists the platform trust stores that contain the
+	// certificate, as recorded by import-platforms.
+	Platforms []string
+	cert      *certdb.Certificate
+}
+
+// releaseRecord is the serialised form of a release in
+// CertificateMetadata; it extends certdb.Release's form with the
+// purposes the certificate is trusted for and its distrust date.
+type releaseRecord struct {
+	Bundle         string     `json:"bundle" yaml:"bundle"`
+	Version        string     `json:"version" yaml:"version"`
+	ReleasedAt     time.Time  `json:"released_at" yaml:"released_at"`
+	Purposes       []string   `json:"purposes,omitempty" yaml:"purposes,omitempty"`
+	DistrustAfter  *time.Time `json:"distrust_after,omitempty" yaml:"distrust_after,omitempty"`
+	DistrustReason string     `json:"distrust_reason,omitempty" yaml:"distrust_reason,omitempty"`
+}
+
+// certificateRecord is the serialised form of CertificateMetadata.
+type certificateRecord struct {
+	SKI       string           `json:"ski" yaml:"ski"`
+	AKI       string           `json:"aki" yaml:"aki"`
+	Serial    string           `json:"serial" yaml:"serial"`
+	Subject   string           `json:"subject" yaml:"subject"`
+	Issuer    string           `json:"issuer" yaml:"issuer"`
+	NotBefore time.Time        `json:"not_before" yaml:"not_before"`
+	NotAfter  time.Time        `json:"not_after" yaml:"not_after"`
+	Releases  []*releaseRecord `json:"releases" yaml:"releases"`
+	Platforms []string         `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+}
+
+func (cm *CertificateMetadata) record() *certificateRecord {
+	x509Cert := cm.cert.X509()
+	record := &certificateRecord{
+		SKI:       cm.SKI,
+		AKI:       cm.AKI,
+		Serial:    fmt.Sprintf("%x", cm.cert.Serial),
+		Subject:   cm.Subject,
+		Issuer:    cm.Issuer,
+		NotBefore: x509Cert.NotBefore.UTC(),
+		NotAfter:  x509Cert.NotAfter.UTC(),
+		Releases:  make([]*releaseRecord, 0, len(cm.Releases)),
+		Platforms: cm.Platforms,
+	}
+
+	for _, rel := range cm.Releases {
+		rr := &releaseRecord{
+			Bundle:     rel.Bundle,
+			Version:    rel.Version,
+			ReleasedAt: time.Unix(rel.ReleasedAt, 0).UTC(),
+			Purposes:   cm.Purposes[releaseKey(rel)],
+		}
+
+		if d := cm.Distrusts[releaseKey(rel)]; d != nil {
+			after := d.Time()
+			rr.DistrustAfter = &after
+			rr.DistrustReason = d.Reason
+		}
+		record.Releases = append(record.Releases, rr)
+	}
+	return record
+}
+
+// MarshalJSON encodes the metadata as an object; the serial number is
+// hex-encoded, and the validity period is given as RFC 3339 times.
+func (cm *CertificateMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cm.record())
+}
+
+// MarshalYAML encodes the metadata in the same form as MarshalJSON.
+func (cm *CertificateMetadata) MarshalYAML() (interface{}, error) {
+	return cm.record(), nil
 }
 
 // LoadCertificateMetadata returns the metadata for a given certificate.
@@ -97,7 +252,42 @@ func LoadCertificateMetadata(tx *sql.Tx, cert *certdb.Certificate) (*Certificate
 
 	var err error
 	cm.Releases, err = cert.Releases(tx)
-	return cm, err
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range cm.Releases {
+		cr := certdb.NewCertificateRelease(cert, rel)
+		purposes, err := cr.Purposes(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if purposes != nil {
+			if cm.Purposes == nil {
+				cm.Purposes = map[string][]string{}
+			}
+			cm.Purposes[releaseKey(rel)] = purposes
+		}
+
+		distrust, err := cr.Distrust(tx)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if cm.Distrusts == nil {
+			cm.Distrusts = map[string]*certdb.Distrust{}
+		}
+		cm.Distrusts[releaseKey(rel)] = distrust
+	}
+
+	cm.Platforms, err = certificatePlatforms(tx, cert)
+	if err != nil {
+		return nil, err
+	}
+	return cm, nil
 }
 
 // WriteCertificateMetadata pretty prints the certificate metadata to
@@ -123,13 +313,15 @@ Issuer: %s
 	}
 
 	for _, rel := range cert.Releases {
-		_, err = fmt.Fprintf(w, "\t\t- %s %s (%s)\n",
+		_, err = fmt.Fprintf(w, "\t\t- %s %s (%s)%s%s\n",
 			rel.Version, rel.Bundle,
-			time.Unix(rel.ReleasedAt, 0).UTC().Format(common.DateFormat))
+			time.Unix(rel.ReleasedAt, 0).UTC().Format(common.DateFormat),
+			describePurposes(cert.Purposes[releaseKey(rel)]),
+			describeDistrust(cert.Distrusts[releaseKey(rel)]))
 		if err != nil {
-			break
+			return err
 		}
 	}
 
-	return err
+	return writePlatforms(w, "\t", cert.Platforms)
 }
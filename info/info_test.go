@@ -3,6 +3,7 @@ package info
 import (
 	"bytes"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"strings"
 	"testing"
@@ -90,6 +91,17 @@ func TestWriteTestCert1(t *testing.T) {
 	mock.ExpectQuery("SELECT (.+) FROM root_releases (.+)").
 		WithArgs(release.Version).
 		WillReturnRows(sqlmock.NewRows(columns).AddRow(release.ReleasedAt))
+	mock.ExpectQuery("SELECT purpose FROM trust_purposes (.+)").
+		WithArgs(testCert1.SKI, testCert1.Serial, release.Bundle, release.Version).
+		WillReturnRows(sqlmock.NewRows([]string{"purpose"}).AddRow("emailProtection").AddRow("serverAuth"))
+	mock.ExpectQuery("SELECT distrust_after, reason FROM distrusts (.+)").
+		WithArgs(testCert1.SKI, testCert1.Serial, release.Bundle, release.Version).
+		WillReturnRows(sqlmock.NewRows([]string{"distrust_after", "reason"}).AddRow(1735689600, "test distrust"))
+	mock.ExpectQuery("SELECT ski, serial, platform, url FROM sources (.+)").
+		WithArgs(testCert1.SKI, testCert1.Serial).
+		WillReturnRows(sqlmock.NewRows([]string{"ski", "serial", "platform", "url"}).
+			AddRow(testCert1.SKI, testCert1.Serial, "nss", "certdata/trusted_roots/nss.pem").
+			AddRow(testCert1.SKI, testCert1.Serial, "osx", "certdata/trusted_roots/osx.pem"))
 	mock.ExpectCommit()
 
 	buf := &bytes.Buffer{}
@@ -108,7 +120,8 @@ Issuer: /C=US/OU=Dropsonde Certificate Authority/L=San Francisco/ST=California
 	Not Before: 2017-03-22T21:24:00+0000
 	Not After: 2018-03-22T21:24:00+0000
 Releases:
-	- 2017.3.0 ca (2017-03-29T22:47:36+0000)`
+	- 2017.3.0 ca (2017-03-29T22:47:36+0000) trusted for serverAuth, emailProtection, distrusted after 2025-01-01T00:00:00+0000 (test distrust)
+Platforms: nss, osx`
 	out := strings.TrimSpace(buf.String())
 
 	if out != expected {
@@ -121,3 +134,65 @@ have:
 `, expected, out)
 	}
 }
+
+func TestMarshalCertificateMetadata(t *testing.T) {
+	cm := &CertificateMetadata{
+		SKI:      testCert1.SKI,
+		AKI:      testCert1.AKI,
+		Serial:   testCert1X509.SerialNumber,
+		Subject:  "/C=US/O=Example Org/L=San Francisco",
+		Issuer:   "/C=US/OU=Dropsonde Certificate Authority/L=San Francisco/ST=California",
+		Releases: []*certdb.Release{release},
+		cert:     testCert1,
+	}
+
+	out, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"ski":"` + testCert1.SKI + `","aki":"` + testCert1.AKI + `",` +
+		`"serial":"13cf2eb3cb6be514455f8465a284ed0c329aa39a",` +
+		`"subject":"/C=US/O=Example Org/L=San Francisco",` +
+		`"issuer":"/C=US/OU=Dropsonde Certificate Authority/L=San Francisco/ST=California",` +
+		`"not_before":"2017-03-22T21:24:00Z","not_after":"2018-03-22T21:24:00Z",` +
+		`"releases":[{"bundle":"ca","version":"2017.3.0","released_at":"2017-03-29T22:47:36Z"}]}`
+	if string(out) != expected {
+		t.Fatalf("unexpected JSON:\nexpected: %s\nhave:     %s", expected, out)
+	}
+
+	cm.Purposes = map[string][]string{"ca-2017.3.0": {"serverAuth"}}
+	out, err = json.Marshal(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = strings.Replace(expected, `"released_at":"2017-03-29T22:47:36Z"}`,
+		`"released_at":"2017-03-29T22:47:36Z","purposes":["serverAuth"]}`, 1)
+	if string(out) != expected {
+		t.Fatalf("unexpected JSON:\nexpected: %s\nhave:     %s", expected, out)
+	}
+
+	cm.Distrusts = map[string]*certdb.Distrust{"ca-2017.3.0": {DistrustAfter: 1735689600, Reason: "test distrust"}}
+	out, err = json.Marshal(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = strings.Replace(expected, `"purposes":["serverAuth"]}`,
+		`"purposes":["serverAuth"],"distrust_after":"2025-01-01T00:00:00Z","distrust_reason":"test distrust"}`, 1)
+	if string(out) != expected {
+		t.Fatalf("unexpected JSON:\nexpected: %s\nhave:     %s", expected, out)
+	}
+
+	cm.Platforms = []string{"nss", "osx"}
+	out, err = json.Marshal(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = strings.TrimSuffix(expected, "}") + `,"platforms":["nss","osx"]}`
+	if string(out) != expected {
+		t.Fatalf("unexpected JSON:\nexpected: %s\nhave:     %s", expected, out)
+	}
+}
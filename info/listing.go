@@ -0,0 +1,311 @@
+package info
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// keyUsages lists the names of the key usages in the order they're
+// listed.
+var keyUsages = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digital signature"},
+	{x509.KeyUsageContentCommitment, "content commitment"},
+	{x509.KeyUsageKeyEncipherment, "key encipherment"},
+	{x509.KeyUsageDataEncipherment, "data encipherment"},
+	{x509.KeyUsageKeyAgreement, "key agreement"},
+	{x509.KeyUsageCertSign, "cert sign"},
+	{x509.KeyUsageCRLSign, "CRL sign"},
+	{x509.KeyUsageEncipherOnly, "encipher only"},
+	{x509.KeyUsageDecipherOnly, "decipher only"},
+}
+
+var extKeyUsages = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "server auth",
+	x509.ExtKeyUsageClientAuth:                     "client auth",
+	x509.ExtKeyUsageCodeSigning:                    "code signing",
+	x509.ExtKeyUsageEmailProtection:                "email protection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "IPSec end system",
+	x509.ExtKeyUsageIPSECTunnel:                    "IPSec tunnel",
+	x509.ExtKeyUsageIPSECUser:                      "IPSec user",
+	x509.ExtKeyUsageTimeStamping:                   "time stamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSP signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "Microsoft server gated crypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "Netscape server gated crypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "Microsoft commercial code signing",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "Microsoft kernel code signing",
+}
+
+var extensionNames = map[string]string{
+	"1.3.6.1.5.5.7.1.1": "authority info access",
+	"2.5.29.14":         "subject key identifier",
+	"2.5.29.15":         "key usage",
+	"2.5.29.17":         "subject alt name",
+	"2.5.29.18":         "issuer alt name",
+	"2.5.29.19":         "basic constraints",
+	"2.5.29.30":         "name constraints",
+	"2.5.29.31":         "CRL distribution points",
+	"2.5.29.32":         "certificate policies",
+	"2.5.29.35":         "authority key identifier",
+	"2.5.29.37":         "extended key usage",
+}
+
+// PublicKeyDescription describes the algorithm and size of a public
+// key, e.g. "RSA-2048" or "ECDSA-P256".
+func PublicKeyDescription(cert *x509.Certificate) string {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + strings.Replace(pub.Curve.Params().Name, "-", "", -1)
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA-%d", pub.P.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return "unknown " + cert.PublicKeyAlgorithm.String()
+	}
+}
+
+// legacySignatureAlgorithms names the signature algorithms that
+// crypto/x509 doesn't recognise but that appear in old roots.
+var legacySignatureAlgorithms = map[string]string{
+	"1.2.840.113549.1.1.2": "MD2-RSA",
+	"1.2.840.113549.1.1.3": "MD4-RSA",
+}
+
+// SignatureAlgorithmDescription names the algorithm the certificate
+// was signed with, falling back to its OID if it isn't known.
+func SignatureAlgorithmDescription(cert *x509.Certificate) string {
+	if cert.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		return cert.SignatureAlgorithm.String()
+	}
+
+	var outer struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}
+
+	_, err := asn1.Unmarshal(cert.Raw, &outer)
+	if err != nil {
+		return "unknown"
+	}
+
+	oid := outer.Algorithm.Algorithm.String()
+	if name, ok := legacySignatureAlgorithms[oid]; ok {
+		return name
+	}
+	return "unknown (" + oid + ")"
+}
+
+func fingerprint(sum []byte) string {
+	hex := make([]string, len(sum))
+	for i := range sum {
+		hex[i] = fmt.Sprintf("%02X", sum[i])
+	}
+	return strings.Join(hex, ":")
+}
+
+func basicConstraints(cert *x509.Certificate) string {
+	switch {
+	case !cert.BasicConstraintsValid:
+		return "absent"
+	case !cert.IsCA:
+		return "not a CA"
+	case cert.MaxPathLen > 0 || cert.MaxPathLenZero:
+		return fmt.Sprintf("CA, path length %d", cert.MaxPathLen)
+	default:
+		return "CA"
+	}
+}
+
+func keyUsage(cert *x509.Certificate) string {
+	var usages []string
+	for _, ku := range keyUsages {
+		if cert.KeyUsage&ku.usage != 0 {
+			usages = append(usages, ku.name)
+		}
+	}
+	return strings.Join(usages, ", ")
+}
+
+func extKeyUsage(cert *x509.Certificate) string {
+	var usages []string
+	for _, eku := range cert.ExtKeyUsage {
+		name, ok := extKeyUsages[eku]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", eku)
+		}
+		usages = append(usages, name)
+	}
+
+	for _, oid := range cert.UnknownExtKeyUsage {
+		usages = append(usages, oid.String())
+	}
+	return strings.Join(usages, ", ")
+}
+
+func nameConstraints(cert *x509.Certificate) []string {
+	var constraints []string
+	add := func(kind string, names []string) {
+		if len(names) > 0 {
+			constraints = append(constraints, kind+": "+strings.Join(names, ", "))
+		}
+	}
+
+	add("permitted DNS", cert.PermittedDNSDomains)
+	add("excluded DNS", cert.ExcludedDNSDomains)
+	add("permitted email", cert.PermittedEmailAddresses)
+	add("excluded email", cert.ExcludedEmailAddresses)
+	add("permitted URI", cert.PermittedURIDomains)
+	add("excluded URI", cert.ExcludedURIDomains)
+
+	var permitted, excluded []string
+	for _, ip := range cert.PermittedIPRanges {
+		permitted = append(permitted, ip.String())
+	}
+	for _, ip := range cert.ExcludedIPRanges {
+		excluded = append(excluded, ip.String())
+	}
+	add("permitted IP", permitted)
+	add("excluded IP", excluded)
+	return constraints
+}
+
+func writeList(buf *bytes.Buffer, label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "\t%s:\n", label)
+	for _, item := range items {
+		fmt.Fprintf(buf, "\t\t- %s\n", item)
+	}
+}
+
+func writeListingEntry(buf *bytes.Buffer, cert *certdb.Certificate) {
+	x509Cert := cert.X509()
+	sha1Sum := sha1.Sum(x509Cert.Raw)
+	sha256Sum := sha256.Sum256(x509Cert.Raw)
+
+	fmt.Fprintf(buf, "Subject: %s\n", common.NameToString(x509Cert.Subject))
+	fmt.Fprintf(buf, "Issuer: %s\n", common.NameToString(x509Cert.Issuer))
+	fmt.Fprintf(buf, "\tSerial number: %s (0x%x)\n", x509Cert.SerialNumber, x509Cert.SerialNumber)
+	fmt.Fprintf(buf, "\tValid from: %s\n", x509Cert.NotBefore.UTC().Format(common.DateFormat))
+	fmt.Fprintf(buf, "\t     until: %s\n", x509Cert.NotAfter.UTC().Format(common.DateFormat))
+	fmt.Fprintf(buf, "\tPublic key: %s\n", PublicKeyDescription(x509Cert))
+	fmt.Fprintf(buf, "\tSignature algorithm: %s\n", SignatureAlgorithmDescription(x509Cert))
+
+	if len(x509Cert.SubjectKeyId) == 0 {
+		fmt.Fprintf(buf, "\tSKI: %s (computed)\n", cert.SKI)
+	} else {
+		fmt.Fprintf(buf, "\tSKI: %s\n", cert.SKI)
+	}
+
+	if cert.AKI != "" {
+		fmt.Fprintf(buf, "\tAKI: %s\n", cert.AKI)
+	}
+
+	fmt.Fprintf(buf, "\tSHA-1 fingerprint: %s\n", fingerprint(sha1Sum[:]))
+	fmt.Fprintf(buf, "\tSHA-256 fingerprint: %s\n", fingerprint(sha256Sum[:]))
+	fmt.Fprintf(buf, "\tBasic constraints: %s\n", basicConstraints(x509Cert))
+
+	if usage := keyUsage(x509Cert); usage != "" {
+		fmt.Fprintf(buf, "\tKey usage: %s\n", usage)
+	}
+
+	if usage := extKeyUsage(x509Cert); usage != "" {
+		fmt.Fprintf(buf, "\tExtended key usage: %s\n", usage)
+	}
+
+	writeList(buf, "Name constraints", nameConstraints(x509Cert))
+
+	var policies []string
+	for _, oid := range x509Cert.PolicyIdentifiers {
+		policies = append(policies, oid.String())
+	}
+	writeList(buf, "Policies", policies)
+	writeList(buf, "Issuer URLs", x509Cert.IssuingCertificateURL)
+	writeList(buf, "OCSP servers", x509Cert.OCSPServer)
+	writeList(buf, "CRL distribution points", x509Cert.CRLDistributionPoints)
+
+	var extensions []string
+	for _, ext := range x509Cert.Extensions {
+		desc := ext.Id.String()
+		if name, ok := extensionNames[desc]; ok {
+			desc += " (" + name + ")"
+		}
+
+		if ext.Critical {
+			desc += ", critical"
+		}
+		extensions = append(extensions, desc)
+	}
+	writeList(buf, "Extensions", extensions)
+}
+
+// WriteListing writes a human-readable listing of the certificates,
+// under the given name, to the given io.Writer. The listing depends
+// only on the certificates and their order, so listing the same
+// bundle always produces the same output.
+func WriteListing(w io.Writer, name string, certs []*certdb.Certificate) error {
+	var buf = &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s: %d certificates\n", name, len(certs))
+	for i, cert := range certs {
+		fmt.Fprintf(buf, "\nCertificate %d of %d\n", i+1, len(certs))
+		writeListingEntry(buf, cert)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ListBundle returns the listing of a PEM bundle.
+func ListBundle(name string, pemBundle []byte) ([]byte, error) {
+	var certs []*certdb.Certificate
+	for {
+		var p *pem.Block
+		p, pemBundle = pem.Decode(pemBundle)
+		if p == nil {
+			break
+		}
+
+		if p.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, certdb.NewCertificate(cert))
+	}
+
+	if len(bytes.TrimSpace(pemBundle)) != 0 {
+		return nil, errors.New("info: " + name + " contains trailing data that isn't PEM-encoded")
+	}
+
+	var buf = &bytes.Buffer{}
+	err := WriteListing(buf, name, certs)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,54 @@
+package info
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListBundle(t *testing.T) {
+	listing, err := ListBundle("test.pem", []byte(testCert1PEM+"\n"+testCert1PEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Certificate 1 of 2
+Subject: /C=US/O=Example Org/L=San Francisco
+Issuer: /C=US/OU=Dropsonde Certificate Authority/L=San Francisco/ST=California
+	Serial number: 113091147247838834956091906135314955440509068186 (0x13cf2eb3cb6be514455f8465a284ed0c329aa39a)
+	Valid from: 2017-03-22T21:24:00+0000
+	     until: 2018-03-22T21:24:00+0000
+	Public key: RSA-2048
+	Signature algorithm: SHA512-RSA
+	SKI: 383781674f6e197820d18331d53f4428a0d4fad7
+	AKI: 9b3b73eff7dc40e4a22a7b10e9d4ad4d5d0cec3d
+	SHA-1 fingerprint: 88:B1:31:17:DA:E0:7A:54:FF:88:32:9B:83:9E:03:BA:62:86:AF:38
+	SHA-256 fingerprint: CD:E5:D4:1A:55:C8:65:F8:38:D2:17:6D:92:1A:C4:B3:19:20:68:6D:2B:40:CC:84:60:18:43:96:ED:FD:3E:C7
+	Basic constraints: not a CA
+	Key usage: digital signature, key encipherment
+	Extended key usage: server auth
+	Extensions:
+		- 2.5.29.15 (key usage), critical
+		- 2.5.29.37 (extended key usage)
+		- 2.5.29.19 (basic constraints), critical
+		- 2.5.29.14 (subject key identifier)
+		- 2.5.29.35 (authority key identifier)
+		- 2.5.29.17 (subject alt name)`
+
+	if !strings.HasPrefix(string(listing), "test.pem: 2 certificates\n\n"+expected+"\n\nCertificate 2 of 2\n") {
+		t.Fatalf("listing contains unexpected information:\n%s", listing)
+	}
+
+	again, err := ListBundle("test.pem", []byte(testCert1PEM+"\n"+testCert1PEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(again) != string(listing) {
+		t.Fatal("listing the same bundle twice should produce the same output")
+	}
+
+	_, err = ListBundle("test.pem", []byte(testCert1PEM+"\ntrailing garbage"))
+	if err == nil {
+		t.Fatal("listing a bundle with trailing data should fail")
+	}
+}
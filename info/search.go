@@ -121,13 +121,33 @@ func FilterByBundle(bundle string) (CertificateFilter, error) {
 	}, nil
 }
 
+// FilterByPlatform is a CertificateFilter that returns true if one
+// of the platform trust stores containing the certificate matches the
+// regular expression passed in.
+func FilterByPlatform(platform string) (CertificateFilter, error) {
+	platformFilter, err := regexp.Compile(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(cm *CertificateMetadata) bool {
+		for _, p := range cm.Platforms {
+			if platformFilter.MatchString(p) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
 var filters = map[string]func(string) (CertificateFilter, error){
-	"ski":     FilterBySKI,
-	"aki":     FilterByAKI,
-	"subject": FilterBySubject,
-	"issuer":  FilterByIssuer,
-	"release": FilterByRelease,
-	"bundle":  FilterByBundle,
+	"ski":      FilterBySKI,
+	"aki":      FilterByAKI,
+	"subject":  FilterBySubject,
+	"issuer":   FilterByIssuer,
+	"release":  FilterByRelease,
+	"bundle":   FilterByBundle,
+	"platform": FilterByPlatform,
 }
 
 // ParseQuery attempts to parse a query in the form "type:regexp",
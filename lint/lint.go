@@ -0,0 +1,219 @@
+// Package lint checks that certificates are fit to be shipped in the
+// ca or int bundle: that they are CA certificates that may sign
+// certificates, with strong keys and signatures, and currently valid.
+package lint
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// These are the severities of findings. Certificates with errors
+// shouldn't be imported; warnings are worth a look.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// These are the checks run on each certificate.
+const (
+	CheckBasicConstraints = "basic-constraints"
+	CheckKeyUsage         = "key-usage"
+	CheckKey              = "key"
+	CheckSignature        = "signature-algorithm"
+	CheckValidity         = "validity"
+	CheckSelfSigned       = "self-signed"
+)
+
+// minRSABits is the smallest RSA key accepted.
+const minRSABits = 2048
+
+// A Finding is a problem found by a check.
+type Finding struct {
+	Severity string `json:"severity" yaml:"severity"`
+	Check    string `json:"check" yaml:"check"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// A Result lists the findings for a certificate.
+type Result struct {
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+	Findings    []*Finding        `json:"findings" yaml:"findings"`
+}
+
+func (result *Result) add(severity, check, format string, args ...interface{}) {
+	result.Findings = append(result.Findings, &Finding{
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Errors returns the number of errors found.
+func (result *Result) Errors() int {
+	var count int
+	for _, finding := range result.Findings {
+		if finding.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// lintBasicConstraints checks that the certificate is marked as a CA.
+// Old v1 roots predate the extension, so its absence is only a warning
+// on self-signed certificates.
+func lintBasicConstraints(result *Result, cert *x509.Certificate, selfSigned bool) {
+	if !cert.BasicConstraintsValid {
+		if selfSigned {
+			result.add(SeverityWarning, CheckBasicConstraints, "no basicConstraints extension")
+		} else {
+			result.add(SeverityError, CheckBasicConstraints, "no basicConstraints extension; this isn't a CA certificate")
+		}
+	} else if !cert.IsCA {
+		result.add(SeverityError, CheckBasicConstraints, "basicConstraints doesn't mark this as a CA certificate")
+	}
+}
+
+func lintKeyUsage(result *Result, cert *x509.Certificate) {
+	if cert.KeyUsage == 0 {
+		result.add(SeverityWarning, CheckKeyUsage, "no keyUsage extension")
+	} else if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		result.add(SeverityError, CheckKeyUsage, "keyUsage doesn't allow certificate signing")
+	}
+}
+
+func lintKey(result *Result, cert *x509.Certificate) {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := pub.N.BitLen(); bits < minRSABits {
+			result.add(SeverityError, CheckKey, "%d-bit RSA key; at least %d bits are required", bits, minRSABits)
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384():
+		case elliptic.P521():
+			result.add(SeverityWarning, CheckKey, "P-521 keys aren't supported by every platform")
+		default:
+			result.add(SeverityError, CheckKey, "unsupported curve %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		result.add(SeverityWarning, CheckKey, "Ed25519 keys aren't supported by every platform")
+	default:
+		result.add(SeverityError, CheckKey, "unsupported %s key", cert.PublicKeyAlgorithm)
+	}
+}
+
+// lintSignature checks the signature algorithm. The signature on a
+// self-signed root isn't relied on, so weak ones are only warnings
+// there. crypto/x509 doesn't recognise the MD2 and MD4 signatures on
+// some old roots, so unknown algorithms are named from their OID.
+func lintSignature(result *Result, cert *x509.Certificate, selfSigned bool) {
+	var weak bool
+	name := cert.SignatureAlgorithm.String()
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		weak = true
+	case x509.UnknownSignatureAlgorithm:
+		name = info.SignatureAlgorithmDescription(cert)
+		if strings.HasPrefix(name, "unknown") {
+			result.add(SeverityError, CheckSignature, "unknown signature algorithm")
+			return
+		}
+		weak = true
+	}
+
+	if !weak {
+		return
+	}
+
+	severity := SeverityError
+	if selfSigned {
+		severity = SeverityWarning
+	}
+	result.add(severity, CheckSignature, "weak signature algorithm %s", name)
+}
+
+func lintValidity(result *Result, cert *x509.Certificate, when time.Time) {
+	switch {
+	case !cert.NotAfter.After(cert.NotBefore):
+		result.add(SeverityError, CheckValidity, "the certificate expires before it becomes valid")
+	case !cert.NotAfter.After(when):
+		result.add(SeverityError, CheckValidity, "expired at %s", cert.NotAfter.UTC().Format(common.DateFormat))
+	case cert.NotBefore.After(when):
+		result.add(SeverityWarning, CheckValidity, "not valid until %s", cert.NotBefore.UTC().Format(common.DateFormat))
+	}
+}
+
+// lintSelfSigned checks that roots are self-signed, and that
+// intermediates aren't.
+func lintSelfSigned(result *Result, bundle string, selfSigned bool) {
+	if bundle == "ca" && !selfSigned {
+		result.add(SeverityError, CheckSelfSigned, "roots in the ca bundle must be self-signed")
+	} else if bundle == "int" && selfSigned {
+		result.add(SeverityWarning, CheckSelfSigned, "self-signed certificate in the int bundle")
+	}
+}
+
+// isSelfSigned returns true if the certificate signed itself. Weak or
+// unknown signature algorithms can't be checked, so the names alone
+// decide; lintSignature reports them.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+
+	err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	_, insecure := err.(x509.InsecureAlgorithmError)
+	return err == nil || insecure || err == x509.ErrUnsupportedAlgorithm
+}
+
+// Certificate lints a certificate destined for the bundle, as of the
+// given time.
+func Certificate(cert *x509.Certificate, bundle string, when time.Time) *Result {
+	result := &Result{
+		Certificate: diff.NewCertificate(certdb.NewCertificate(cert)),
+		Findings:    []*Finding{},
+	}
+
+	selfSigned := isSelfSigned(cert)
+	lintBasicConstraints(result, cert, selfSigned)
+	lintKeyUsage(result, cert)
+	lintKey(result, cert)
+	lintSignature(result, cert, selfSigned)
+	lintValidity(result, cert, when)
+	lintSelfSigned(result, bundle, selfSigned)
+	return result
+}
+
+// Release lints each of the certificates in a release. Only the
+// certificates with findings are returned.
+func Release(tx *sql.Tx, rel *certdb.Release, when time.Time) ([]*Result, error) {
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
+	for _, cert := range certs {
+		result := Certificate(cert.X509(), rel.Bundle, when)
+		if len(result.Findings) > 0 {
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,201 @@
+package lint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// checks returns the checks that reported errors and warnings.
+func checks(result *Result) (errors, warnings map[string]bool) {
+	errors = map[string]bool{}
+	warnings = map[string]bool{}
+	for _, finding := range result.Findings {
+		if finding.Severity == SeverityError {
+			errors[finding.Check] = true
+		} else {
+			warnings[finding.Check] = true
+		}
+	}
+	return errors, warnings
+}
+
+// newSelfSigned returns a self-signed RSA certificate with a key of
+// the given size, modified by the options.
+func newSelfSigned(t *testing.T, bits int, opts ...certdbtest.Option) *x509.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "weak"},
+		NotBefore:             date(2017, 1, 1),
+		NotAfter:              date(2035, 1, 1),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// withMD2 rewrites a certificate's signature algorithm, inside and
+// outside the TBSCertificate, from SHA-256 with RSA to MD2 with RSA,
+// which crypto/x509 doesn't recognise.
+func withMD2(t *testing.T, cert *x509.Certificate) *x509.Certificate {
+	sha256WithRSA := []byte{0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x0b}
+	md2WithRSA := []byte{0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x02}
+
+	der := bytes.Replace(cert.Raw, sha256WithRSA, md2WithRSA, -1)
+	md2, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	} else if md2.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		t.Fatalf("expected an unknown signature algorithm, but have %s", md2.SignatureAlgorithm)
+	}
+	return md2
+}
+
+func TestCertificate(t *testing.T) {
+	root, err := certdbtest.NewRoot("root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := root.Issue("intermediate", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := root.Issue("expired", date(2017, 1, 1), date(2019, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := intermediate.Issue("leaf", date(2020, 1, 1), date(2021, 1, 1), func(template *x509.Certificate) {
+		template.IsCA = false
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// v1 roots have no basicConstraints extension.
+	noBasicConstraints := func(template *x509.Certificate) {
+		template.BasicConstraintsValid = false
+		template.IsCA = false
+	}
+
+	unconstrained, err := root.Issue("unconstrained", date(2017, 1, 1), date(2030, 1, 1), noBasicConstraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := date(2020, 6, 1)
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		bundle   string
+		errors   []string
+		warnings []string
+	}{
+		{"root", root.Cert, "ca", nil, nil},
+		{"intermediate", intermediate.Cert, "int", nil, nil},
+		{"root in the int bundle", root.Cert, "int", nil, []string{CheckSelfSigned}},
+		{"intermediate in the ca bundle", intermediate.Cert, "ca", []string{CheckSelfSigned}, nil},
+		{"expired", expired.Cert, "int", []string{CheckValidity}, nil},
+		{"leaf", leaf.Cert, "int", []string{CheckBasicConstraints, CheckKeyUsage}, nil},
+		{"weak root", newSelfSigned(t, 1024), "ca", []string{CheckKey}, nil},
+		{"MD2 root", withMD2(t, newSelfSigned(t, 2048)), "ca", nil, []string{CheckSignature}},
+		{"v1 root", newSelfSigned(t, 2048, noBasicConstraints), "ca", nil, []string{CheckBasicConstraints}},
+		{"intermediate without basicConstraints", unconstrained.Cert, "int", []string{CheckBasicConstraints}, nil},
+	}
+
+	for _, test := range tests {
+		result := Certificate(test.cert, test.bundle, when)
+		errors, warnings := checks(result)
+		if len(errors) != len(test.errors) || len(warnings) != len(test.warnings) {
+			t.Fatalf("%s: expected errors %v and warnings %v, but have %+v", test.name, test.errors, test.warnings, result.Findings)
+		}
+
+		for _, check := range test.errors {
+			if !errors[check] {
+				t.Fatalf("%s: expected a %s error, but have %+v", test.name, check, result.Findings)
+			}
+		}
+
+		for _, check := range test.warnings {
+			if !warnings[check] {
+				t.Fatalf("%s: expected a %s warning, but have %+v", test.name, check, result.Findings)
+			}
+		}
+
+		if (result.Errors() > 0) != (len(test.errors) > 0) {
+			t.Fatalf("%s: Errors returned %d", test.name, result.Errors())
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediate, err := root.Issue("intermediate", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), root.Cert, intermediate.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	results, err := Release(tx, rel, date(2020, 6, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Certificate.Subject != "/intermediate/O=cfssl_trust test" {
+		t.Fatalf("expected only the intermediate to have findings, but have %d results", len(results))
+	}
+}
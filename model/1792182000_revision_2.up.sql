@@ -0,0 +1,24 @@
+-- Schema version 2: created 2026-10-16T20:20:00+0000.
+INSERT INTO schema_version (revision, created_at)
+	SELECT 2, 1792182000
+	WHERE NOT EXISTS (SELECT 1 FROM schema_version
+				WHERE revision = 2);
+
+-- audit_log records every change made to the database: which
+-- operation was performed, on which certificate and release, by whom,
+-- and when. Fields that don't apply to an operation are left empty;
+-- for example, a revocation applies to an SKI rather than a release.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id		INTEGER PRIMARY KEY AUTOINCREMENT,
+	operation	TEXT NOT NULL,
+	bundle		TEXT NOT NULL,
+	release		TEXT NOT NULL,
+	ski		TEXT NOT NULL,
+	serial		BLOB,
+	actor		TEXT NOT NULL,
+	logged_at	INTEGER NOT NULL,
+	note		TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_ski ON audit_log (ski);
+CREATE INDEX IF NOT EXISTS audit_log_logged_at ON audit_log (logged_at);
@@ -0,0 +1,25 @@
+-- Schema version 3: created 2026-10-16T20:45:00+0000.
+INSERT INTO schema_version (revision, created_at)
+	SELECT 3, 1792183500
+	WHERE NOT EXISTS (SELECT 1 FROM schema_version
+				WHERE revision = 3);
+
+-- nss_trust records the trust Mozilla's NSS assigns to a certificate
+-- in its certdata.txt, for each purpose NSS tracks. The trust columns
+-- hold the NSS trust level without its CKT_NSS_ prefix, in lowercase
+-- with dashes (for example, trusted-delegator or not-trusted). The
+-- distrust_after columns hold the time after which NSS no longer
+-- trusts certificates issued under the certificate for the purpose,
+-- or 0 if there is no such limit.
+CREATE TABLE IF NOT EXISTS nss_trust (
+	ski			TEXT NOT NULL,
+	serial			BLOB NOT NULL,
+	label			TEXT NOT NULL,
+	server_auth		TEXT NOT NULL,
+	email_protection	TEXT NOT NULL,
+	code_signing		TEXT NOT NULL,
+	server_distrust_after	INTEGER NOT NULL,
+	email_distrust_after	INTEGER NOT NULL,
+	UNIQUE(ski, serial),
+	FOREIGN KEY (ski) REFERENCES certificates(ski)
+);
@@ -0,0 +1,21 @@
+-- Schema version 4: created 2026-10-16T21:00:00+0000.
+INSERT INTO schema_version (revision, created_at)
+	SELECT 4, 1792184400
+	WHERE NOT EXISTS (SELECT 1 FROM schema_version
+				WHERE revision = 4);
+
+-- trust_purposes lists the purposes a certificate is trusted for in a
+-- release, named after the matching extended key usages (serverAuth,
+-- emailProtection, and so on). A certificate with no purposes listed
+-- for a release is trusted for every purpose, as all certificates were
+-- before purposes were recorded.
+CREATE TABLE IF NOT EXISTS trust_purposes (
+	ski		TEXT NOT NULL,
+	serial		BLOB NOT NULL,
+	bundle		TEXT NOT NULL,
+	release		TEXT NOT NULL,
+	purpose		TEXT NOT NULL,
+	UNIQUE(ski, serial, bundle, release, purpose)
+);
+
+CREATE INDEX IF NOT EXISTS trust_purposes_release ON trust_purposes (bundle, release);
@@ -0,0 +1,21 @@
+-- Schema version 5: created 2026-10-16T21:15:00+0000.
+INSERT INTO schema_version (revision, created_at)
+	SELECT 5, 1792185300
+	WHERE NOT EXISTS (SELECT 1 FROM schema_version
+				WHERE revision = 5);
+
+-- distrusts records partial distrust of a certificate in a release:
+-- certificates issued under it after distrust_after are no longer
+-- trusted, while those issued before remain trusted. Unlike a
+-- revocation, which removes a certificate from future releases, a
+-- partially distrusted certificate is carried into new releases along
+-- with its distrust date.
+CREATE TABLE IF NOT EXISTS distrusts (
+	ski		TEXT NOT NULL,
+	serial		BLOB NOT NULL,
+	bundle		TEXT NOT NULL,
+	release		TEXT NOT NULL,
+	distrust_after	INTEGER NOT NULL,
+	reason		TEXT NOT NULL,
+	UNIQUE(ski, serial, bundle, release)
+);
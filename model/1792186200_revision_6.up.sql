@@ -0,0 +1,16 @@
+-- Schema version 6: created 2026-10-16T21:30:00+0000.
+INSERT INTO schema_version (revision, created_at)
+	SELECT 6, 1792186200
+	WHERE NOT EXISTS (SELECT 1 FROM schema_version
+				WHERE revision = 6);
+
+-- sources records where a certificate was found. Nothing wrote to it
+-- before this revision. It now records the platform trust stores
+-- (nss, osx, windows, and so on) that contain each certificate: the
+-- platform is named after its keystore, the url is the keystore's
+-- path, and the serial number picks out the certificate among those
+-- sharing its SKI.
+ALTER TABLE sources ADD COLUMN serial BLOB NOT NULL DEFAULT x'';
+ALTER TABLE sources ADD COLUMN platform TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS sources_platform ON sources (ski, serial, platform);
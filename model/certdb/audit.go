@@ -0,0 +1,194 @@
+package certdb
+
+import (
+	"database/sql"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// These are the operations recorded in the audit log.
+const (
+	AuditImport          = "import"
+	AuditAddAIA          = "add-aia"
+	AuditCreateRelease   = "create-release"
+	AuditAdd             = "add"
+	AuditSetPurposes     = "set-purposes"
+	AuditRevoke          = "revoke"
+	AuditAmendRevocation = "amend-revocation"
+	AuditUnrevoke        = "unrevoke"
+	AuditDistrust        = "distrust"
+	AuditAmendDistrust   = "amend-distrust"
+	AuditUndistrust      = "undistrust"
+	AuditSetTrust        = "set-trust"
+	AuditAmendTrust      = "amend-trust"
+	AuditDeleteTrust     = "delete-trust"
+	AuditAddSource       = "add-source"
+	AuditRemoveSource    = "remove-source"
+	AuditRemove          = "remove"
+	AuditDelete          = "delete"
+	AuditDeleteAIA       = "delete-aia"
+)
+
+var (
+	// AuditActor is recorded as the actor for every audit log
+	// entry. It defaults to the current user.
+	AuditActor = defaultAuditActor()
+
+	// AuditNote is a free-form note recorded with every audit
+	// log entry, such as a ticket reference for the change.
+	AuditNote string
+)
+
+func defaultAuditActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+
+	return "unknown"
+}
+
+// AuditEntry models the audit_log table.
+type AuditEntry struct {
+	ID        int64
+	Operation string
+	Bundle    string
+	Release   string
+	SKI       string
+	Serial    []byte
+	Actor     string
+	LoggedAt  int64
+	Note      string
+}
+
+// Insert stores the AuditEntry in the database. The ID is assigned
+// by the database.
+func (entry *AuditEntry) Insert(tx *sql.Tx) error {
+	res, err := tx.Exec(`INSERT INTO audit_log (operation, bundle, release, ski, serial, actor, logged_at, note) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Operation, entry.Bundle, entry.Release, entry.SKI, entry.Serial,
+		entry.Actor, entry.LoggedAt, entry.Note)
+	if err != nil {
+		return err
+	}
+
+	entry.ID, err = res.LastInsertId()
+	return err
+}
+
+// audit records an operation in the audit log, filling in the actor,
+// timestamp, and note. The note passed in describes the operation
+// itself; AuditNote is appended to it.
+func audit(tx *sql.Tx, operation, bundle, release, ski string, serial []byte, note string) error {
+	var notes []string
+	if note != "" {
+		notes = append(notes, note)
+	}
+	if AuditNote != "" {
+		notes = append(notes, AuditNote)
+	}
+
+	entry := &AuditEntry{
+		Operation: operation,
+		Bundle:    bundle,
+		Release:   release,
+		SKI:       ski,
+		Serial:    serial,
+		Actor:     AuditActor,
+		LoggedAt:  time.Now().Unix(),
+		Note:      strings.Join(notes, "; "),
+	}
+	return entry.Insert(tx)
+}
+
+// An AuditFilter selects entries from the audit log. Empty fields
+// match any entry; Since and Until are inclusive bounds on the time
+// the entry was logged.
+type AuditFilter struct {
+	Bundle  string
+	Release string
+	SKI     string
+	Serial  []byte
+	Since   int64
+	Until   int64
+}
+
+// QueryAuditLog returns the audit log entries matching the filter,
+// oldest first.
+func QueryAuditLog(tx *sql.Tx, filter *AuditFilter) ([]*AuditEntry, error) {
+	var clauses []string
+	var args []interface{}
+
+	if filter.Bundle != "" {
+		clauses = append(clauses, "bundle=?")
+		args = append(args, filter.Bundle)
+	}
+
+	if filter.Release != "" {
+		clauses = append(clauses, "release=?")
+		args = append(args, filter.Release)
+	}
+
+	if filter.SKI != "" {
+		clauses = append(clauses, "ski=?")
+		args = append(args, filter.SKI)
+	}
+
+	if filter.Serial != nil {
+		clauses = append(clauses, "serial=?")
+		args = append(args, filter.Serial)
+	}
+
+	if filter.Since != 0 {
+		clauses = append(clauses, "logged_at >= ?")
+		args = append(args, filter.Since)
+	}
+
+	if filter.Until != 0 {
+		clauses = append(clauses, "logged_at <= ?")
+		args = append(args, filter.Until)
+	}
+
+	query := `SELECT id, operation, bundle, release, ski, serial, actor, logged_at, note FROM audit_log`
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		entry := &AuditEntry{}
+		err = rows.Scan(&entry.ID, &entry.Operation, &entry.Bundle,
+			&entry.Release, &entry.SKI, &entry.Serial, &entry.Actor,
+			&entry.LoggedAt, &entry.Note)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// auditDeleted records a delete operation in the audit log if it
+// removed any rows; deleting something that isn't present isn't a
+// change worth recording.
+func auditDeleted(tx *sql.Tx, res sql.Result, operation, bundle, release, ski string, serial []byte, note string) error {
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return err
+	}
+
+	return audit(tx, operation, bundle, release, ski, serial, note)
+}
@@ -0,0 +1,103 @@
+package certdb
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAuditLog makes a series of changes to the database and checks
+// that each of them was recorded in the audit log. The transaction is
+// rolled back so that the database is left as it was.
+func TestAuditLog(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	AuditActor = "tester"
+	AuditNote = "TICKET-1"
+	defer func() {
+		AuditActor = defaultAuditActor()
+		AuditNote = ""
+	}()
+
+	start := time.Now().Unix()
+	rel, err := NewRelease("ca", "2000.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Ensure(rel, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := NewCertificate(testCert1)
+	_, err = Ensure(cert, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Ensure(NewCertificateRelease(cert, rel), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cert.Revoke(tx, "test", "audit", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cert.Unrevoke(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = cert.Remove(tx, "ca", rel.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := QueryAuditLog(tx, &AuditFilter{SKI: cert.SKI, Since: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{AuditImport, AuditAdd, AuditRevoke, AuditUnrevoke, AuditRemove, AuditDelete}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d audit log entries, but have %d", len(expected), len(entries))
+	}
+
+	for i, entry := range entries {
+		if entry.Operation != expected[i] {
+			t.Fatalf("expected audit log entry %d to be %s, but have %s", i, expected[i], entry.Operation)
+		}
+
+		if entry.Actor != "tester" {
+			t.Fatalf("expected the actor to be tester, but have %s", entry.Actor)
+		}
+	}
+
+	if entries[2].Note != "revoked at "+time.Unix(start, 0).UTC().Format("2006-01-02T15:04:05-0700")+" by test: audit; TICKET-1" {
+		t.Fatalf("unexpected note for the revocation: %s", entries[2].Note)
+	}
+
+	entries, err = QueryAuditLog(tx, &AuditFilter{Bundle: "ca", Release: rel.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit log entries for the release, but have %d", len(entries))
+	}
+
+	entries, err = QueryAuditLog(tx, &AuditFilter{Until: start - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected no audit log entries before the test started, but have %d", len(entries))
+	}
+}
@@ -0,0 +1,238 @@
+// Package certdbtest contains helpers for testing code that uses the
+// trust database: an in-memory database with the schema applied, and
+// generated certificate hierarchies to populate it with.
+package certdbtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	_ "github.com/mattn/go-sqlite3" // load sql driver
+)
+
+// migrationDir returns the directory containing the schema
+// migrations, relative to this source file.
+func migrationDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
+
+// New returns an in-memory database with every schema migration
+// applied.
+func New() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each connection to an in-memory database gets a database of
+	// its own; limiting the pool to a single connection keeps the
+	// schema visible to every transaction.
+	db.SetMaxOpenConns(1)
+
+	migrations, err := filepath.Glob(filepath.Join(migrationDir(), "*.up.sql"))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sort.Strings(migrations)
+
+	for _, migration := range migrations {
+		data, err := ioutil.ReadFile(migration)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		for _, statement := range strings.Split(string(data), ";") {
+			statement = strings.TrimSpace(statement)
+			if statement == "" {
+				continue
+			}
+
+			if _, err = db.Exec(statement); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return db, nil
+}
+
+// An Identity is a generated certificate and its private key.
+type Identity struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// An Option customises a certificate template before it is signed.
+type Option func(*x509.Certificate)
+
+func newTemplate(cn string, notBefore, notAfter time.Time, pub crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// The SKI is computed as in RFC 5280 Section 4.2.1.2 (1).
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(spki, &info); err != nil {
+		return nil, err
+	}
+	ski := sha1.Sum(info.PublicKey.Bytes)
+
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"cfssl_trust test"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          ski[:],
+	}, nil
+}
+
+func issue(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// NewRoot generates a self-signed root certificate valid between
+// notBefore and notAfter.
+func NewRoot(cn string, notBefore, notAfter time.Time, opts ...Option) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newTemplate(cn, notBefore, notAfter, key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	cert, err := issue(template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{Cert: cert, Key: key}, nil
+}
+
+// Issue generates a CA certificate signed by the identity, valid
+// between notBefore and notAfter.
+func (id *Identity) Issue(cn string, notBefore, notAfter time.Time, opts ...Option) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newTemplate(cn, notBefore, notAfter, key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	cert, err := issue(template, id.Cert, key.Public(), id.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{Cert: cert, Key: key}, nil
+}
+
+// CrossSign generates a certificate signed by the identity for the
+// subject's name and key, valid between notBefore and notAfter. The
+// result shares the subject's key, so it is returned with it.
+func (id *Identity) CrossSign(subject *Identity, notBefore, notAfter time.Time, opts ...Option) (*Identity, error) {
+	template, err := newTemplate(subject.Cert.Subject.CommonName, notBefore, notAfter, subject.Key.Public())
+	if err != nil {
+		return nil, err
+	}
+	template.Subject = subject.Cert.Subject
+
+	for _, opt := range opts {
+		opt(template)
+	}
+
+	cert, err := issue(template, id.Cert, subject.Key.Public(), id.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{Cert: cert, Key: subject.Key}, nil
+}
+
+// AddRelease creates a release of the bundle made at releasedAt and
+// adds the certificates to it, importing them as needed.
+func AddRelease(db *sql.DB, bundle, version string, releasedAt time.Time, certs ...*x509.Certificate) (*certdb.Release, error) {
+	rel, err := certdb.NewRelease(bundle, version)
+	if err != nil {
+		return nil, err
+	}
+	rel.ReleasedAt = releasedAt.Unix()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = certdb.Ensure(rel, tx); err != nil {
+		return nil, err
+	}
+
+	for _, cert := range certs {
+		c := certdb.NewCertificate(cert)
+		if _, err = certdb.Ensure(c, tx); err != nil {
+			return nil, err
+		}
+
+		if aia := certdb.NewAIA(c); aia != nil {
+			if _, err = certdb.Ensure(aia, tx); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err = certdb.Ensure(certdb.NewCertificateRelease(c, rel), tx); err != nil {
+			return nil, err
+		}
+	}
+
+	return rel, tx.Commit()
+}
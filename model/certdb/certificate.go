@@ -6,6 +6,7 @@ package certdb
 import (
 	"crypto/x509"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl_trust/common"
 )
 
 // Finalize finishes a transaction, committing it if needed or rolling
@@ -150,7 +152,11 @@ type Certificate struct {
 // Insert stores the Certificate in the database.
 func (cert *Certificate) Insert(tx *sql.Tx) error {
 	_, err := tx.Exec(`INSERT INTO certificates (ski, aki, serial, not_before, not_after, raw) values (?, ?, ?, ?, ?, ?)`, cert.SKI, cert.AKI, cert.Serial, cert.NotBefore, cert.NotAfter, cert.Raw)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditImport, "", "", cert.SKI, cert.Serial, "")
 }
 
 // Select requires the SKI and Serial fields to be filled in.
@@ -170,6 +176,18 @@ func (cert *Certificate) Select(tx *sql.Tx) error {
 	return err
 }
 
+// Delete removes the Certificate from the database. It requires the
+// SKI and Serial fields to be filled in. It doesn't remove the
+// certificate from any releases; see Remove.
+func (cert *Certificate) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM certificates WHERE ski=? AND serial=?`, cert.SKI, cert.Serial)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditDelete, "", "", cert.SKI, cert.Serial, "")
+}
+
 // Releases looks up all the releases for a certificate.
 func (cert *Certificate) Releases(tx *sql.Tx) ([]*Release, error) {
 	var releases []*Release
@@ -238,6 +256,52 @@ func (cert *Certificate) Revoked(tx *sql.Tx, when int64) (bool, error) {
 	return count > 0, nil
 }
 
+// SharesKey returns true if another certificate in the database has
+// the same SKI, as a cross-signed root does with its self-signed
+// counterpart. Revocations are recorded by SKI, so revoking either
+// would exclude both.
+func (cert *Certificate) SharesKey(tx *sql.Tx) (bool, error) {
+	var count int
+	row := tx.QueryRow(`SELECT count(*) FROM certificates WHERE ski=? AND serial!=?`, cert.SKI, cert.Serial)
+	err := row.Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// These are the reasons a certificate may be excluded from a release,
+// as returned by Excluded.
+const (
+	ExcludedRevoked     = "revoked"
+	ExcludedExpired     = "expired"
+	ExcludedNotYetValid = "not-yet-valid"
+)
+
+// Excluded returns the reason the certificate should be left out of a
+// release made at releasedAt, or an empty string if it should be
+// included. The certificate must remain valid and unrevoked for the
+// window following the release.
+func (cert *Certificate) Excluded(tx *sql.Tx, releasedAt int64, window time.Duration) (string, error) {
+	until := releasedAt + int64(window.Seconds())
+	if isRevoked, err := cert.Revoked(tx, until); err != nil {
+		return "", err
+	} else if isRevoked {
+		return ExcludedRevoked, nil
+	}
+
+	if cert.NotAfter <= until {
+		return ExcludedExpired, nil
+	}
+
+	if cert.NotBefore > releasedAt {
+		return ExcludedNotYetValid, nil
+	}
+
+	return "", nil
+}
+
 // Revoke marks the certificate as revoked.
 func (cert *Certificate) Revoke(tx *sql.Tx, mechanism, reason string, when int64) error {
 	if err := cert.Select(tx); err != nil {
@@ -257,6 +321,40 @@ func (cert *Certificate) Revoke(tx *sql.Tx, mechanism, reason string, when int64
 	return err
 }
 
+// AmendRevocation updates the mechanism, reason, and effective time
+// of an existing revocation. It returns sql.ErrNoRows if the
+// certificate hasn't been revoked.
+func (cert *Certificate) AmendRevocation(tx *sql.Tx, mechanism, reason string, when int64) error {
+	if err := cert.Select(tx); err != nil {
+		return err
+	}
+
+	rev := &Revocation{SKI: cert.SKI}
+	if err := rev.Select(tx); err != nil {
+		return err
+	}
+
+	rev.RevokedAt = when
+	rev.Mechanism = mechanism
+	rev.Reason = reason
+	return rev.Update(tx)
+}
+
+// Unrevoke removes the revocation for the certificate. It returns
+// sql.ErrNoRows if the certificate hasn't been revoked.
+func (cert *Certificate) Unrevoke(tx *sql.Tx) error {
+	if err := cert.Select(tx); err != nil {
+		return err
+	}
+
+	rev := &Revocation{SKI: cert.SKI}
+	if err := rev.Select(tx); err != nil {
+		return err
+	}
+
+	return rev.Delete(tx)
+}
+
 // X509 returns the *crypto/x509.Certificate from the certificate.
 func (cert *Certificate) X509() *x509.Certificate {
 	return cert.cert
@@ -307,7 +405,11 @@ type AIA struct {
 // Insert stores the release in the database.
 func (aia *AIA) Insert(tx *sql.Tx) error {
 	_, err := tx.Exec(`INSERT INTO aia (ski, url) values (?, ?)`, aia.SKI, aia.URL)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAddAIA, "", "", aia.SKI, nil, aia.URL)
 }
 
 // Select requires the SKI field to be filled in.
@@ -321,6 +423,16 @@ func (aia *AIA) Select(tx *sql.Tx) error {
 	return nil
 }
 
+// Delete requires the SKI field to be filled in.
+func (aia *AIA) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM aia WHERE ski=?`, aia.SKI)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditDeleteAIA, "", "", aia.SKI, nil, "")
+}
+
 // NewAIA populates an AIA structure from a Certificate.
 func NewAIA(cert *Certificate) *AIA {
 	if len(cert.cert.IssuingCertificateURL) == 0 {
@@ -366,6 +478,32 @@ type Release struct {
 	ReleasedAt int64
 }
 
+// releaseRecord is the serialised form of a Release.
+type releaseRecord struct {
+	Bundle     string    `json:"bundle" yaml:"bundle"`
+	Version    string    `json:"version" yaml:"version"`
+	ReleasedAt time.Time `json:"released_at" yaml:"released_at"`
+}
+
+func (r *Release) record() *releaseRecord {
+	return &releaseRecord{
+		Bundle:     r.Bundle,
+		Version:    r.Version,
+		ReleasedAt: time.Unix(r.ReleasedAt, 0).UTC(),
+	}
+}
+
+// MarshalJSON encodes the Release as an object with the bundle,
+// version, and RFC 3339 release time.
+func (r *Release) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.record())
+}
+
+// MarshalYAML encodes the Release in the same form as MarshalJSON.
+func (r *Release) MarshalYAML() (interface{}, error) {
+	return r.record(), nil
+}
+
 func (r *Release) validBundle() bool {
 	return validBundle(r.Bundle)
 }
@@ -403,7 +541,11 @@ func (r *Release) Insert(tx *sql.Tx) error {
 	query := fmt.Sprintf("INSERT INTO %s_releases (version, released_at) VALUES (?, ?)",
 		r.table())
 	_, err := tx.Exec(query, r.Version, r.ReleasedAt)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditCreateRelease, r.Bundle, r.Version, "", nil, "")
 }
 
 // Select requires the Version field to have been populated.
@@ -575,7 +717,12 @@ func NewCertificateRelease(c *Certificate, r *Release) *CertificateRelease {
 func (cr *CertificateRelease) Insert(tx *sql.Tx) error {
 	query := fmt.Sprintf("INSERT INTO %ss (ski, serial, release) VALUES (?, ?, ?)", cr.Release.table())
 	_, err := tx.Exec(query, cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Version)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAdd, cr.Release.Bundle, cr.Release.Version,
+		cr.Certificate.SKI, cr.Certificate.Serial, "")
 }
 
 // Select requires the Certificate field to have the SKI and Serial
@@ -592,6 +739,31 @@ func (cr *CertificateRelease) Select(tx *sql.Tx) error {
 	return err
 }
 
+// Delete removes the certificate from the release, along with the
+// purposes it is trusted for and any distrust date. It has the same
+// requirements as Select.
+func (cr *CertificateRelease) Delete(tx *sql.Tx) error {
+	query := fmt.Sprintf("DELETE FROM %ss WHERE ski=? AND serial=? AND release=?", cr.Release.table())
+	res, err := tx.Exec(query, cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Version)
+	if err != nil {
+		return err
+	}
+
+	err = cr.deletePurposes(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM distrusts WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Bundle, cr.Release.Version)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditRemove, cr.Release.Bundle, cr.Release.Version,
+		cr.Certificate.SKI, cr.Certificate.Serial, "")
+}
+
 // Revocation models the revocations table.
 type Revocation struct {
 	SKI       string
@@ -616,5 +788,37 @@ func (rev *Revocation) Select(tx *sql.Tx) error {
 // yet.
 func (rev *Revocation) Insert(tx *sql.Tx) error {
 	_, err := tx.Exec(`INSERT INTO revocations (ski, revoked_at, mechanism, reason) VALUES (?, ?, ?, ?)`, rev.SKI, rev.RevokedAt, rev.Mechanism, rev.Reason)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditRevoke, "", "", rev.SKI, nil, rev.note())
+}
+
+// Update replaces the revocation time, mechanism, and reason for the
+// revocation's SKI.
+func (rev *Revocation) Update(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE revocations SET revoked_at=?, mechanism=?, reason=? WHERE ski=?`, rev.RevokedAt, rev.Mechanism, rev.Reason, rev.SKI)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAmendRevocation, "", "", rev.SKI, nil, rev.note())
+}
+
+// Delete removes the revocation from the database.
+func (rev *Revocation) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM revocations WHERE ski=?`, rev.SKI)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditUnrevoke, "", "", rev.SKI, nil, "")
+}
+
+// note describes the revocation for the audit log.
+func (rev *Revocation) note() string {
+	return fmt.Sprintf("revoked at %s by %s: %s",
+		time.Unix(rev.RevokedAt, 0).UTC().Format(common.DateFormat),
+		rev.Mechanism, rev.Reason)
 }
@@ -17,9 +17,14 @@ import (
 
 var sourceFiles = []string{
 	"1485991500_revision_1.up.sql",
+	"1792182000_revision_2.up.sql",
+	"1792183500_revision_3.up.sql",
+	"1792184400_revision_4.up.sql",
+	"1792185300_revision_5.up.sql",
+	"1792186200_revision_6.up.sql",
 }
 
-const latestRevision = 1
+const latestRevision = SchemaRevision
 
 var (
 	testCert1PEM = `-----BEGIN CERTIFICATE-----
@@ -717,6 +722,80 @@ func TestCertificateRevoked(t *testing.T) {
 	}
 }
 
+// TestCertificateUnrevoke verifies that a future revocation doesn't
+// take effect early, that it can be amended, and that it can be
+// removed.
+func TestCertificateUnrevoke(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	cert := NewCertificate(testCert1)
+	err = cert.Revoke(tx, "test", "scheduled", now+3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := cert.Revoked(tx, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if revoked {
+		t.Fatal("certificate shouldn't be revoked before the revocation takes effect")
+	}
+
+	revoked, err = cert.Revoked(tx, now+3600)
+	if err != nil {
+		t.Fatal(err)
+	} else if !revoked {
+		t.Fatal("certificate should be revoked once the revocation takes effect")
+	}
+
+	err = cert.AmendRevocation(tx, "test", "amended", now-3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev := &Revocation{SKI: cert.SKI}
+	err = rev.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.RevokedAt != now-3600 || rev.Reason != "amended" {
+		t.Fatalf("revocation wasn't amended: have %d (%s)", rev.RevokedAt, rev.Reason)
+	}
+
+	err = cert.Unrevoke(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err = cert.Revoked(tx, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if revoked {
+		t.Fatal("certificate shouldn't be revoked after the revocation was removed")
+	}
+
+	err = cert.Unrevoke(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("removing a missing revocation should return sql.ErrNoRows, but returned %v", err)
+	}
+
+	err = cert.AmendRevocation(tx, "test", "amended", now)
+	if err != sql.ErrNoRows {
+		t.Fatalf("amending a missing revocation should return sql.ErrNoRows, but returned %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestPreviousRelease(t *testing.T) {
 	tx, err := testDB.Begin()
 	if err != nil {
@@ -769,3 +848,32 @@ func TestPreviousRelease(t *testing.T) {
 		t.Fatal("there shouldn't be a release prior to the current release, but there is")
 	}
 }
+
+func TestCertificateSharesKey(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	cert := NewCertificate(testCert1)
+	shared, err := cert.SharesKey(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if shared {
+		t.Fatal("expected the certificate not to share its key")
+	}
+
+	_, err = tx.Exec(`INSERT INTO certificates (ski, aki, serial, not_before, not_after, raw) VALUES (?, ?, ?, ?, ?, ?)`,
+		cert.SKI, "cross", []byte{42}, cert.NotBefore, cert.NotAfter, cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err = cert.SharesKey(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if !shared {
+		t.Fatal("expected the certificate to share its key")
+	}
+}
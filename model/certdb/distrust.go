@@ -0,0 +1,166 @@
+package certdb
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+)
+
+// Distrust models the distrusts table: the partial distrust of a
+// certificate in a release. Certificates issued under it after
+// DistrustAfter are no longer trusted, for any purpose: a single date
+// is recorded per certificate and release, so a server-auth distrust
+// date taken from NSS applies to email protection as well.
+type Distrust struct {
+	SKI           string
+	Serial        []byte
+	Bundle        string
+	Release       string
+	DistrustAfter int64
+	Reason        string
+} // UNIQUE(ski, serial, bundle, release)
+
+// Select requires the SKI, Serial, Bundle, and Release fields to be
+// filled in.
+func (d *Distrust) Select(tx *sql.Tx) error {
+	row := tx.QueryRow(`SELECT distrust_after, reason FROM distrusts WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		d.SKI, d.Serial, d.Bundle, d.Release)
+	return row.Scan(&d.DistrustAfter, &d.Reason)
+}
+
+// Insert stores the Distrust in the database.
+func (d *Distrust) Insert(tx *sql.Tx) error {
+	_, err := tx.Exec(`INSERT INTO distrusts (ski, serial, bundle, release, distrust_after, reason) VALUES (?, ?, ?, ?, ?, ?)`,
+		d.SKI, d.Serial, d.Bundle, d.Release, d.DistrustAfter, d.Reason)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditDistrust, d.Bundle, d.Release, d.SKI, d.Serial, d.note())
+}
+
+// Update replaces the distrust date and reason.
+func (d *Distrust) Update(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE distrusts SET distrust_after=?, reason=? WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		d.DistrustAfter, d.Reason, d.SKI, d.Serial, d.Bundle, d.Release)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAmendDistrust, d.Bundle, d.Release, d.SKI, d.Serial, d.note())
+}
+
+// Delete removes the Distrust from the database, trusting the
+// certificate fully in the release again.
+func (d *Distrust) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM distrusts WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		d.SKI, d.Serial, d.Bundle, d.Release)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditUndistrust, d.Bundle, d.Release, d.SKI, d.Serial, "")
+}
+
+// Time returns the distrust date as a time.Time.
+func (d *Distrust) Time() time.Time {
+	return time.Unix(d.DistrustAfter, 0).UTC()
+}
+
+// note describes the distrust for the audit log.
+func (d *Distrust) note() string {
+	note := "distrusted after " + d.Time().Format(common.DateFormat)
+	if d.Reason != "" {
+		note += ": " + d.Reason
+	}
+	return note
+}
+
+func (cr *CertificateRelease) distrust() *Distrust {
+	return &Distrust{
+		SKI:     cr.Certificate.SKI,
+		Serial:  cr.Certificate.Serial,
+		Bundle:  cr.Release.Bundle,
+		Release: cr.Release.Version,
+	}
+}
+
+// Distrust returns the partial distrust of the certificate in the
+// release. It returns sql.ErrNoRows if the certificate is fully
+// trusted.
+func (cr *CertificateRelease) Distrust(tx *sql.Tx) (*Distrust, error) {
+	d := cr.distrust()
+	err := d.Select(tx)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetDistrust records that certificates issued under the certificate
+// after the given time are distrusted in the release, replacing any
+// existing distrust date. The certificate must already be in the
+// release. SetDistrust returns false if the same distrust was already
+// recorded.
+func (cr *CertificateRelease) SetDistrust(tx *sql.Tx, after int64, reason string) (bool, error) {
+	if err := cr.Select(tx); err != nil {
+		return false, err
+	}
+
+	d := cr.distrust()
+	err := d.Select(tx)
+	if err == sql.ErrNoRows {
+		d.DistrustAfter, d.Reason = after, reason
+		return true, d.Insert(tx)
+	} else if err != nil {
+		return false, err
+	}
+
+	if d.DistrustAfter == after && d.Reason == reason {
+		return false, nil
+	}
+
+	d.DistrustAfter, d.Reason = after, reason
+	return true, d.Update(tx)
+}
+
+// ClearDistrust removes the partial distrust of the certificate in
+// the release. It returns sql.ErrNoRows if none was recorded.
+func (cr *CertificateRelease) ClearDistrust(tx *sql.Tx) error {
+	d, err := cr.Distrust(tx)
+	if err != nil {
+		return err
+	}
+	return d.Delete(tx)
+}
+
+// ExcludeDistrusted applies the distrust policy for bundle formats
+// that can't express a distrust date, such as PEM: a partially
+// distrusted certificate is left in until its distrust date, and is
+// left out once the date is on or before the time the release was
+// made. Until then it is still fully trusted by the root programs;
+// afterwards, including it would also trust the certificates it issues
+// that the root programs no longer do. As distrust dates aren't
+// recorded per purpose, this applies to every purpose the certificate
+// is trusted for: once its date has passed, the certificate is left
+// out entirely, even from bundles for purposes the root programs
+// still trust it for. The release must have been selected from the
+// database. ExcludeDistrusted returns the certificates to include and
+// those that were left out.
+func ExcludeDistrusted(tx *sql.Tx, rel *Release, certs []*Certificate) ([]*Certificate, []*Certificate, error) {
+	var included, excluded []*Certificate
+	for _, cert := range certs {
+		d, err := NewCertificateRelease(cert, rel).Distrust(tx)
+		if err == sql.ErrNoRows || (err == nil && d.DistrustAfter > rel.ReleasedAt) {
+			included = append(included, cert)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		excluded = append(excluded, cert)
+	}
+
+	return included, excluded, nil
+}
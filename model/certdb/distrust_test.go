@@ -0,0 +1,88 @@
+package certdb
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// TestDistrust partially distrusts the first test certificate in the
+// current ca release and checks which bundles leave it out. The
+// transaction is rolled back so that the database is left as it was.
+func TestDistrust(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	caRelease := &Release{Bundle: "ca", Version: curRelease.String()}
+	err = caRelease.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := NewCertificateRelease(NewCertificate(testCert1), caRelease)
+	_, err = cr.Distrust(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a fully trusted certificate, have %v", err)
+	}
+
+	changed, err := cr.SetDistrust(tx, caRelease.ReleasedAt+1, "test")
+	if err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Fatal("expected the distrust date to be recorded")
+	}
+
+	changed, err = cr.SetDistrust(tx, caRelease.ReleasedAt+1, "test")
+	if err != nil {
+		t.Fatal(err)
+	} else if changed {
+		t.Fatal("setting the same distrust date shouldn't change anything")
+	}
+
+	certs, err := CollectRelease("ca", curRelease.String(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	included, excluded, err := ExcludeDistrusted(tx, caRelease, certs)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(included) != 2 || len(excluded) != 0 {
+		t.Fatalf("a certificate distrusted after the release should be included, have %d included", len(included))
+	}
+
+	_, err = cr.SetDistrust(tx, caRelease.ReleasedAt, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	included, excluded, err = ExcludeDistrusted(tx, caRelease, certs)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(included) != 1 || len(excluded) != 1 || excluded[0].SKI != cr.Certificate.SKI {
+		t.Fatalf("a certificate distrusted as of the release should be left out, have %d excluded", len(excluded))
+	}
+
+	intRelease := &Release{Bundle: "int", Version: curRelease.String()}
+	_, err = NewCertificateRelease(cr.Certificate, intRelease).SetDistrust(tx, 0, "")
+	if err != sql.ErrNoRows {
+		t.Fatalf("distrusting a certificate outside the release should return sql.ErrNoRows, have %v", err)
+	}
+
+	err = cr.Delete(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cr.Distrust(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("expected the distrust to be removed with the certificate, have %v", err)
+	}
+
+	err = cr.ClearDistrust(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("clearing a missing distrust should return sql.ErrNoRows, have %v", err)
+	}
+}
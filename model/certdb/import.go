@@ -0,0 +1,38 @@
+package certdb
+
+import (
+	"crypto/x509"
+	"database/sql"
+)
+
+// Import stores an X.509 certificate and its AIA in the database. If
+// rel isn't nil, the certificate is also added to the release, which
+// must already exist. Import returns the stored certificate and
+// whether it was newly added to the release.
+func Import(tx *sql.Tx, cert *x509.Certificate, rel *Release) (*Certificate, bool, error) {
+	c := NewCertificate(cert)
+	_, err := Ensure(c, tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	aia := NewAIA(c)
+	if aia != nil {
+		_, err = Ensure(aia, tx)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if rel == nil {
+		return c, false, nil
+	}
+
+	cr := NewCertificateRelease(c, rel)
+	added, err := Ensure(cr, tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return c, added, nil
+}
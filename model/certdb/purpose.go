@@ -0,0 +1,182 @@
+package certdb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// These are the purposes a certificate can be trusted for in a
+// release. They are named after the extended key usages they
+// correspond to.
+const (
+	PurposeServerAuth      = "serverAuth"
+	PurposeClientAuth      = "clientAuth"
+	PurposeEmailProtection = "emailProtection"
+	PurposeCodeSigning     = "codeSigning"
+	PurposeTimeStamping    = "timeStamping"
+	PurposeOCSPSigning     = "OCSPSigning"
+)
+
+// Purposes lists the valid purposes, in the order they are reported.
+var Purposes = []string{
+	PurposeServerAuth,
+	PurposeClientAuth,
+	PurposeEmailProtection,
+	PurposeCodeSigning,
+	PurposeTimeStamping,
+	PurposeOCSPSigning,
+}
+
+// ParsePurposes validates a list of purposes, each of which may also
+// be a comma-separated list, and returns them without duplicates in
+// the order of Purposes.
+func ParsePurposes(in []string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, list := range in {
+		for _, purpose := range strings.Split(list, ",") {
+			purpose = strings.TrimSpace(purpose)
+			if !validPurpose(purpose) {
+				return nil, fmt.Errorf("model/certdb: invalid purpose '%s' (valid purposes are %s)",
+					purpose, strings.Join(Purposes, "|"))
+			}
+			seen[purpose] = true
+		}
+	}
+
+	var purposes []string
+	for _, purpose := range Purposes {
+		if seen[purpose] {
+			purposes = append(purposes, purpose)
+		}
+	}
+	return purposes, nil
+}
+
+func validPurpose(purpose string) bool {
+	for _, valid := range Purposes {
+		if purpose == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Purposes returns the purposes the certificate is trusted for in
+// the release, in the order of Purposes. If none are recorded, the
+// certificate is trusted for every purpose and Purposes returns nil.
+func (cr *CertificateRelease) Purposes(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query(`SELECT purpose FROM trust_purposes WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Bundle, cr.Release.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recorded []string
+	for rows.Next() {
+		var purpose string
+		err = rows.Scan(&purpose)
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, purpose)
+	}
+
+	if err = rows.Err(); err != nil || len(recorded) == 0 {
+		return nil, err
+	}
+	return ParsePurposes(recorded)
+}
+
+// SetPurposes replaces the purposes the certificate is trusted for in
+// the release; an empty list trusts it for every purpose. The
+// certificate must already be in the release. SetPurposes returns
+// false if the purposes were already the same.
+func (cr *CertificateRelease) SetPurposes(tx *sql.Tx, purposes []string) (bool, error) {
+	purposes, err := ParsePurposes(purposes)
+	if err != nil {
+		return false, err
+	}
+
+	if err = cr.Select(tx); err != nil {
+		return false, err
+	}
+
+	current, err := cr.Purposes(tx)
+	if err != nil {
+		return false, err
+	} else if strings.Join(current, ",") == strings.Join(purposes, ",") {
+		return false, nil
+	}
+
+	err = cr.deletePurposes(tx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, purpose := range purposes {
+		_, err = tx.Exec(`INSERT INTO trust_purposes (ski, serial, bundle, release, purpose) VALUES (?, ?, ?, ?, ?)`,
+			cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Bundle, cr.Release.Version, purpose)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	note := "trusted for " + strings.Join(purposes, ", ")
+	if len(purposes) == 0 {
+		note = "trusted for any purpose"
+	}
+	return true, audit(tx, AuditSetPurposes, cr.Release.Bundle, cr.Release.Version,
+		cr.Certificate.SKI, cr.Certificate.Serial, note)
+}
+
+func (cr *CertificateRelease) deletePurposes(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM trust_purposes WHERE ski=? AND serial=? AND bundle=? AND release=?`,
+		cr.Certificate.SKI, cr.Certificate.Serial, cr.Release.Bundle, cr.Release.Version)
+	return err
+}
+
+// TrustedFor reports whether the certificate is trusted for the
+// purpose in the release.
+func (cr *CertificateRelease) TrustedFor(tx *sql.Tx, purpose string) (bool, error) {
+	purposes, err := cr.Purposes(tx)
+	if err != nil {
+		return false, err
+	} else if purposes == nil {
+		return true, nil
+	}
+
+	for _, p := range purposes {
+		if p == purpose {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CollectPurpose returns the certificates in a release that are
+// trusted for the purpose, in the order of CollectRelease.
+func CollectPurpose(bundle, version, purpose string, tx *sql.Tx) ([]*Certificate, error) {
+	if !validPurpose(purpose) {
+		return nil, fmt.Errorf("model/certdb: invalid purpose '%s' (valid purposes are %s)",
+			purpose, strings.Join(Purposes, "|"))
+	}
+
+	certs, err := CollectRelease(bundle, version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := &Release{Bundle: bundle, Version: version}
+	var trusted []*Certificate
+	for _, cert := range certs {
+		ok, err := NewCertificateRelease(cert, rel).TrustedFor(tx, purpose)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			trusted = append(trusted, cert)
+		}
+	}
+	return trusted, nil
+}
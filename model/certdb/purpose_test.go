@@ -0,0 +1,104 @@
+package certdb
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// TestPurposes restricts the first test certificate to server
+// authentication in the current ca release and checks that bundles
+// for other purposes leave it out. The transaction is rolled back so
+// that the database is left as it was.
+func TestPurposes(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	caRelease := &Release{Bundle: "ca", Version: curRelease.String()}
+	cr := NewCertificateRelease(NewCertificate(testCert1), caRelease)
+
+	purposes, err := cr.Purposes(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if purposes != nil {
+		t.Fatalf("expected no purposes to be recorded, have %v", purposes)
+	}
+
+	changed, err := cr.SetPurposes(tx, []string{"serverAuth", "serverAuth"})
+	if err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Fatal("expected the purposes to change")
+	}
+
+	changed, err = cr.SetPurposes(tx, []string{PurposeServerAuth})
+	if err != nil {
+		t.Fatal(err)
+	} else if changed {
+		t.Fatal("setting the same purposes shouldn't change anything")
+	}
+
+	purposes, err = cr.Purposes(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.Join(purposes, ",") != PurposeServerAuth {
+		t.Fatalf("expected the certificate to be trusted for serverAuth, have %v", purposes)
+	}
+
+	certs, err := CollectPurpose("ca", curRelease.String(), PurposeServerAuth, tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(certs) != 2 {
+		t.Fatalf("expected both certificates to be trusted for serverAuth, have %d", len(certs))
+	}
+
+	certs, err = CollectPurpose("ca", curRelease.String(), PurposeEmailProtection, tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(certs) != 1 || certs[0].SKI == cr.Certificate.SKI {
+		t.Fatalf("expected only the unrestricted certificate to be trusted for emailProtection, have %d", len(certs))
+	}
+
+	_, err = CollectPurpose("ca", curRelease.String(), "anything", tx)
+	if err == nil {
+		t.Fatal("expected an invalid purpose to be rejected")
+	}
+
+	intRelease := &Release{Bundle: "int", Version: curRelease.String()}
+	_, err = NewCertificateRelease(cr.Certificate, intRelease).SetPurposes(tx, []string{PurposeServerAuth})
+	if err != sql.ErrNoRows {
+		t.Fatalf("setting purposes outside the release should return sql.ErrNoRows, have %v", err)
+	}
+
+	changed, err = cr.SetPurposes(tx, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Fatal("expected the purposes to be cleared")
+	}
+
+	ok, err := cr.TrustedFor(tx, PurposeCodeSigning)
+	if err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("a certificate without purposes should be trusted for every purpose")
+	}
+}
+
+func TestParsePurposes(t *testing.T) {
+	purposes, err := ParsePurposes([]string{"emailProtection,serverAuth", " clientAuth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(purposes, ",") != "serverAuth,clientAuth,emailProtection" {
+		t.Fatalf("unexpected purposes %v", purposes)
+	}
+
+	if _, err = ParsePurposes([]string{"serverauth"}); err == nil {
+		t.Fatal("purposes should be case-sensitive")
+	}
+}
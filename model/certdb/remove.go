@@ -0,0 +1,115 @@
+package certdb
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Remove takes the certificate out of the releases for the given
+// bundle; if version is empty, the certificate is removed from every
+// release of the bundle. Once the certificate no longer belongs to any
+// release, it is deleted from the certificates table as well, along
+// with the platform trust stores recorded as containing it and the
+// other rows referring to it. Remove returns the releases the
+// certificate was removed from and whether the certificate itself was
+// deleted.
+func (cert *Certificate) Remove(tx *sql.Tx, bundle, version string) ([]*Release, bool, error) {
+	if !validBundle(bundle) {
+		return nil, false, errors.New("model/certdb: invalid bundle " + bundle)
+	}
+
+	releases, err := cert.Releases(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var removed []*Release
+	remaining := 0
+	for _, rel := range releases {
+		if rel.Bundle != bundle || (version != "" && rel.Version != version) {
+			remaining++
+			continue
+		}
+
+		err = NewCertificateRelease(cert, rel).Delete(tx)
+		if err != nil {
+			return nil, false, err
+		}
+		removed = append(removed, rel)
+	}
+
+	// A certificate that wasn't in any of the releases named is left
+	// alone, even if it isn't in any release at all.
+	if remaining > 0 || len(removed) == 0 {
+		return removed, false, nil
+	}
+
+	err = cert.Delete(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = cert.deleteDependents(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sources, err := cert.Sources(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, src := range sources {
+		err = src.Delete(tx)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return removed, true, nil
+}
+
+// deleteDependents deletes the rows referring to a deleted
+// certificate. Revocations are recorded by SKI and AIA URLs by AKI, so
+// they are only deleted along with the last certificate sharing them.
+func (cert *Certificate) deleteDependents(tx *sql.Tx) error {
+	trust := &NSSTrust{SKI: cert.SKI, Serial: cert.Serial}
+	err := trust.Delete(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM trust_purposes WHERE ski=? AND serial=?`, cert.SKI, cert.Serial)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM distrusts WHERE ski=? AND serial=?`, cert.SKI, cert.Serial)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT count(*) FROM certificates WHERE ski=?`, cert.SKI).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err = (&Revocation{SKI: cert.SKI}).Delete(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cert.AKI == "" {
+		return nil
+	}
+
+	err = tx.QueryRow(`SELECT count(*) FROM certificates WHERE aki=?`, cert.AKI).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	return (&AIA{SKI: cert.AKI}).Delete(tx)
+}
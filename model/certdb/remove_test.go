@@ -0,0 +1,159 @@
+package certdb
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// TestCertificateRemove adds the first test certificate to the
+// intermediate release, and then removes it from both bundles,
+// checking that the certificate is only deleted once it no longer
+// belongs to any release. The transaction is rolled back so that the
+// database is left as it was.
+func TestCertificateRemove(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	intRelease := &Release{Bundle: "int", Version: curRelease.String()}
+	err = intRelease.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := NewCertificate(testCert1)
+	_, err = Ensure(NewCertificateRelease(cert, intRelease), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, deleted, err := cert.Remove(tx, "int", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 1 || removed[0].Bundle != "int" {
+		t.Fatalf("expected the certificate to be removed from one int release, but have %d", len(removed))
+	}
+
+	if deleted {
+		t.Fatal("certificate shouldn't be deleted while it's still in the ca release")
+	}
+
+	removed, deleted, err = cert.Remove(tx, "ca", "9999.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 0 || deleted {
+		t.Fatal("removing the certificate from a release it isn't in shouldn't change anything")
+	}
+
+	removed, deleted, err = cert.Remove(tx, "ca", curRelease.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 1 || !deleted {
+		t.Fatal("certificate should have been removed from the ca release and deleted")
+	}
+
+	err = NewCertificate(testCert1).Select(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("certificate should have been deleted, but Select returned %v", err)
+	}
+
+	_, _, err = cert.Remove(tx, "something", "")
+	if err == nil {
+		t.Fatal("'something' shouldn't be a valid bundle")
+	}
+}
+
+func countRows(t *testing.T, tx *sql.Tx, query string, args ...interface{}) int {
+	var count int
+	err := tx.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// TestCertificateRemoveDependents checks that deleting a certificate
+// deletes the rows referring to it, and that a certificate in no
+// release isn't deleted by removing it from a release.
+func TestCertificateRemoveDependents(t *testing.T) {
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	cert := NewCertificate(testCert1)
+	err = cert.Revoke(tx, "test", "removal", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO nss_trust (ski, serial, label, server_auth, email_protection, code_signing, server_distrust_after, email_distrust_after) VALUES (?, ?, 'test', '', '', '', 0, 0)`,
+		cert.SKI, cert.Serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// These belong to a release the certificate was never in, and
+	// so aren't removed along with its releases.
+	_, err = tx.Exec(`INSERT INTO trust_purposes (ski, serial, bundle, release, purpose) VALUES (?, ?, 'int', '2000.1.0', 'serverAuth')`,
+		cert.SKI, cert.Serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO distrusts (ski, serial, bundle, release, distrust_after, reason) VALUES (?, ?, 'int', '2000.1.0', 0, 'test')`,
+		cert.SKI, cert.Serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, deleted, err := cert.Remove(tx, "ca", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if !deleted {
+		t.Fatal("certificate should have been deleted")
+	}
+
+	for _, table := range []string{"nss_trust", "trust_purposes", "distrusts"} {
+		if n := countRows(t, tx, "SELECT count(*) FROM "+table+" WHERE ski=? AND serial=?", cert.SKI, cert.Serial); n != 0 {
+			t.Fatalf("expected the certificate's %s rows to be deleted, but %d remain", table, n)
+		}
+	}
+
+	if n := countRows(t, tx, "SELECT count(*) FROM revocations WHERE ski=?", cert.SKI); n != 0 {
+		t.Fatal("expected the certificate's revocation to be deleted")
+	}
+
+	siblings := countRows(t, tx, "SELECT count(*) FROM certificates WHERE aki=?", cert.AKI)
+	if n := countRows(t, tx, "SELECT count(*) FROM aia WHERE ski=?", cert.AKI); siblings == 0 && n != 0 {
+		t.Fatal("expected the AIA URL to be deleted with the last certificate from its issuer")
+	}
+
+	// The certificate is now in no release at all; removing it from
+	// a release it was never in leaves it alone.
+	_, _, err = Import(tx, testCert1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, deleted, err := cert.Remove(tx, "ca", curRelease.String())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(removed) != 0 || deleted {
+		t.Fatal("a certificate in no release shouldn't be deleted")
+	}
+
+	err = NewCertificate(testCert1).Select(tx)
+	if err != nil {
+		t.Fatalf("certificate shouldn't have been deleted, but Select returned %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package certdb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SchemaRevision is the schema revision this package requires: the
+// revision recorded in schema_version by the latest migration.
+const SchemaRevision = 6
+
+// CheckSchema returns an error if the database hasn't been migrated
+// to SchemaRevision, as happens when cfssl-trust is upgraded without
+// re-running 'cfssl-trust setup'.
+func CheckSchema(db *sql.DB) error {
+	var revision sql.NullInt64
+	err := db.QueryRow(`SELECT max(revision) FROM schema_version`).Scan(&revision)
+	if err != nil {
+		return fmt.Errorf("certdb: can't read the schema revision (%s); run 'cfssl-trust setup' to set up the database", err)
+	}
+
+	if revision.Int64 < SchemaRevision {
+		return fmt.Errorf("certdb: the database is at schema revision %d, but revision %d is required; run 'cfssl-trust setup' to upgrade it",
+			revision.Int64, SchemaRevision)
+	}
+
+	return nil
+}
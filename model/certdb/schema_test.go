@@ -0,0 +1,39 @@
+package certdb
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCheckSchema(t *testing.T) {
+	err := CheckSchema(testDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = CheckSchema(db)
+	if err == nil {
+		t.Fatal("expected a database without a schema to be rejected")
+	}
+
+	_, err = db.Exec(`CREATE TABLE schema_version (revision INTEGER, created_at INTEGER)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`INSERT INTO schema_version (revision, created_at) VALUES (1, 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSchema(db)
+	if err == nil {
+		t.Fatal("expected a revision 1 database to be rejected")
+	}
+}
@@ -0,0 +1,78 @@
+package certdb
+
+import (
+	"database/sql"
+)
+
+// Source models the sources table: a platform trust store that
+// contains a certificate. The platform is named after its keystore
+// (e.g. "nss" or "windows"), and the URL locates the keystore.
+type Source struct {
+	SKI      string
+	Serial   []byte
+	Platform string
+	URL      string
+} // UNIQUE(ski, serial, platform)
+
+// Select requires the SKI, Serial, and Platform fields to be filled
+// in.
+func (src *Source) Select(tx *sql.Tx) error {
+	row := tx.QueryRow(`SELECT url FROM sources WHERE ski=? AND serial=? AND platform=?`,
+		src.SKI, src.Serial, src.Platform)
+	return row.Scan(&src.URL)
+}
+
+// Insert stores the Source in the database.
+func (src *Source) Insert(tx *sql.Tx) error {
+	_, err := tx.Exec(`INSERT INTO sources (ski, serial, platform, url) VALUES (?, ?, ?, ?)`,
+		src.SKI, src.Serial, src.Platform, src.URL)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAddSource, "", "", src.SKI, src.Serial, src.Platform+" ("+src.URL+")")
+}
+
+// Delete removes the Source from the database.
+func (src *Source) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM sources WHERE ski=? AND serial=? AND platform=?`,
+		src.SKI, src.Serial, src.Platform)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditRemoveSource, "", "", src.SKI, src.Serial, src.Platform)
+}
+
+func selectSources(tx *sql.Tx, query string, args ...interface{}) ([]*Source, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*Source
+	for rows.Next() {
+		src := &Source{}
+		err = rows.Scan(&src.SKI, &src.Serial, &src.Platform, &src.URL)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+
+	return sources, rows.Err()
+}
+
+// Sources returns the platform trust stores that contain the
+// certificate, ordered by platform.
+func (cert *Certificate) Sources(tx *sql.Tx) ([]*Source, error) {
+	return selectSources(tx, `SELECT ski, serial, platform, url FROM sources WHERE ski=? AND serial=? AND platform != '' ORDER BY platform`,
+		cert.SKI, cert.Serial)
+}
+
+// PlatformSources returns the certificates recorded as being in the
+// platform's trust store.
+func PlatformSources(tx *sql.Tx, platform string) ([]*Source, error) {
+	return selectSources(tx, `SELECT ski, serial, platform, url FROM sources WHERE platform=?`, platform)
+}
@@ -0,0 +1,117 @@
+package certdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/common"
+)
+
+// NSSTrust models the nss_trust table: the trust Mozilla's NSS
+// assigns to a certificate for each purpose. The trust fields hold the
+// levels defined by the nss package; the DistrustAfter fields are zero
+// if NSS doesn't limit the trust for the purpose.
+type NSSTrust struct {
+	SKI                 string
+	Serial              []byte
+	Label               string
+	ServerAuth          string
+	EmailProtection     string
+	CodeSigning         string
+	ServerDistrustAfter int64
+	EmailDistrustAfter  int64
+} // UNIQUE(ski, serial)
+
+// Select requires the SKI and Serial fields to be filled in.
+func (trust *NSSTrust) Select(tx *sql.Tx) error {
+	row := tx.QueryRow(`SELECT label, server_auth, email_protection, code_signing, server_distrust_after, email_distrust_after FROM nss_trust WHERE ski=? AND serial=?`, trust.SKI, trust.Serial)
+	return row.Scan(&trust.Label, &trust.ServerAuth, &trust.EmailProtection,
+		&trust.CodeSigning, &trust.ServerDistrustAfter, &trust.EmailDistrustAfter)
+}
+
+// Insert stores the NSSTrust in the database.
+func (trust *NSSTrust) Insert(tx *sql.Tx) error {
+	_, err := tx.Exec(`INSERT INTO nss_trust (ski, serial, label, server_auth, email_protection, code_signing, server_distrust_after, email_distrust_after) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		trust.SKI, trust.Serial, trust.Label, trust.ServerAuth, trust.EmailProtection,
+		trust.CodeSigning, trust.ServerDistrustAfter, trust.EmailDistrustAfter)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditSetTrust, "", "", trust.SKI, trust.Serial, trust.note())
+}
+
+// Update replaces the label, trust, and distrust times for the
+// certificate.
+func (trust *NSSTrust) Update(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE nss_trust SET label=?, server_auth=?, email_protection=?, code_signing=?, server_distrust_after=?, email_distrust_after=? WHERE ski=? AND serial=?`,
+		trust.Label, trust.ServerAuth, trust.EmailProtection, trust.CodeSigning,
+		trust.ServerDistrustAfter, trust.EmailDistrustAfter, trust.SKI, trust.Serial)
+	if err != nil {
+		return err
+	}
+
+	return audit(tx, AuditAmendTrust, "", "", trust.SKI, trust.Serial, trust.note())
+}
+
+// Delete removes the NSSTrust from the database. It requires the SKI
+// and Serial fields to be filled in.
+func (trust *NSSTrust) Delete(tx *sql.Tx) error {
+	res, err := tx.Exec(`DELETE FROM nss_trust WHERE ski=? AND serial=?`, trust.SKI, trust.Serial)
+	if err != nil {
+		return err
+	}
+
+	return auditDeleted(tx, res, AuditDeleteTrust, "", "", trust.SKI, trust.Serial, "")
+}
+
+// Record stores the NSSTrust, replacing any trust already recorded
+// for the certificate. It returns false if the recorded trust was
+// already the same.
+func (trust *NSSTrust) Record(tx *sql.Tx) (bool, error) {
+	current := &NSSTrust{SKI: trust.SKI, Serial: trust.Serial}
+	err := current.Select(tx)
+	if err == sql.ErrNoRows {
+		return true, trust.Insert(tx)
+	} else if err != nil {
+		return false, err
+	}
+
+	if current.Label == trust.Label &&
+		current.ServerAuth == trust.ServerAuth &&
+		current.EmailProtection == trust.EmailProtection &&
+		current.CodeSigning == trust.CodeSigning &&
+		current.ServerDistrustAfter == trust.ServerDistrustAfter &&
+		current.EmailDistrustAfter == trust.EmailDistrustAfter {
+		return false, nil
+	}
+	return true, trust.Update(tx)
+}
+
+// note describes the trust for the audit log.
+func (trust *NSSTrust) note() string {
+	note := fmt.Sprintf("server-auth %s, email-protection %s, code-signing %s",
+		trust.ServerAuth, trust.EmailProtection, trust.CodeSigning)
+	if trust.Label != "" {
+		note = trust.Label + ": " + note
+	}
+	if trust.ServerDistrustAfter != 0 {
+		note += ", server-auth distrusted after " + time.Unix(trust.ServerDistrustAfter, 0).UTC().Format(common.DateFormat)
+	}
+	if trust.EmailDistrustAfter != 0 {
+		note += ", email-protection distrusted after " + time.Unix(trust.EmailDistrustAfter, 0).UTC().Format(common.DateFormat)
+	}
+	return note
+}
+
+// NSSTrust returns the trust NSS assigns to the certificate. It
+// returns sql.ErrNoRows if no trust has been recorded.
+func (cert *Certificate) NSSTrust(tx *sql.Tx) (*NSSTrust, error) {
+	trust := &NSSTrust{SKI: cert.SKI, Serial: cert.Serial}
+	err := trust.Select(tx)
+	if err != nil {
+		return nil, err
+	}
+	return trust, nil
+}
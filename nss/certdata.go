@@ -0,0 +1,437 @@
+// Package nss reads Mozilla's certdata.txt, the source of the root
+// certificates built into NSS, along with the trust NSS assigns to
+// each of them.
+//
+// certdata.txt lists PKCS #11 objects, one attribute per line. Two
+// kinds of objects matter here: certificates, which may carry the
+// dates after which NSS stops trusting certificates they issue, and
+// trust records, which give the trust level for each purpose and are
+// matched to certificates by issuer and serial number. A trust record
+// may also appear without a certificate, to distrust a certificate
+// that NSS doesn't ship.
+package nss
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Trust is the trust level NSS assigns to a certificate for a purpose.
+type Trust string
+
+// These are the NSS trust levels.
+const (
+	// TrustedDelegator marks a trust anchor: certificates issued
+	// under it are trusted for the purpose.
+	TrustedDelegator Trust = "trusted-delegator"
+
+	// Trusted marks a certificate that is trusted itself, but
+	// not as an issuer.
+	Trusted Trust = "trusted"
+
+	// ValidDelegator marks a certificate that may issue
+	// certificates, but only once it chains to a trust anchor.
+	ValidDelegator Trust = "valid-delegator"
+
+	// MustVerifyTrust means the certificate is neither trusted
+	// nor distrusted, and must chain to a trust anchor.
+	MustVerifyTrust Trust = "must-verify-trust"
+
+	// NotTrusted marks a distrusted certificate.
+	NotTrusted Trust = "not-trusted"
+
+	// TrustUnknown is used when certdata.txt has no trust for the
+	// purpose.
+	TrustUnknown Trust = "trust-unknown"
+)
+
+var trustLevels = map[string]Trust{
+	"CKT_NSS_TRUSTED_DELEGATOR": TrustedDelegator,
+	"CKT_NSS_TRUSTED":           Trusted,
+	"CKT_NSS_VALID_DELEGATOR":   ValidDelegator,
+	"CKT_NSS_MUST_VERIFY_TRUST": MustVerifyTrust,
+	"CKT_NSS_NOT_TRUSTED":       NotTrusted,
+	"CKT_NSS_TRUST_UNKNOWN":     TrustUnknown,
+}
+
+// An Entry is a certificate listed in certdata.txt, with its trust.
+type Entry struct {
+	Label string
+
+	// Certificate is nil if certdata.txt only has a trust record
+	// for the certificate; it is then identified by its issuer
+	// and serial number.
+	Certificate *x509.Certificate
+	Issuer      []byte // DER-encoded
+	Serial      *big.Int
+
+	ServerAuth      Trust
+	EmailProtection Trust
+	CodeSigning     Trust
+
+	// ServerDistrustAfter and EmailDistrustAfter are the times
+	// after which certificates issued under the certificate are
+	// no longer trusted for the purpose; they are zero if NSS
+	// sets no such limit.
+	ServerDistrustAfter time.Time
+	EmailDistrustAfter  time.Time
+}
+
+// TrustAnchor reports whether NSS trusts certificates issued under
+// the certificate for server authentication or email protection.
+func (e *Entry) TrustAnchor() bool {
+	return e.ServerAuth == TrustedDelegator || e.EmailProtection == TrustedDelegator
+}
+
+// Distrusted reports whether NSS explicitly distrusts the certificate
+// for every purpose.
+func (e *Entry) Distrusted() bool {
+	return e.ServerAuth == NotTrusted && e.EmailProtection == NotTrusted && e.CodeSigning == NotTrusted
+}
+
+// An attribute is a single attribute of a PKCS #11 object. Values of
+// token types, such as CK_BBOOL and CK_TRUST, are kept as the token.
+type attribute struct {
+	Type  string
+	Value []byte
+}
+
+type object struct {
+	line  int
+	attrs map[string]attribute
+}
+
+func (obj *object) class() string {
+	return string(obj.attrs["CKA_CLASS"].Value)
+}
+
+func (obj *object) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("nss: object at line %d: %s", obj.line, fmt.Sprintf(format, args...))
+}
+
+// bytes returns the value of a binary attribute.
+func (obj *object) bytes(name string) ([]byte, error) {
+	attr, ok := obj.attrs[name]
+	if !ok {
+		return nil, obj.errorf("missing %s", name)
+	} else if attr.Type != "MULTILINE_OCTAL" {
+		return nil, obj.errorf("%s has type %s, expected MULTILINE_OCTAL", name, attr.Type)
+	}
+	return attr.Value, nil
+}
+
+// trust returns the trust level in an attribute; a missing attribute
+// means the trust is unknown.
+func (obj *object) trust(name string) (Trust, error) {
+	attr, ok := obj.attrs[name]
+	if !ok {
+		return TrustUnknown, nil
+	}
+
+	trust, ok := trustLevels[string(attr.Value)]
+	if !ok || attr.Type != "CK_TRUST" {
+		return "", obj.errorf("invalid trust %s %s for %s", attr.Type, attr.Value, name)
+	}
+	return trust, nil
+}
+
+// distrustAfter returns the time in a distrust-after attribute. NSS
+// writes CK_BBOOL CK_FALSE when there is no such time.
+func (obj *object) distrustAfter(name string) (time.Time, error) {
+	attr, ok := obj.attrs[name]
+	if !ok || (attr.Type == "CK_BBOOL" && string(attr.Value) == "CK_FALSE") {
+		return time.Time{}, nil
+	} else if attr.Type != "MULTILINE_OCTAL" {
+		return time.Time{}, obj.errorf("invalid %s %s %s", name, attr.Type, attr.Value)
+	}
+
+	// The time is a UTCTime or, in principle, GeneralizedTime
+	// string, without the DER header.
+	layout := "060102150405Z"
+	if len(attr.Value) == len("20060102150405Z") {
+		layout = "20060102150405Z"
+	}
+
+	t, err := time.Parse(layout, string(attr.Value))
+	if err != nil {
+		return time.Time{}, obj.errorf("invalid %s: %s", name, err)
+	}
+	return t, nil
+}
+
+// unescape decodes the backslash escapes used in certdata.txt:
+// three-digit octal escapes for bytes, and a backslash before any
+// other character for the character itself.
+func unescape(s string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+
+		if i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			if s[i+1] > '3' {
+				return nil, fmt.Errorf("octal escape \\%s is out of range", s[i+1:i+4])
+			}
+			out = append(out, (s[i+1]-'0')<<6|(s[i+2]-'0')<<3|(s[i+3]-'0'))
+			i += 3
+		} else if i+1 < len(s) {
+			out = append(out, s[i+1])
+			i++
+		} else {
+			return nil, errors.New("trailing backslash")
+		}
+	}
+	return out, nil
+}
+
+func isOctal(b byte) bool {
+	return '0' <= b && b <= '7'
+}
+
+// readObjects reads the objects following BEGINDATA.
+func readObjects(r io.Reader) ([]*object, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	var objects []*object
+	var current *object
+	var lineNo int
+	var inData bool
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if !inData {
+			inData = line == "BEGINDATA"
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("nss: line %d: expected an attribute, have '%s'", lineNo, line)
+		}
+
+		name, attrType := fields[0], fields[1]
+		if name == "CKA_CLASS" {
+			current = &object{line: lineNo, attrs: map[string]attribute{}}
+			objects = append(objects, current)
+		} else if current == nil {
+			return nil, fmt.Errorf("nss: line %d: attribute %s before the first CKA_CLASS", lineNo, name)
+		}
+
+		var value []byte
+		switch attrType {
+		case "MULTILINE_OCTAL":
+			start := lineNo
+			var data bytes.Buffer
+			for {
+				if !scanner.Scan() {
+					if err := scanner.Err(); err != nil {
+						return nil, err
+					}
+					return nil, fmt.Errorf("nss: line %d: %s isn't terminated by END", start, name)
+				}
+				lineNo++
+
+				octal := strings.TrimSpace(scanner.Text())
+				if octal == "END" {
+					break
+				}
+
+				decoded, err := unescape(octal)
+				if err != nil {
+					return nil, fmt.Errorf("nss: line %d: %s", lineNo, err)
+				}
+				data.Write(decoded)
+			}
+			value = data.Bytes()
+		case "UTF8":
+			if len(fields) < 3 || len(fields[2]) < 2 || fields[2][0] != '"' || fields[2][len(fields[2])-1] != '"' {
+				return nil, fmt.Errorf("nss: line %d: %s should be a quoted string", lineNo, name)
+			}
+
+			var err error
+			value, err = unescape(fields[2][1 : len(fields[2])-1])
+			if err != nil {
+				return nil, fmt.Errorf("nss: line %d: %s", lineNo, err)
+			}
+		default:
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("nss: line %d: %s has no value", lineNo, name)
+			}
+			value = []byte(fields[2])
+		}
+
+		current.attrs[name] = attribute{Type: attrType, Value: value}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if !inData {
+		return nil, errors.New("nss: no BEGINDATA line found")
+	}
+	return objects, nil
+}
+
+// issuerSerial identifies a certificate by its DER-encoded issuer
+// and serial number, as trust records do.
+func issuerSerial(issuer, serial []byte) string {
+	return string(issuer) + "\x00" + string(serial)
+}
+
+func parseSerial(obj *object) (*big.Int, []byte, error) {
+	der, err := obj.bytes("CKA_SERIAL_NUMBER")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var serial *big.Int
+	rest, err := asn1.Unmarshal(der, &serial)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, obj.errorf("invalid CKA_SERIAL_NUMBER")
+	}
+	return serial, der, nil
+}
+
+func parseCertificate(obj *object) (*Entry, string, error) {
+	der, err := obj.bytes("CKA_VALUE")
+	if err != nil {
+		return nil, "", err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, "", obj.errorf("parsing certificate: %s", err)
+	}
+
+	issuer, err := obj.bytes("CKA_ISSUER")
+	if err != nil {
+		return nil, "", err
+	}
+
+	serial, serialDER, err := parseSerial(obj)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry := &Entry{
+		Label:           string(obj.attrs["CKA_LABEL"].Value),
+		Certificate:     cert,
+		Issuer:          issuer,
+		Serial:          serial,
+		ServerAuth:      TrustUnknown,
+		EmailProtection: TrustUnknown,
+		CodeSigning:     TrustUnknown,
+	}
+
+	entry.ServerDistrustAfter, err = obj.distrustAfter("CKA_NSS_SERVER_DISTRUST_AFTER")
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry.EmailDistrustAfter, err = obj.distrustAfter("CKA_NSS_EMAIL_DISTRUST_AFTER")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entry, issuerSerial(issuer, serialDER), nil
+}
+
+func applyTrust(obj *object, entry *Entry) error {
+	var err error
+	entry.ServerAuth, err = obj.trust("CKA_TRUST_SERVER_AUTH")
+	if err != nil {
+		return err
+	}
+
+	entry.EmailProtection, err = obj.trust("CKA_TRUST_EMAIL_PROTECTION")
+	if err != nil {
+		return err
+	}
+
+	entry.CodeSigning, err = obj.trust("CKA_TRUST_CODE_SIGNING")
+	return err
+}
+
+// Parse reads the certificates and trust records from certdata.txt.
+// Each certificate is returned with the trust from its trust record,
+// or with unknown trust if it has none; trust records for
+// certificates that aren't listed are returned as entries without a
+// certificate. Entries are returned in the order they appear.
+func Parse(r io.Reader) ([]*Entry, error) {
+	objects, err := readObjects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	byIssuerSerial := map[string]*Entry{}
+	byHash := map[[sha1.Size]byte]*Entry{}
+	for _, obj := range objects {
+		if obj.class() != "CKO_CERTIFICATE" {
+			continue
+		}
+
+		entry, key, err := parseCertificate(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+		byIssuerSerial[key] = entry
+		byHash[sha1.Sum(entry.Certificate.Raw)] = entry
+	}
+
+	for _, obj := range objects {
+		if obj.class() != "CKO_NSS_TRUST" {
+			continue
+		}
+
+		issuer, err := obj.bytes("CKA_ISSUER")
+		if err != nil {
+			return nil, err
+		}
+
+		serial, serialDER, err := parseSerial(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, ok := byIssuerSerial[issuerSerial(issuer, serialDER)]
+		if hash, err := obj.bytes("CKA_CERT_SHA1_HASH"); !ok && err == nil && len(hash) == sha1.Size {
+			var digest [sha1.Size]byte
+			copy(digest[:], hash)
+			entry, ok = byHash[digest]
+		}
+
+		if !ok {
+			entry = &Entry{
+				Label:  string(obj.attrs["CKA_LABEL"].Value),
+				Issuer: issuer,
+				Serial: serial,
+			}
+			entries = append(entries, entry)
+		}
+
+		err = applyTrust(obj, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
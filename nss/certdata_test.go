@@ -0,0 +1,347 @@
+package nss
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// octal writes a binary attribute as certdata.txt does.
+func octal(name string, data []byte) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s MULTILINE_OCTAL\n", name)
+	for i, b := range data {
+		fmt.Fprintf(&out, "\\%03o", b)
+		if i%16 == 15 || i == len(data)-1 {
+			out.WriteString("\n")
+		}
+	}
+	out.WriteString("END\n")
+	return out.String()
+}
+
+func derSerial(serial *big.Int) []byte {
+	der, err := asn1.Marshal(serial)
+	if err != nil {
+		panic(err)
+	}
+	return der
+}
+
+// fixture holds the certificates written to a test certdata.txt: two
+// roots, an intermediate that is only distrusted, and a distrust
+// record for a certificate that doesn't exist anywhere.
+type fixture struct {
+	server, email, distrusted *certdbtest.Identity
+	unknownSerial             *big.Int
+	certdata                  string
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{unknownSerial: big.NewInt(1234)}
+	var err error
+	f.server, err = certdbtest.NewRoot("Server Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.email, err = certdbtest.NewRoot("Email Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.distrusted, err = f.server.Issue("Distrusted Intermediate", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha1.Sum(f.server.Cert.Raw)
+	f.certdata = `#
+# This is a test certdata.txt.
+#
+CVS_ID "@(#) $RCSfile: certdata.txt $"
+
+BEGINDATA
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_BUILTIN_ROOT_LIST
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "Mozilla Builtin Roots"
+
+# Certificate "Server Root"
+CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "Server Root"
+CKA_CERTIFICATE_TYPE CK_CERTIFICATE_TYPE CKC_X_509
+` + octal("CKA_ISSUER", f.server.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.server.Cert.SerialNumber)) +
+		octal("CKA_VALUE", f.server.Cert.Raw) + `CKA_NSS_MOZILLA_CA_POLICY CK_BBOOL CK_TRUE
+` + octal("CKA_NSS_SERVER_DISTRUST_AFTER", []byte("200101000000Z")) + `CKA_NSS_EMAIL_DISTRUST_AFTER CK_BBOOL CK_FALSE
+
+# Trust for "Server Root"
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "Server Root"
+` + octal("CKA_CERT_SHA1_HASH", hash[:]) +
+		octal("CKA_ISSUER", f.server.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.server.Cert.SerialNumber)) + `CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_TRUSTED_DELEGATOR
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_MUST_VERIFY_TRUST
+CKA_TRUST_CODE_SIGNING CK_TRUST CKT_NSS_MUST_VERIFY_TRUST
+CKA_TRUST_STEP_UP_APPROVED CK_BBOOL CK_FALSE
+
+# Certificate "Email Root"
+CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "E-Mail R\303\266ot \"2017\""
+CKA_CERTIFICATE_TYPE CK_CERTIFICATE_TYPE CKC_X_509
+` + octal("CKA_ISSUER", f.email.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.email.Cert.SerialNumber)) +
+		octal("CKA_VALUE", f.email.Cert.Raw) + `
+# Trust for "Email Root"
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_LABEL UTF8 "E-Mail R\303\266ot \"2017\""
+` + octal("CKA_ISSUER", f.email.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.email.Cert.SerialNumber)) + `CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_MUST_VERIFY_TRUST
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_TRUSTED_DELEGATOR
+CKA_TRUST_CODE_SIGNING CK_TRUST CKT_NSS_MUST_VERIFY_TRUST
+
+# Distrust "Distrusted Intermediate"
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_LABEL UTF8 "Distrusted Intermediate"
+` + octal("CKA_ISSUER", f.distrusted.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.distrusted.Cert.SerialNumber)) + `CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_NOT_TRUSTED
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_NOT_TRUSTED
+CKA_TRUST_CODE_SIGNING CK_TRUST CKT_NSS_NOT_TRUSTED
+
+# Distrust "Unknown"
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_LABEL UTF8 "Unknown"
+` + octal("CKA_ISSUER", f.distrusted.Cert.RawIssuer) +
+		octal("CKA_SERIAL_NUMBER", derSerial(f.unknownSerial)) + `CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_NOT_TRUSTED
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST CKT_NSS_NOT_TRUSTED
+CKA_TRUST_CODE_SIGNING CK_TRUST CKT_NSS_NOT_TRUSTED
+`
+	return f
+}
+
+func TestParse(t *testing.T) {
+	f := newFixture(t)
+	entries, err := Parse(strings.NewReader(f.certdata))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, have %d", len(entries))
+	}
+
+	server := entries[0]
+	if server.Label != "Server Root" || server.Certificate == nil || !server.Certificate.Equal(f.server.Cert) {
+		t.Fatalf("unexpected first entry %+v", server)
+	}
+
+	if server.ServerAuth != TrustedDelegator || server.EmailProtection != MustVerifyTrust || server.CodeSigning != MustVerifyTrust {
+		t.Fatalf("unexpected trust for the server root %+v", server)
+	}
+
+	if !server.ServerDistrustAfter.Equal(date(2020, 1, 1)) || !server.EmailDistrustAfter.IsZero() {
+		t.Fatalf("unexpected distrust dates for the server root %+v", server)
+	}
+
+	email := entries[1]
+	if email.Label != "E-Mail Röot \"2017\"" || email.ServerAuth != MustVerifyTrust || email.EmailProtection != TrustedDelegator {
+		t.Fatalf("unexpected email root %+v", email)
+	}
+
+	if !server.TrustAnchor() || !email.TrustAnchor() || server.Distrusted() {
+		t.Fatal("both roots should be trust anchors")
+	}
+
+	distrusted := entries[2]
+	if distrusted.Certificate != nil || !distrusted.Distrusted() || distrusted.Serial.Cmp(f.distrusted.Cert.SerialNumber) != 0 {
+		t.Fatalf("unexpected distrusted entry %+v", distrusted)
+	}
+
+	if entries[3].Label != "Unknown" || entries[3].Serial.Cmp(f.unknownSerial) != 0 {
+		t.Fatalf("unexpected unknown entry %+v", entries[3])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	inputs := map[string]string{
+		"no data":      "CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\n",
+		"unterminated": "BEGINDATA\nCKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\nCKA_VALUE MULTILINE_OCTAL\n\\060\n",
+		"no class":     "BEGINDATA\nCKA_TOKEN CK_BBOOL CK_TRUE\n",
+		"bad escape":   "BEGINDATA\nCKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\nCKA_VALUE MULTILINE_OCTAL\n\\460\nEND\n",
+		"bad trust": "BEGINDATA\nCKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST\n" +
+			octal("CKA_ISSUER", []byte{0x30, 0}) + octal("CKA_SERIAL_NUMBER", []byte{2, 1, 1}) +
+			"CKA_TRUST_SERVER_AUTH CK_TRUST CKT_NSS_SOMETIMES\n",
+	}
+
+	for name, input := range inputs {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	f := newFixture(t)
+	entries, err := Parse(strings.NewReader(f.certdata))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = certdbtest.AddRelease(db, "int", "2017.6.0", date(2017, 6, 1), f.distrusted.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := certdb.NewRelease("ca", "2017.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importAll := func() []*Imported {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		_, err = certdb.Ensure(rel, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := Import(tx, entries, rel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return imported
+	}
+
+	imported := importAll()
+	if !imported[0].Added || !imported[1].Added || imported[2].Added {
+		t.Fatal("expected the roots, and only the roots, to be added to the release")
+	}
+
+	if imported[2].Certificate == nil || imported[2].Certificate.SKI != certdb.NewCertificate(f.distrusted.Cert).SKI {
+		t.Fatal("expected the distrust record to be matched to the intermediate")
+	}
+
+	if imported[3].Certificate != nil || imported[3].Changed {
+		t.Fatal("a distrust record for an unknown certificate shouldn't be recorded")
+	}
+
+	for _, result := range imported[:3] {
+		if !result.Changed {
+			t.Fatalf("expected trust to be recorded for %s", result.Entry.Label)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trust, err := imported[0].Certificate.NSSTrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trust.ServerAuth != string(TrustedDelegator) || trust.ServerDistrustAfter != date(2020, 1, 1).Unix() || trust.EmailDistrustAfter != 0 {
+		t.Fatalf("unexpected recorded trust %+v", trust)
+	}
+
+	distrust, err := certdb.NewCertificateRelease(imported[0].Certificate, rel).Distrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if distrust.DistrustAfter != date(2020, 1, 1).Unix() {
+		t.Fatalf("expected the server root to be distrusted after 2020-01-01 in the release, have %+v", distrust)
+	}
+
+	purposes, err := certdb.NewCertificateRelease(imported[1].Certificate, rel).Purposes(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(purposes) != 1 || purposes[0] != certdb.PurposeEmailProtection {
+		t.Fatalf("expected the email root to be trusted for emailProtection, have %v", purposes)
+	}
+
+	trust, err = imported[2].Certificate.NSSTrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trust.ServerAuth != string(NotTrusted) || trust.Label != "Distrusted Intermediate" {
+		t.Fatalf("unexpected recorded distrust %+v", trust)
+	}
+
+	_, err = certdb.NewCertificate(f.email.Cert).NSSTrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdb.NewCertificate(f.server.Cert).NSSTrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	for _, result := range importAll() {
+		if result.Added || result.Changed {
+			t.Fatalf("re-importing %s shouldn't change anything", result.Entry.Label)
+		}
+	}
+
+	entries[0].ServerDistrustAfter = time.Time{}
+	if imported = importAll(); !imported[0].Changed {
+		t.Fatal("expected the changed trust to be recorded")
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	trust, err = imported[0].Certificate.NSSTrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trust.ServerDistrustAfter != 0 {
+		t.Fatalf("expected the distrust date to be cleared, have %d", trust.ServerDistrustAfter)
+	}
+
+	_, err = certdb.NewCertificateRelease(imported[0].Certificate, rel).Distrust(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("expected the release's distrust date to be cleared, have %v", err)
+	}
+
+	_, err = (&certdb.Certificate{SKI: "00", Serial: []byte{1}}).NSSTrust(tx)
+	if err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a certificate without trust, have %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package nss
+
+import (
+	"bytes"
+	"database/sql"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// An Imported entry pairs an entry from certdata.txt with the
+// certificate its trust was recorded against.
+type Imported struct {
+	Entry *Entry
+
+	// Certificate is nil if the entry has no certificate in
+	// certdata.txt and none with its issuer and serial number is
+	// in the database; no trust is recorded for it.
+	Certificate *certdb.Certificate
+
+	// Added is true if the certificate was newly added to the
+	// release.
+	Added bool
+
+	// Changed is true if the recorded trust changed.
+	Changed bool
+}
+
+// Trust returns the certdb.NSSTrust for an entry, to be recorded
+// against the certificate.
+func (e *Entry) Trust(cert *certdb.Certificate) *certdb.NSSTrust {
+	trust := &certdb.NSSTrust{
+		SKI:             cert.SKI,
+		Serial:          cert.Serial,
+		Label:           e.Label,
+		ServerAuth:      string(e.ServerAuth),
+		EmailProtection: string(e.EmailProtection),
+		CodeSigning:     string(e.CodeSigning),
+	}
+
+	if !e.ServerDistrustAfter.IsZero() {
+		trust.ServerDistrustAfter = e.ServerDistrustAfter.Unix()
+	}
+	if !e.EmailDistrustAfter.IsZero() {
+		trust.EmailDistrustAfter = e.EmailDistrustAfter.Unix()
+	}
+	return trust
+}
+
+// Purposes returns the purposes NSS trusts certificates issued under
+// the certificate for, as certdb purposes.
+func (e *Entry) Purposes() []string {
+	var purposes []string
+	if e.ServerAuth == TrustedDelegator {
+		purposes = append(purposes, certdb.PurposeServerAuth)
+	}
+	if e.EmailProtection == TrustedDelegator {
+		purposes = append(purposes, certdb.PurposeEmailProtection)
+	}
+	if e.CodeSigning == TrustedDelegator {
+		purposes = append(purposes, certdb.PurposeCodeSigning)
+	}
+	return purposes
+}
+
+// distrustReason is the reason given for the distrust dates taken from
+// certdata.txt.
+const distrustReason = "NSS server distrust after"
+
+// releaseTrust records the purposes NSS trusts a root for in a release
+// and the date after which NSS stops trusting the server certificates
+// it issued; as distrust dates aren't recorded per purpose, the date
+// ends its trust for every purpose. A distrust date recorded by an earlier import is cleared
+// if NSS no longer has one; those set by hand are left alone.
+func releaseTrust(tx *sql.Tx, cr *certdb.CertificateRelease, e *Entry) error {
+	_, err := cr.SetPurposes(tx, e.Purposes())
+	if err != nil {
+		return err
+	}
+
+	if !e.ServerDistrustAfter.IsZero() {
+		_, err = cr.SetDistrust(tx, e.ServerDistrustAfter.Unix(), distrustReason)
+		return err
+	}
+
+	d, err := cr.Distrust(tx)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if d.Reason != distrustReason {
+		return nil
+	}
+	return d.Delete(tx)
+}
+
+// findCertificate looks up the certificate in the database with the
+// entry's issuer and serial number.
+func findCertificate(certs []*certdb.Certificate, e *Entry) *certdb.Certificate {
+	for _, cert := range certs {
+		x509Cert := cert.X509()
+		if x509Cert != nil && bytes.Equal(x509Cert.RawIssuer, e.Issuer) && x509Cert.SerialNumber.Cmp(e.Serial) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// Import stores the entries and their trust in the database. The
+// certificates in certdata.txt are imported with certdb.Import, and
+// those NSS trusts as anchors are added to rel if it isn't nil,
+// trusted for the purposes NSS trusts them for and with NSS's server
+// distrust date, if any; other certificates, such as distrusted ones,
+// are stored without being released. Roots trusted only for email are
+// released too, but publish leaves them out of the TLS bundle. Trust
+// records without a certificate are recorded against the certificate
+// in the database with the same issuer and serial number, if there is
+// one.
+func Import(tx *sql.Tx, entries []*Entry, rel *certdb.Release) ([]*Imported, error) {
+	var existing []*certdb.Certificate
+	var loaded bool
+
+	imported := make([]*Imported, 0, len(entries))
+	for _, e := range entries {
+		result := &Imported{Entry: e}
+		imported = append(imported, result)
+
+		var err error
+		switch {
+		case e.Certificate != nil && e.TrustAnchor():
+			result.Certificate, result.Added, err = certdb.Import(tx, e.Certificate, rel)
+			if err == nil && rel != nil {
+				err = releaseTrust(tx, certdb.NewCertificateRelease(result.Certificate, rel), e)
+			}
+		case e.Certificate != nil:
+			result.Certificate, _, err = certdb.Import(tx, e.Certificate, nil)
+		default:
+			if !loaded {
+				existing, err = certdb.AllCertificates(tx)
+				loaded = true
+			}
+			result.Certificate = findCertificate(existing, e)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Certificate == nil {
+			continue
+		}
+
+		result.Changed, err = e.Trust(result.Certificate).Record(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return imported, nil
+}
@@ -0,0 +1,193 @@
+// Package platform records which platform trust stores contain the
+// certificates in the database. The trust stores are the keystores
+// listed in ca-bundle.crt.metadata, the file CFSSL uses to build
+// ubiquitous bundles.
+package platform
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// A Keystore is a platform trust store. Several entries in the
+// metadata may share a keystore (e.g. the Windows versions); Names
+// lists all of them.
+type Keystore struct {
+	Platform string
+	Names    []string
+	Path     string
+
+	// URL is the keystore's path as given in the metadata, which
+	// is recorded in the sources table.
+	URL string
+}
+
+// Load parses the certificates in the keystore.
+func (ks *Keystore) Load() ([]*x509.Certificate, error) {
+	return loadKeystore(ks.Path)
+}
+
+// metadataEntry is an entry in ca-bundle.crt.metadata; only the
+// fields needed to find the keystores are decoded.
+type metadataEntry struct {
+	Name     string `json:"name"`
+	Keystore string `json:"keystore"`
+}
+
+// PlatformName returns the name a keystore is recorded under: its
+// file name without the extension, e.g. "nss" for
+// certdata/trusted_roots/nss.pem.
+func PlatformName(keystore string) string {
+	base := filepath.Base(keystore)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// LoadMetadata reads the keystores from a ca-bundle.crt.metadata
+// file, in the order they are first listed. Relative keystore paths
+// are taken relative to the directory containing the metadata.
+func LoadMetadata(path string) ([]*Keystore, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*metadataEntry
+	err = json.Unmarshal(in, &entries)
+	if err != nil {
+		return nil, errors.New("platform: failed to parse " + path + ": " + err.Error())
+	}
+
+	var keystores []*Keystore
+	var byURL = map[string]*Keystore{}
+	for _, entry := range entries {
+		if entry.Keystore == "" {
+			continue
+		}
+
+		ks, ok := byURL[entry.Keystore]
+		if !ok {
+			ks = &Keystore{
+				Platform: PlatformName(entry.Keystore),
+				Path:     entry.Keystore,
+				URL:      entry.Keystore,
+			}
+			if !filepath.IsAbs(ks.Path) {
+				ks.Path = filepath.Join(filepath.Dir(path), ks.Path)
+			}
+
+			byURL[entry.Keystore] = ks
+			keystores = append(keystores, ks)
+		}
+		ks.Names = append(ks.Names, entry.Name)
+	}
+
+	return keystores, nil
+}
+
+// Result summarises the import of a keystore. Unknown counts the
+// certificates in the keystore that aren't in the database.
+type Result struct {
+	*Keystore
+	Total   int
+	Added   []*certdb.Certificate
+	Removed []*certdb.Source
+	Unknown int
+}
+
+// Import records, for each keystore, the certificates in the database
+// that it contains. Certificates that are no longer in a keystore have
+// their record for it removed, so that re-running Import brings the
+// provenance up to date.
+func Import(tx *sql.Tx, keystores []*Keystore) ([]*Result, error) {
+	var results []*Result
+	for _, ks := range keystores {
+		result, err := importKeystore(tx, ks)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func sourceKey(ski string, serial []byte) string {
+	return ski + ":" + string(serial)
+}
+
+func importKeystore(tx *sql.Tx, ks *Keystore) (*Result, error) {
+	x509Certs, err := ks.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := certdb.PlatformSources(tx, ks.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := map[string]*certdb.Source{}
+	for _, src := range existing {
+		stale[sourceKey(src.SKI, src.Serial)] = src
+	}
+
+	result := &Result{Keystore: ks, Total: len(x509Certs)}
+	for _, x509Cert := range x509Certs {
+		cert := certdb.NewCertificate(x509Cert)
+		err = cert.Select(tx)
+		if err == sql.ErrNoRows {
+			result.Unknown++
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		key := sourceKey(cert.SKI, cert.Serial)
+		if _, ok := stale[key]; ok {
+			delete(stale, key)
+			continue
+		}
+
+		src := &certdb.Source{
+			SKI:      cert.SKI,
+			Serial:   cert.Serial,
+			Platform: ks.Platform,
+			URL:      ks.URL,
+		}
+
+		// A keystore may list the same certificate twice.
+		err = src.Select(tx)
+		if err == nil {
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		err = src.Insert(tx)
+		if err != nil {
+			return nil, err
+		}
+		result.Added = append(result.Added, cert)
+	}
+
+	for _, src := range existing {
+		if stale[sourceKey(src.SKI, src.Serial)] == nil {
+			continue
+		}
+
+		err = src.Delete(tx)
+		if err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, src)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package platform
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+const testMetadata = `[
+{"name": "Mozilla", "weight": 25, "keystore": "trusted_roots/nss.pem"},
+{"name": "Windows XP", "weight": 21, "keystore": "trusted_roots/windows.pem"},
+{"name": "Windows Vista and up", "weight": 21, "keystore": "trusted_roots/windows.pem"}
+]`
+
+func writeKeystore(t *testing.T, path string, certs ...*x509.Certificate) {
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	err := ioutil.WriteFile(path, out, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func importAll(t *testing.T, db *sql.DB, keystores []*Keystore) []*Result {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	results, err := Import(tx, keystores)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func platforms(t *testing.T, db *sql.DB, cert *x509.Certificate) []string {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	sources, err := certdb.NewCertificate(cert).Sources(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, src := range sources {
+		names = append(names, src.Platform)
+	}
+	return names
+}
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var roots []*certdbtest.Identity
+	for _, name := range []string{"Shared Root", "Windows Root", "Unknown Root"} {
+		root, err := certdbtest.NewRoot(name, date(2017, 1, 1), date(2100, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	shared, windows, unknown := roots[0].Cert, roots[1].Cert, roots[2].Cert
+
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.6.0", date(2017, 6, 1), shared, windows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "trusted_roots"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := filepath.Join(dir, "ca-bundle.crt.metadata")
+	err = ioutil.WriteFile(metadata, []byte(testMetadata), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keystores, err := LoadMetadata(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keystores) != 2 || keystores[0].Platform != "nss" || keystores[1].Platform != "windows" {
+		t.Fatalf("expected the nss and windows keystores, have %+v", keystores)
+	}
+
+	if len(keystores[1].Names) != 2 || keystores[1].URL != "trusted_roots/windows.pem" {
+		t.Fatalf("unexpected windows keystore %+v", keystores[1])
+	}
+
+	writeKeystore(t, keystores[0].Path, shared, unknown)
+	writeKeystore(t, keystores[1].Path, shared, windows, windows)
+
+	results := importAll(t, db, keystores)
+	if len(results[0].Added) != 1 || results[0].Unknown != 1 || len(results[1].Added) != 2 || results[1].Total != 3 {
+		t.Fatalf("unexpected results nss=%+v windows=%+v", results[0], results[1])
+	}
+
+	if names := platforms(t, db, shared); len(names) != 2 || names[0] != "nss" || names[1] != "windows" {
+		t.Fatalf("expected the shared root to be in both stores, have %v", names)
+	}
+
+	for _, result := range importAll(t, db, keystores) {
+		if len(result.Added) != 0 || len(result.Removed) != 0 {
+			t.Fatalf("re-importing %s shouldn't change anything", result.Platform)
+		}
+	}
+
+	writeKeystore(t, keystores[0].Path, unknown)
+	results = importAll(t, db, keystores)
+	if len(results[0].Removed) != 1 || results[0].Removed[0].SKI != certdb.NewCertificate(shared).SKI {
+		t.Fatalf("expected the shared root to be removed from nss, have %+v", results[0])
+	}
+
+	if names := platforms(t, db, shared); len(names) != 1 || names[0] != "windows" {
+		t.Fatalf("expected the shared root to be only in windows, have %v", names)
+	}
+}
@@ -0,0 +1,169 @@
+package platform
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ubiquity"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// RootUbiquity describes the platforms that trust a root. Score is
+// CFSSL's weighted ubiquity score for the root: the total weight of
+// the platforms that trust it and support its hash and key
+// algorithms.
+type RootUbiquity struct {
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+	Trusted     []string          `json:"trusted" yaml:"trusted"`
+	Untrusted   []string          `json:"untrusted" yaml:"untrusted"`
+	Score       int               `json:"score" yaml:"score"`
+}
+
+// KeystoreRoot is a root in a platform's keystore.
+type KeystoreRoot struct {
+	SKI      string    `json:"ski" yaml:"ski"`
+	Subject  string    `json:"subject" yaml:"subject"`
+	NotAfter time.Time `json:"not_after" yaml:"not_after"`
+}
+
+// KeystoreCoverage describes how much of a keystore the release
+// covers. Platforms names the platforms that share the keystore, and
+// Weight is their total weight. Missing lists the roots in the
+// keystore that aren't in the release.
+type KeystoreCoverage struct {
+	Keystore  string          `json:"keystore" yaml:"keystore"`
+	Platforms []string        `json:"platforms" yaml:"platforms"`
+	Weight    int             `json:"weight" yaml:"weight"`
+	Total     int             `json:"total" yaml:"total"`
+	Missing   []*KeystoreRoot `json:"missing" yaml:"missing"`
+}
+
+// UbiquityReport describes how ubiquitous the roots in a release are
+// across the platforms in ca-bundle.crt.metadata. MaxScore is the
+// total weight of the platforms. Untrusted lists the roots that no
+// platform with a keystore trusts; platforms without a keystore, such
+// as Chrome, trust whichever roots they are given. Keystores lists the
+// coverage of each keystore, in the order the platforms are listed.
+type UbiquityReport struct {
+	Release   *certdb.Release     `json:"release" yaml:"release"`
+	MaxScore  int                 `json:"max_score" yaml:"max_score"`
+	Roots     []*RootUbiquity     `json:"roots" yaml:"roots"`
+	Untrusted []*RootUbiquity     `json:"untrusted" yaml:"untrusted"`
+	Keystores []*KeystoreCoverage `json:"keystores" yaml:"keystores"`
+}
+
+// LoadPlatforms loads the platforms in the metadata file into CFSSL's
+// ubiquity package, replacing any loaded before.
+func LoadPlatforms(metadata string) error {
+	ubiquity.Platforms = nil
+	return ubiquity.LoadPlatforms(metadata)
+}
+
+// loadKeystore parses the roots in a keystore.
+func loadKeystore(path string) ([]*x509.Certificate, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := helpers.ParseCertificatesPEM(in)
+	if err != nil {
+		return nil, errors.New("platform: failed to parse " + path + ": " + err.Error())
+	}
+	return certs, nil
+}
+
+// Ubiquity reports on the roots in a release against the platforms
+// loaded by LoadPlatforms. As in CFSSL, roots are matched to keystores
+// by their public key.
+func Ubiquity(rel *certdb.Release, certs []*certdb.Certificate) (*UbiquityReport, error) {
+	report := &UbiquityReport{
+		Release:   rel,
+		Roots:     []*RootUbiquity{},
+		Untrusted: []*RootUbiquity{},
+		Keystores: []*KeystoreCoverage{},
+	}
+
+	released := ubiquity.CertSet{}
+	for _, cert := range certs {
+		released.Add(cert.X509())
+	}
+
+	// Several platforms may share a keystore, so each keystore is
+	// only loaded and reported on once.
+	keystores := map[string]*KeystoreCoverage{}
+	for _, p := range ubiquity.Platforms {
+		report.MaxScore += p.Weight
+		if p.KeyStoreFile == "" {
+			continue
+		}
+
+		if coverage, ok := keystores[p.KeyStoreFile]; ok {
+			coverage.Platforms = append(coverage.Platforms, p.Name)
+			coverage.Weight += p.Weight
+			continue
+		}
+
+		roots, err := loadKeystore(p.KeyStoreFile)
+		if err != nil {
+			return nil, err
+		}
+
+		coverage := &KeystoreCoverage{
+			Keystore:  p.KeyStoreFile,
+			Platforms: []string{p.Name},
+			Weight:    p.Weight,
+			Total:     len(roots),
+			Missing:   []*KeystoreRoot{},
+		}
+		keystores[p.KeyStoreFile] = coverage
+
+		for _, root := range roots {
+			if released.Lookup(root) {
+				continue
+			}
+
+			coverage.Missing = append(coverage.Missing, &KeystoreRoot{
+				SKI:      certdb.NewCertificate(root).SKI,
+				Subject:  common.NameToString(root.Subject),
+				NotAfter: root.NotAfter.UTC(),
+			})
+		}
+		report.Keystores = append(report.Keystores, coverage)
+	}
+
+	for _, cert := range certs {
+		root := cert.X509()
+		ru := &RootUbiquity{
+			Certificate: diff.NewCertificate(cert),
+			Trusted:     []string{},
+			Untrusted:   []string{},
+			Score:       ubiquity.CrossPlatformUbiquity([]*x509.Certificate{root}),
+		}
+
+		var keystoreTrust bool
+		for _, p := range ubiquity.Platforms {
+			if !p.Trust(root) {
+				ru.Untrusted = append(ru.Untrusted, p.Name)
+				continue
+			}
+
+			ru.Trusted = append(ru.Trusted, p.Name)
+			if len(p.KeyStore) > 0 {
+				keystoreTrust = true
+			}
+		}
+
+		report.Roots = append(report.Roots, ru)
+		if !keystoreTrust {
+			report.Untrusted = append(report.Untrusted, ru)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,92 @@
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+const testUbiquityMetadata = `[
+{"name": "Mozilla", "weight": 25, "hash_algo": "SHA2", "key_algo": "ECDSA256", "keystore": "nss.pem"},
+{"name": "Windows", "weight": 20, "hash_algo": "SHA2", "key_algo": "ECDSA256", "keystore": "windows.pem"},
+{"name": "Windows Phone", "weight": 10, "hash_algo": "SHA2", "key_algo": "ECDSA256", "keystore": "windows.pem"},
+{"name": "Chrome", "weight": 5, "hash_algo": "SHA2", "key_algo": "ECDSA256"}
+]`
+
+func TestUbiquity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var roots []*certdb.Certificate
+	for _, name := range []string{"Shared Root", "Our Root", "Windows Root"} {
+		root, err := certdbtest.NewRoot(name, date(2017, 1, 1), date(2100, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, certdb.NewCertificate(root.Cert))
+	}
+	shared, ours, windows := roots[0], roots[1], roots[2]
+
+	writeKeystore(t, filepath.Join(dir, "nss.pem"), shared.X509())
+	writeKeystore(t, filepath.Join(dir, "windows.pem"), shared.X509(), windows.X509())
+
+	metadata := filepath.Join(dir, "ca-bundle.crt.metadata")
+	err = ioutil.WriteFile(metadata, []byte(testUbiquityMetadata), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the platforms twice shouldn't list them twice.
+	for i := 0; i < 2; i++ {
+		err = LoadPlatforms(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rel := &certdb.Release{Bundle: "ca", Version: "2017.6.0"}
+	report, err := Ubiquity(rel, []*certdb.Certificate{shared, ours})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.MaxScore != 60 || len(report.Roots) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if report.Roots[0].Score != 60 || len(report.Roots[0].Untrusted) != 0 {
+		t.Fatalf("expected the shared root to be trusted everywhere, have %+v", report.Roots[0])
+	}
+
+	// Chrome has no keystore, and so trusts every root.
+	if report.Roots[1].Score != 5 || len(report.Roots[1].Trusted) != 1 || len(report.Roots[1].Untrusted) != 3 {
+		t.Fatalf("expected our root to be trusted only by Chrome, have %+v", report.Roots[1])
+	}
+
+	if len(report.Untrusted) != 1 || report.Untrusted[0].Certificate.SKI != ours.SKI {
+		t.Fatalf("expected our root to be trusted by no platform keystore, have %d", len(report.Untrusted))
+	}
+
+	if len(report.Keystores) != 2 || len(report.Keystores[0].Missing) != 0 {
+		t.Fatalf("expected nss to be covered, have %+v", report.Keystores)
+	}
+
+	// Windows and Windows Phone share a keystore, which is only
+	// reported once.
+	windowsStore := report.Keystores[1]
+	if len(windowsStore.Platforms) != 2 || windowsStore.Weight != 30 {
+		t.Fatalf("expected the windows keystore to cover both Windows platforms, have %+v", windowsStore)
+	}
+
+	missing := windowsStore.Missing
+	if windowsStore.Total != 2 || len(missing) != 1 || missing[0].SKI != windows.SKI {
+		t.Fatalf("expected the windows root to be missing, have %+v", windowsStore)
+	}
+}
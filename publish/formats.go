@@ -0,0 +1,66 @@
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// These are the formats a bundle can be encoded in.
+const (
+	FormatPEM      = "pem"
+	FormatPKCS7    = "pkcs7"
+	FormatPKCS7PEM = "pkcs7-pem"
+	FormatPKCS12   = "pkcs12"
+
+	// FormatHashDir is written to a directory with WriteHashDir
+	// rather than encoded.
+	FormatHashDir = "hashdir"
+
+	// FormatManifest and FormatGo describe the trust a release
+	// places in its certificates, and so are encoded from the
+	// release's Entries with EncodeManifest and EncodeGo.
+	FormatManifest = "manifest"
+	FormatGo       = "go"
+)
+
+// Formats lists the supported bundle formats.
+var Formats = []string{FormatPEM, FormatPKCS7, FormatPKCS7PEM, FormatPKCS12, FormatHashDir, FormatManifest, FormatGo}
+
+// IsEntryFormat reports whether a format is encoded from the release's
+// Entries rather than from its certificates alone. Only these formats
+// can express partial distrust; the others leave out certificates
+// distrusted as of the release (see certdb.ExcludeDistrusted).
+func IsEntryFormat(format string) bool {
+	return format == FormatManifest || format == FormatGo
+}
+
+// IsBinaryFormat reports whether a format is written as binary data
+// rather than PEM.
+func IsBinaryFormat(format string) bool {
+	return format == FormatPKCS7 || format == FormatPKCS12
+}
+
+// Encode returns the certificates encoded in the given format. The
+// password is only used by the PKCS #12 format.
+func Encode(certs []*certdb.Certificate, format, password string) ([]byte, error) {
+	switch format {
+	case FormatPEM:
+		return EncodeBundle(certs), nil
+	case FormatPKCS7:
+		return EncodePKCS7(certs)
+	case FormatPKCS7PEM:
+		return EncodePKCS7PEM(certs)
+	case FormatPKCS12:
+		return EncodePKCS12(certs, password)
+	case FormatHashDir:
+		return nil, errors.New("publish: hashed directories must be written with WriteHashDir")
+	case FormatManifest, FormatGo:
+		return nil, fmt.Errorf("publish: %s bundles must be encoded from the release's entries", format)
+	default:
+		return nil, fmt.Errorf("publish: unknown bundle format %s (valid formats are %s)",
+			format, strings.Join(Formats, "|"))
+	}
+}
@@ -0,0 +1,211 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cloudflare/cfssl/crypto/pkcs7"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+func testCertificates(t *testing.T) []*certdb.Certificate {
+	ids := newIdentities(t)
+	return []*certdb.Certificate{
+		certdb.NewCertificate(ids.root.Cert),
+		certdb.NewCertificate(ids.intermediate.Cert),
+		certdb.NewCertificate(ids.expired.Cert),
+	}
+}
+
+func checkCertificates(t *testing.T, expected []*certdb.Certificate, have [][]byte) {
+	t.Helper()
+	if len(have) != len(expected) {
+		t.Fatalf("expected %d certificates, have %d", len(expected), len(have))
+	}
+
+	for i := range expected {
+		if !bytes.Equal(have[i], expected[i].Raw) {
+			t.Fatalf("certificate %d doesn't match", i)
+		}
+	}
+}
+
+func checkPKCS7(t *testing.T, certs []*certdb.Certificate, der []byte) {
+	t.Helper()
+	msg, err := pkcs7.ParsePKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.ContentInfo != "SignedData" {
+		t.Fatalf("expected SignedData, have %s", msg.ContentInfo)
+	}
+
+	var have [][]byte
+	for _, cert := range msg.Content.SignedData.Certificates {
+		have = append(have, cert.Raw)
+	}
+	checkCertificates(t, certs, have)
+}
+
+func TestEncodePKCS7(t *testing.T) {
+	certs := testCertificates(t)
+
+	der, err := Encode(certs, FormatPKCS7, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPKCS7(t, certs, der)
+
+	encoded, err := Encode(certs, FormatPKCS7PEM, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, rest := pem.Decode(encoded)
+	if block == nil || block.Type != "PKCS7" || len(rest) != 0 {
+		t.Fatalf("expected a single PKCS7 PEM block, have\n%s", encoded)
+	}
+
+	if !bytes.Equal(block.Bytes, der) {
+		t.Fatal("the PEM-encoded PKCS #7 bundle should match the DER encoding")
+	}
+
+	// An empty release still produces a valid bundle.
+	der, err = EncodePKCS7(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPKCS7(t, nil, der)
+}
+
+// decodePKCS12 checks the MAC on a truststore and returns its
+// authenticated safe.
+func decodePKCS12(t *testing.T, der []byte, password string) []contentInfo {
+	t.Helper()
+	var pfx pfxPDU
+	_, err := asn1.Unmarshal(der, &pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidData) || !pfx.MacData.Mac.Algorithm.Algorithm.Equal(oidSHA256) {
+		t.Fatalf("unexpected PFX %+v", pfx)
+	}
+
+	var authSafe []byte
+	_, err = asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := pkcs12MAC(authSafe, password, pfx.MacData.MacSalt, pfx.MacData.Iterations)
+	if !bytes.Equal(mac, pfx.MacData.Mac.Digest) {
+		t.Fatal("MAC verification failed")
+	}
+
+	var contents []contentInfo
+	_, err = asn1.Unmarshal(authSafe, &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// TestPKCS12MAC checks the key derivation against a truststore
+// written by OpenSSL with "openssl pkcs12 -export -nokeys -certpbe NONE
+// -macalg sha256 -passout pass:changeit".
+func TestPKCS12MAC(t *testing.T) {
+	der, err := ioutil.ReadFile("testdata/openssl.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodePKCS12(t, der, "changeit")
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	certs := testCertificates(t)
+	certs = append(certs, certs[0])
+
+	der, err := Encode(certs, FormatPKCS12, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := decodePKCS12(t, der, "changeit")
+	if len(contents) != 1 || !contents[0].ContentType.Equal(oidData) {
+		t.Fatalf("expected a single unencrypted safe, have %+v", contents)
+	}
+
+	var safe []byte
+	_, err = asn1.Unmarshal(contents[0].Content.Bytes, &safe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bags []safeBag
+	_, err = asn1.Unmarshal(safe, &bags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var have [][]byte
+	var names []string
+	for _, bag := range bags {
+		if !bag.ID.Equal(oidCertBag) {
+			t.Fatalf("unexpected safe bag %s", bag.ID)
+		}
+
+		var cb certBag
+		_, err = asn1.Unmarshal(bag.Value.Bytes, &cb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var raw []byte
+		_, err = asn1.Unmarshal(cb.Data.Bytes, &raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, raw)
+
+		var trusted bool
+		for _, attr := range bag.Attributes {
+			switch {
+			case attr.ID.Equal(oidFriendlyName):
+				var name asn1.RawValue
+				_, err = asn1.Unmarshal(attr.Value.Bytes, &name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, string(name.Bytes))
+			case attr.ID.Equal(oidTrustedKeyUsage):
+				var usage asn1.ObjectIdentifier
+				_, err = asn1.Unmarshal(attr.Value.Bytes, &usage)
+				if err != nil {
+					t.Fatal(err)
+				}
+				trusted = usage.Equal(oidAnyExtendedKeyUsage)
+			}
+		}
+
+		if !trusted {
+			t.Fatal("expected every certificate to be a trusted entry")
+		}
+	}
+	checkCertificates(t, certs, have)
+
+	expected := string(bmpString(certs[0].SKI + "-2"))
+	if len(names) != len(certs) || names[3] != expected {
+		t.Fatal("expected each entry to have a unique alias")
+	}
+
+	_, err = EncodePKCS12(certs, "")
+	if err == nil {
+		t.Fatal("a truststore shouldn't be written without a password")
+	}
+}
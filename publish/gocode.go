@@ -0,0 +1,123 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"text/template"
+
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// goSource is the template for the Go source written by EncodeGo.
+// x509.CertPool.AddCertWithConstraint was added in Go 1.22.
+var goSource = template.Must(template.New("go").Parse(`// Code generated by cfssl-trust from the {{.Release.Bundle}} {{.Release.Version}} release. DO NOT EDIT.
+
+//go:build go1.22
+
+package {{.Package}}
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// Release is the cfssl-trust release the certificates were taken from.
+const Release = "{{.Release.Bundle}}-{{.Release.Version}}"
+
+// CertPool returns a new pool of the certificates in the release.
+// Partially distrusted certificates are added with a constraint that
+// rejects chains whose leaf was issued after the distrust date.
+func CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, c := range certificates {
+		block, _ := pem.Decode([]byte(c.pem))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			panic(err)
+		}
+
+		if c.distrustAfter.IsZero() {
+			pool.AddCert(cert)
+			continue
+		}
+
+		distrustAfter := c.distrustAfter
+		pool.AddCertWithConstraint(cert, func(chain []*x509.Certificate) error {
+			if chain[0].NotBefore.After(distrustAfter) {
+				return fmt.Errorf("certificate issued after its root was distrusted on %s", distrustAfter.Format(time.RFC3339))
+			}
+			return nil
+		})
+	}
+	return pool
+}
+
+type certificate struct {
+	pem           string
+	distrustAfter time.Time
+}
+
+var certificates = []certificate{
+{{- range .Certificates}}
+	{
+		// {{.Subject}}
+		{{- if .Distrust}}
+		// Distrusted after {{.DistrustAfter}}{{if .Distrust.Reason}}: {{.Distrust.Reason}}{{end}}.
+		distrustAfter: time.Unix({{.Distrust.DistrustAfter}}, 0),
+		{{- end}}
+		pem: ` + "`" + `{{.PEM}}` + "`" + `,
+	},
+{{- end}}
+}
+`))
+
+type goCertificate struct {
+	*Entry
+	Subject       string
+	DistrustAfter string
+	PEM           string
+}
+
+// EncodeGo returns the source of a Go package, named pkg, that builds
+// an x509.CertPool of the release's certificates. Unlike a PEM
+// bundle, it can express partial distrust: such certificates are added
+// with x509.CertPool.AddCertWithConstraint. The purposes certificates
+// are trusted for can't be expressed in a CertPool.
+func EncodeGo(rel *certdb.Release, entries []*Entry, pkg string) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("publish: invalid Go package name %q", pkg)
+	}
+
+	var certs []*goCertificate
+	for _, e := range entries {
+		gc := &goCertificate{
+			Entry:   e,
+			Subject: common.NameToString(e.Certificate.X509().Subject),
+			PEM:     strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: e.Certificate.Raw}))),
+		}
+
+		if e.Distrust != nil {
+			gc.DistrustAfter = e.Distrust.Time().Format(common.DateFormat)
+		}
+		certs = append(certs, gc)
+	}
+
+	buf := &bytes.Buffer{}
+	err := goSource.Execute(buf, struct {
+		Release      *certdb.Release
+		Package      string
+		Certificates []*goCertificate
+	}{rel, pkg, certs})
+	if err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
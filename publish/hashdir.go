@@ -0,0 +1,278 @@
+package publish
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// These are the ASN.1 string types that OpenSSL canonicalises when
+// hashing a name; values of any other type are hashed as they are.
+const (
+	tagUTF8String      = 12
+	tagPrintableString = 19
+	tagT61String       = 20
+	tagIA5String       = 22
+	tagUniversalString = 28
+	tagVisibleString   = 26
+	tagBMPString       = 30
+)
+
+type nameAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// encoding/asn1 decodes types whose names end in SET as a SET OF.
+type nameRDNSET []nameAttribute
+
+// toUTF8 converts an ASN.1 string value to UTF-8. The single-byte
+// string types are treated as Latin-1, as OpenSSL does.
+func toUTF8(value asn1.RawValue) ([]byte, error) {
+	switch value.Tag {
+	case tagUTF8String:
+		return value.Bytes, nil
+	case tagPrintableString, tagT61String, tagIA5String, tagVisibleString:
+		var out []byte
+		for _, b := range value.Bytes {
+			out = utf8.AppendRune(out, rune(b))
+		}
+		return out, nil
+	case tagBMPString:
+		if len(value.Bytes)%2 != 0 {
+			return nil, fmt.Errorf("publish: odd-length BMPString in name")
+		}
+
+		units := make([]uint16, len(value.Bytes)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(value.Bytes[2*i:])
+		}
+		return []byte(string(utf16.Decode(units))), nil
+	case tagUniversalString:
+		if len(value.Bytes)%4 != 0 {
+			return nil, fmt.Errorf("publish: invalid UniversalString in name")
+		}
+
+		var out []byte
+		for i := 0; i < len(value.Bytes); i += 4 {
+			out = utf8.AppendRune(out, rune(binary.BigEndian.Uint32(value.Bytes[i:])))
+		}
+		return out, nil
+	}
+	panic("publish: not a canonicalised string type")
+}
+
+func isCanonicalised(value asn1.RawValue) bool {
+	if value.Class != asn1.ClassUniversal {
+		return false
+	}
+
+	switch value.Tag {
+	case tagUTF8String, tagPrintableString, tagT61String, tagIA5String,
+		tagVisibleString, tagBMPString, tagUniversalString:
+		return true
+	}
+	return false
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\v' || b == '\f' || b == '\r'
+}
+
+// canonicalValue converts a string to OpenSSL's canonical form: UTF-8
+// with leading and trailing whitespace removed, internal whitespace
+// collapsed to a single space, and ASCII letters lowercased.
+func canonicalValue(value asn1.RawValue) (asn1.RawValue, error) {
+	if !isCanonicalised(value) {
+		return asn1.RawValue{FullBytes: value.FullBytes}, nil
+	}
+
+	in, err := toUTF8(value)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	in = bytes.TrimFunc(in, func(r rune) bool { return r < utf8.RuneSelf && isSpace(byte(r)) })
+	var out []byte
+	for i := 0; i < len(in); i++ {
+		switch b := in[i]; {
+		case b >= utf8.RuneSelf:
+			out = append(out, b)
+		case isSpace(b):
+			out = append(out, ' ')
+			for i+1 < len(in) && isSpace(in[i+1]) {
+				i++
+			}
+		case 'A' <= b && b <= 'Z':
+			out = append(out, b+'a'-'A')
+		default:
+			out = append(out, b)
+		}
+	}
+
+	return asn1.RawValue{Tag: tagUTF8String, Bytes: out}, nil
+}
+
+// canonicalName returns the encoding of a name hashed by OpenSSL: the
+// concatenated RDNs, without the enclosing SEQUENCE, with each string
+// value canonicalised.
+func canonicalName(rawName []byte) ([]byte, error) {
+	var rdns []nameRDNSET
+	rest, err := asn1.Unmarshal(rawName, &rdns)
+	if err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("publish: trailing data after name")
+	}
+
+	var canon []byte
+	for _, rdn := range rdns {
+		var attrs [][]byte
+		for _, attr := range rdn {
+			value, err := canonicalValue(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			der, err := asn1.Marshal(nameAttribute{Type: attr.Type, Value: value})
+			if err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, der)
+		}
+
+		// Multi-valued RDNs are sorted as a DER SET OF.
+		sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+		set, err := asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassUniversal,
+			Tag:        asn1.TagSet,
+			IsCompound: true,
+			Bytes:      bytes.Join(attrs, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		canon = append(canon, set...)
+	}
+
+	return canon, nil
+}
+
+// SubjectHash returns the hash of the certificate's subject used to
+// name certificates in an OpenSSL CApath directory, as printed by
+// "openssl x509 -subject_hash".
+func SubjectHash(cert *x509.Certificate) (uint32, error) {
+	canon, err := canonicalName(cert.RawSubject)
+	if err != nil {
+		return 0, err
+	}
+
+	digest := sha1.Sum(canon)
+	return binary.LittleEndian.Uint32(digest[:4]), nil
+}
+
+// hashName returns the name of the nth certificate with the subject
+// hash in a hashed directory.
+func hashName(hash uint32, n int) string {
+	return fmt.Sprintf("%08x.%d", hash, n)
+}
+
+// hashedFile matches the names of the files in a hashed directory.
+var hashedFile = regexp.MustCompile(`^[0-9a-f]{8}\.[0-9]+$`)
+
+// HashDir summarises the changes made to a hashed directory.
+type HashDir struct {
+	Written   []string `json:"written"`
+	Unchanged []string `json:"unchanged"`
+	Removed   []string `json:"removed"`
+}
+
+// WriteHashDir writes the certificates to dir as an OpenSSL CApath
+// directory, in the layout produced by c_rehash: one PEM file per
+// certificate, named <hash>.<n> after its subject hash, with n
+// counting up from 0 to separate certificates whose subjects hash to
+// the same value. Files that are already up to date are left alone,
+// and any other hashed files are removed so that the directory
+// matches the certificates; files that aren't named like hashed
+// certificates are never touched.
+func WriteHashDir(dir string, certs []*certdb.Certificate) (*HashDir, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	var names []string
+	counts := map[uint32]int{}
+	for _, cert := range certs {
+		hash, err := SubjectHash(cert.X509())
+		if err != nil {
+			return nil, fmt.Errorf("publish: hashing the subject of %s: %s", cert.SKI, err)
+		}
+
+		name := hashName(hash, counts[hash])
+		counts[hash]++
+		files[name] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		names = append(names, name)
+	}
+
+	result := &HashDir{
+		Written:   []string{},
+		Unchanged: []string{},
+		Removed:   []string{},
+	}
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		current, err := ioutil.ReadFile(path)
+		if err == nil && bytes.Equal(current, files[name]) {
+			result.Unchanged = append(result.Unchanged, name)
+			continue
+		}
+
+		staged, err := stage(path, files[name])
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.Rename(staged.tmp, path)
+		if err != nil {
+			os.Remove(staged.tmp)
+			return nil, err
+		}
+		result.Written = append(result.Written, name)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := files[name]; ok || !hashedFile.MatchString(name) || entry.IsDir() {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, name)
+	}
+
+	return result, nil
+}
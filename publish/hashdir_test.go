@@ -0,0 +1,163 @@
+package publish
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+type testAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type testRDNSET []testAttribute
+
+var (
+	oidCN = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidO  = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidOU = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidC  = asn1.ObjectIdentifier{2, 5, 4, 6}
+)
+
+func value(tag int, b string) asn1.RawValue {
+	return asn1.RawValue{Tag: tag, Bytes: []byte(b)}
+}
+
+// The expected hashes were produced by "openssl x509 -subject_hash"
+// for certificates with these subjects.
+var subjectHashTests = []struct {
+	name []testRDNSET
+	hash uint32
+}{
+	// Whitespace is trimmed and collapsed, ASCII is lowercased, and
+	// T61String is treated as Latin-1.
+	{
+		name: []testRDNSET{
+			{{oidC, value(tagPrintableString, "US")}},
+			{{oidO, value(tagUTF8String, "  Mixed   CASE\t Org  ")}},
+			{{oidCN, value(tagT61String, "T61 \xe9t\xe9")}},
+		},
+		hash: 0x2de61224,
+	},
+	// Multi-valued RDNs are sorted, and BMPString and
+	// UniversalString are converted to UTF-8.
+	{
+		name: []testRDNSET{
+			{
+				{oidO, value(tagBMPString, "\x00B\x00m\x00P\x00\xe9\x00 \x00 \x00X")},
+				{oidOU, value(tagIA5String, "ia5 UNIT")},
+			},
+			{{oidCN, value(tagUniversalString, "\x00\x00\x00U\x00\x00\x00N\x00\x01\xf6\x00")}},
+		},
+		hash: 0x84478cb9,
+	},
+	// NumericString isn't canonicalised.
+	{
+		name: []testRDNSET{{{asn1.ObjectIdentifier{1, 2, 3, 4}, value(18, "12  34")}}},
+		hash: 0xc847639b,
+	},
+	{
+		name: []testRDNSET{},
+		hash: 0xeea339da,
+	},
+}
+
+func TestSubjectHash(t *testing.T) {
+	for i, test := range subjectHashTests {
+		raw, err := asn1.Marshal(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hash, err := SubjectHash(&x509.Certificate{RawSubject: raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hash != test.hash {
+			t.Errorf("test %d: expected hash %08x, have %08x", i, test.hash, hash)
+		}
+	}
+}
+
+func TestWriteHashDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-hashdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids := newIdentities(t)
+
+	// A second root with the same subject needs a different
+	// suffix.
+	twin, err := certdbtest.NewRoot("Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs := []*certdb.Certificate{
+		certdb.NewCertificate(ids.root.Cert),
+		certdb.NewCertificate(ids.intermediate.Cert),
+		certdb.NewCertificate(twin.Cert),
+	}
+
+	hash, err := SubjectHash(ids.root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootName := hashName(hash, 0)
+	for _, name := range []string{"deadbeef.0", rootName, "README"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte("stale\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := WriteHashDir(dir, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Written) != 3 || len(result.Unchanged) != 0 || !reflect.DeepEqual(result.Removed, []string{"deadbeef.0"}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if result.Written[0] != rootName || result.Written[2] != hashName(hash, 1) {
+		t.Fatalf("expected the roots to be written as %s and %s, have %v", rootName, hashName(hash, 1), result.Written)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "README")); err != nil {
+		t.Fatal("files that aren't hashed certificates should be left alone")
+	}
+
+	pool := x509.NewCertPool()
+	for _, name := range result.Written {
+		in, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !pool.AppendCertsFromPEM(in) {
+			t.Fatalf("%s isn't a PEM-encoded certificate", name)
+		}
+	}
+
+	result, err = WriteHashDir(dir, certs[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Written) != 0 || len(result.Unchanged) != 2 || !reflect.DeepEqual(result.Removed, []string{hashName(hash, 1)}) {
+		t.Fatalf("expected only the second root to be removed, have %+v", result)
+	}
+}
@@ -0,0 +1,115 @@
+package publish
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// An Entry is a certificate in a release along with the trust the
+// release places in it, for the formats that can express more than
+// the certificate itself.
+type Entry struct {
+	Certificate *certdb.Certificate
+
+	// Purposes lists the purposes the certificate is trusted for;
+	// it is nil if the certificate is trusted for every purpose.
+	Purposes []string
+
+	// Distrust is the partial distrust of the certificate in the
+	// release, if any.
+	Distrust *certdb.Distrust
+}
+
+// LoadEntries looks up the trust the release places in each of the
+// certificates.
+func LoadEntries(tx *sql.Tx, rel *certdb.Release, certs []*certdb.Certificate) ([]*Entry, error) {
+	entries := make([]*Entry, 0, len(certs))
+	for _, cert := range certs {
+		cr := certdb.NewCertificateRelease(cert, rel)
+		purposes, err := cr.Purposes(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		distrust, err := cr.Distrust(tx)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		entries = append(entries, &Entry{
+			Certificate: cert,
+			Purposes:    purposes,
+			Distrust:    distrust,
+		})
+	}
+
+	return entries, nil
+}
+
+// Manifest is the JSON description of a release written by the
+// manifest format.
+type Manifest struct {
+	Bundle       string                 `json:"bundle"`
+	Version      string                 `json:"version"`
+	ReleasedAt   time.Time              `json:"released_at"`
+	Certificates []*ManifestCertificate `json:"certificates"`
+}
+
+// ManifestCertificate describes a certificate in a Manifest, along
+// with the purposes and distrust date that a PEM bundle can't carry.
+// Distrust dates apply to every purpose the certificate is trusted
+// for, which DistrustPurposes spells out.
+type ManifestCertificate struct {
+	*diff.Certificate
+	SHA256           string     `json:"sha256"`
+	Purposes         []string   `json:"purposes,omitempty"`
+	DistrustAfter    *time.Time `json:"distrust_after,omitempty"`
+	DistrustReason   string     `json:"distrust_reason,omitempty"`
+	DistrustPurposes []string   `json:"distrust_purposes,omitempty"`
+	PEM              string     `json:"pem"`
+}
+
+// NewManifest describes the entries of a release.
+func NewManifest(rel *certdb.Release, entries []*Entry) *Manifest {
+	m := &Manifest{
+		Bundle:       rel.Bundle,
+		Version:      rel.Version,
+		ReleasedAt:   time.Unix(rel.ReleasedAt, 0).UTC(),
+		Certificates: make([]*ManifestCertificate, 0, len(entries)),
+	}
+
+	for _, e := range entries {
+		digest := sha256.Sum256(e.Certificate.Raw)
+		mc := &ManifestCertificate{
+			Certificate: diff.NewCertificate(e.Certificate),
+			SHA256:      hex.EncodeToString(digest[:]),
+			Purposes:    e.Purposes,
+			PEM:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: e.Certificate.Raw})),
+		}
+
+		if e.Distrust != nil {
+			after := e.Distrust.Time()
+			mc.DistrustAfter = &after
+			mc.DistrustReason = e.Distrust.Reason
+			mc.DistrustPurposes = e.Purposes
+			if len(mc.DistrustPurposes) == 0 {
+				mc.DistrustPurposes = certdb.Purposes
+			}
+		}
+		m.Certificates = append(m.Certificates, mc)
+	}
+
+	return m
+}
+
+// EncodeManifest returns the JSON manifest of a release.
+func EncodeManifest(rel *certdb.Release, entries []*Entry) ([]byte, error) {
+	return json.MarshalIndent(NewManifest(rel, entries), "", "  ")
+}
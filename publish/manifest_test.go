@@ -0,0 +1,121 @@
+package publish
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+func testEntries(t *testing.T) (*certdb.Release, []*Entry) {
+	certs := testCertificates(t)
+	rel := &certdb.Release{Bundle: "ca", Version: "2017.6.0", ReleasedAt: date(2017, 6, 1).Unix()}
+	return rel, []*Entry{
+		{Certificate: certs[0], Purposes: []string{certdb.PurposeServerAuth}},
+		{
+			Certificate: certs[1],
+			Distrust:    &certdb.Distrust{DistrustAfter: date(2018, 1, 1).Unix(), Reason: "test"},
+		},
+	}
+}
+
+func TestEncodeManifest(t *testing.T) {
+	rel, entries := testEntries(t)
+	out, err := EncodeManifest(rel, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m struct {
+		Version      string `json:"version"`
+		Certificates []struct {
+			SKI              string   `json:"ski"`
+			Subject          string   `json:"subject"`
+			Purposes         []string `json:"purposes"`
+			DistrustAfter    string   `json:"distrust_after"`
+			DistrustReason   string   `json:"distrust_reason"`
+			DistrustPurposes []string `json:"distrust_purposes"`
+			PEM              string   `json:"pem"`
+		} `json:"certificates"`
+	}
+
+	err = json.Unmarshal(out, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version != "2017.6.0" || len(m.Certificates) != 2 {
+		t.Fatalf("unexpected manifest\n%s", out)
+	}
+
+	root, intermediate := m.Certificates[0], m.Certificates[1]
+	if root.Subject != "/Root/O=cfssl_trust test" || len(root.Purposes) != 1 || root.DistrustAfter != "" {
+		t.Fatalf("unexpected manifest entry for the root %+v", root)
+	}
+
+	if intermediate.Purposes != nil || intermediate.DistrustAfter != "2018-01-01T00:00:00Z" || intermediate.DistrustReason != "test" {
+		t.Fatalf("unexpected manifest entry for the intermediate %+v", intermediate)
+	}
+
+	// The distrust date applies to every purpose.
+	if len(intermediate.DistrustPurposes) != len(certdb.Purposes) || root.DistrustPurposes != nil {
+		t.Fatalf("expected the distrust to cover every purpose, have %v", intermediate.DistrustPurposes)
+	}
+
+	if !strings.HasPrefix(intermediate.PEM, "-----BEGIN CERTIFICATE-----\n") {
+		t.Fatalf("expected the PEM-encoded certificate, have %s", intermediate.PEM)
+	}
+}
+
+func TestEncodeGo(t *testing.T) {
+	rel, entries := testEntries(t)
+	src, err := EncodeGo(rel, entries, "roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "roots.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, src)
+	}
+
+	if f.Name.Name != "roots" {
+		t.Fatalf("expected package roots, have %s", f.Name.Name)
+	}
+
+	// Only the distrusted intermediate should have a distrust
+	// date, given as a time.Unix call.
+	var dates []int64
+	ast.Inspect(f, func(n ast.Node) bool {
+		kv, ok := n.(*ast.KeyValueExpr)
+		if !ok || kv.Key.(*ast.Ident).Name != "distrustAfter" {
+			return true
+		}
+
+		lit := kv.Value.(*ast.CallExpr).Args[0].(*ast.BasicLit)
+		date, err := strconv.ParseInt(lit.Value, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dates = append(dates, date)
+		return true
+	})
+
+	if len(dates) != 1 || dates[0] != date(2018, 1, 1).Unix() {
+		t.Fatalf("expected a single distrust date, have %v", dates)
+	}
+
+	if !strings.Contains(string(src), "AddCertWithConstraint") {
+		t.Fatal("expected distrusted certificates to be added with a constraint")
+	}
+
+	_, err = EncodeGo(rel, entries, "not a package")
+	if err == nil {
+		t.Fatal("expected an invalid package name to be rejected")
+	}
+}
@@ -0,0 +1,261 @@
+package publish
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+var (
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+
+	// oidTrustedKeyUsage is the attribute Java uses to mark a
+	// certificate bag as a trusted certificate entry; OpenSSL
+	// writes it with -jdktrust.
+	oidTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+)
+
+// These are the MAC parameters used for PKCS #12 truststores; they
+// match the defaults of current JDK and OpenSSL releases.
+const (
+	pkcs12MACIterations = 10000
+	pkcs12SaltLength    = 20
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// safeBag values and attribute values are RawValues that must be
+// wrapped by hand; see contentInfo.
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+// bmpString encodes a friendly name as a big-endian UTF-16 string.
+func bmpString(s string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return out
+}
+
+// set wraps the DER encodings of the values in a SET.
+func set(values ...[]byte) asn1.RawValue {
+	var der []byte
+	for _, v := range values {
+		der = append(der, v...)
+	}
+
+	return asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      der,
+	}
+}
+
+// pkcs12KDF implements the PKCS #12 key derivation function (RFC
+// 7292, appendix B.2) with the given hash, producing size bytes of
+// key material for the purpose id.
+func pkcs12KDF(newHash func() hash.Hash, id byte, password, salt []byte, iterations, size int) []byte {
+	h := newHash()
+	v := h.BlockSize()
+
+	fill := func(in []byte) []byte {
+		if len(in) == 0 {
+			return nil
+		}
+
+		n := v * ((len(in) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = in[i%len(in)]
+		}
+		return out
+	}
+
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+	I := append(fill(salt), fill(password)...)
+
+	var key []byte
+	one := big.NewInt(1)
+	for len(key) < size {
+		h.Reset()
+		h.Write(D)
+		h.Write(I)
+		A := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(A)
+			A = h.Sum(A[:0])
+		}
+		key = append(key, A...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v) for each v-byte block.
+		B := new(big.Int).SetBytes(fill(A)[:v])
+		for j := 0; j < len(I); j += v {
+			Ij := new(big.Int).SetBytes(I[j : j+v])
+			Ij.Add(Ij, B)
+			Ij.Add(Ij, one)
+			sum := Ij.Bytes()
+			if len(sum) > v {
+				sum = sum[len(sum)-v:]
+			}
+
+			block := I[j : j+v]
+			for i := range block {
+				block[i] = 0
+			}
+			copy(block[v-len(sum):], sum)
+		}
+	}
+
+	return key[:size]
+}
+
+// pkcs12MAC computes the HMAC-SHA256 integrity MAC over the
+// authenticated safe.
+func pkcs12MAC(message []byte, password string, salt []byte, iterations int) []byte {
+	// Passwords are null-terminated (RFC 7292, appendix B.1).
+	encoded := append(bmpString(password), 0, 0)
+	key := pkcs12KDF(sha256.New, 3, encoded, salt, iterations, sha256.Size)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// aliases returns a unique alias for each certificate, based on its
+// SKI.
+func aliases(certs []*certdb.Certificate) []string {
+	var seen = map[string]int{}
+	var names = make([]string, len(certs))
+	for i, cert := range certs {
+		seen[cert.SKI]++
+		names[i] = cert.SKI
+		if n := seen[cert.SKI]; n > 1 {
+			names[i] = fmt.Sprintf("%s-%d", cert.SKI, n)
+		}
+	}
+	return names
+}
+
+func trustedCertBag(cert *certdb.Certificate, alias string) safeBag {
+	bag := mustMarshal(certBag{
+		ID:   oidCertTypeX509,
+		Data: explicit(0, mustMarshal(cert.Raw)),
+	})
+	name := mustMarshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(alias)})
+
+	return safeBag{
+		ID:    oidCertBag,
+		Value: explicit(0, bag),
+		Attributes: []pkcs12Attribute{
+			{ID: oidFriendlyName, Value: set(name)},
+			{ID: oidTrustedKeyUsage, Value: set(mustMarshal(oidAnyExtendedKeyUsage))},
+		},
+	}
+}
+
+// mustMarshal encodes values that are built in this package and so
+// can always be marshaled.
+func mustMarshal(v interface{}) []byte {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("publish: failed to marshal %T: %s", v, err))
+	}
+	return der
+}
+
+// EncodePKCS12 returns a PKCS #12 truststore containing the
+// certificates as trusted certificate entries, with no keys. Each
+// entry is named after the certificate's SKI and marked as trusted
+// for any purpose, as Java's keytool does for trusted certificates.
+// The certificates are stored unencrypted; the password protects the
+// integrity of the truststore.
+func EncodePKCS12(certs []*certdb.Certificate, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("publish: a PKCS #12 truststore needs a password")
+	}
+
+	bags := make([]safeBag, 0, len(certs))
+	for i, alias := range aliases(certs) {
+		bags = append(bags, trustedCertBag(certs[i], alias))
+	}
+
+	safeContents, err := asn1.Marshal(bags)
+	if err != nil {
+		return nil, err
+	}
+
+	authSafe, err := asn1.Marshal([]contentInfo{
+		{ContentType: oidData, Content: explicit(0, mustMarshal(safeContents))},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, pkcs12SaltLength)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pfxPDU{
+		Version: 3,
+		AuthSafe: contentInfo{
+			ContentType: oidData,
+			Content:     explicit(0, mustMarshal(authSafe)),
+		},
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+				Digest:    pkcs12MAC(authSafe, password, salt, pkcs12MACIterations),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12MACIterations,
+		},
+	})
+}
@@ -0,0 +1,95 @@
+package publish
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// contentInfo is the PKCS #7 ContentInfo. The content, if present,
+// must already be wrapped in its explicit [0] tag; encoding/asn1
+// doesn't apply explicit tags to RawValues.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+// degenerateSignedData is a SignedData carrying only certificates,
+// with no content, CRLs, or signers (RFC 2315, section 9.1).
+type degenerateSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	CRLs             asn1.RawValue
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// explicit wraps DER-encoded data in an explicit context-specific
+// tag.
+func explicit(tag int, der []byte) asn1.RawValue {
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      der,
+	}
+}
+
+// EncodePKCS7 returns a DER-encoded degenerate PKCS #7 SignedData
+// containing the certificates, in bundle order.
+func EncodePKCS7(certs []*certdb.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+
+	sd := degenerateSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		// certificates is an IMPLICIT [0] SET OF Certificate.
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      raw,
+		},
+		// crls is optional, but is written as an empty set
+		// since some parsers, including cfssl's, require it.
+		CRLs: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1,
+			IsCompound: true,
+		},
+		SignerInfos: []asn1.RawValue{},
+	}
+
+	der, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     explicit(0, der),
+	})
+}
+
+// EncodePKCS7PEM returns the PEM encoding of EncodePKCS7, as written
+// by "openssl crl2pkcs7".
+func EncodePKCS7PEM(certs []*certdb.Certificate) ([]byte, error) {
+	der, err := EncodePKCS7(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}), nil
+}
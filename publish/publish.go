@@ -0,0 +1,431 @@
+// Package publish rolls new trust store releases and writes out the
+// published bundles and their listings.
+package publish
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/lint"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/release"
+)
+
+// Bundles lists the bundles in the order they are rolled.
+var Bundles = []string{"int", "ca"}
+
+// Files maps each bundle to the file it is published as.
+var Files = map[string]string{
+	"ca":  "ca-bundle.crt",
+	"int": "int-bundle.crt",
+}
+
+// ListingDir is the directory, relative to the published bundles,
+// that the bundle listings are written to.
+const ListingDir = "certdata"
+
+// ListingFile returns the name of the listing for a bundle.
+func ListingFile(bundle string) string {
+	return strings.TrimSuffix(Files[bundle], ".crt") + ".txt"
+}
+
+// EncodeBundle returns the PEM encoding of the certificates.
+func EncodeBundle(certs []*certdb.Certificate) []byte {
+	var buf = &bytes.Buffer{}
+	for _, cert := range certs {
+		p := &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		}
+
+		err := pem.Encode(buf, p)
+		if err != nil {
+			// A bytes.Buffer write should never fail.
+			panic("cfssl-trust: write to *bytes.Buffer should never fail")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// A Lister produces the human-readable listing of a PEM bundle. The
+// name is the file name the bundle is published under.
+type Lister func(name string, pemBundle []byte) ([]byte, error)
+
+// Options controls how a release is published.
+type Options struct {
+	// Window is the minimum time certificates must remain valid
+	// for to be carried over into the new release.
+	Window time.Duration
+
+	// Imports maps a bundle to the PEM files whose certificates
+	// should be added to its new release.
+	Imports map[string][]string
+
+	// Dir is the directory the bundles are written to.
+	Dir string
+
+	// Lister produces the bundle listings; if it is nil, no
+	// listings are written.
+	Lister Lister
+
+	// SkipUnchanged abandons the release, leaving the database
+	// and the published files untouched, if neither bundle
+	// changed.
+	SkipUnchanged bool
+
+	// Force imports certificates even if linting finds errors in
+	// them.
+	Force bool
+}
+
+// Bundle summarises the new release of a bundle. Changed is true if
+// the bundle differs from the previously published file.
+type Bundle struct {
+	Bundle   string              `json:"bundle"`
+	From     string              `json:"from"`
+	To       string              `json:"to"`
+	Path     string              `json:"path"`
+	Listing  string              `json:"listing,omitempty"`
+	SHA256   string              `json:"sha256"`
+	Changed  bool                `json:"changed"`
+	Total    int                 `json:"total"`
+	Rolled   int                 `json:"rolled"`
+	Imported []*diff.Certificate `json:"imported"`
+	Skipped  []*diff.Certificate `json:"skipped"`
+
+	// Distrusted lists the certificates in the release that were
+	// left out of the PEM bundle because they were partially
+	// distrusted as of the release.
+	Distrusted []*diff.Certificate `json:"distrusted,omitempty"`
+
+	// Lint lists the findings for the certificates to be imported
+	// into the bundle.
+	Lint []*lint.Result `json:"lint,omitempty"`
+}
+
+// Summary describes a published release. Published is false if the
+// release was abandoned because nothing changed.
+type Summary struct {
+	Version   string    `json:"version"`
+	Changed   bool      `json:"changed"`
+	Published bool      `json:"published"`
+	Bundles   []*Bundle `json:"bundles"`
+}
+
+// A LintError is returned by Publish if certificates to be imported
+// fail linting and Force isn't set. Results lists the findings for
+// every certificate with any.
+type LintError struct {
+	Failed  int
+	Results []*lint.Result
+}
+
+func (err *LintError) Error() string {
+	return fmt.Sprintf("publish: %d certificates failed linting", err.Failed)
+}
+
+func loadImports(imports map[string][]string) (map[string][]*x509.Certificate, error) {
+	certs := map[string][]*x509.Certificate{}
+	for b, paths := range imports {
+		for _, path := range paths {
+			in, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			x509Certs, err := helpers.ParseCertificatesPEM(in)
+			if err != nil {
+				return nil, errors.New("publish: failed to parse " + path + ": " + err.Error())
+			}
+
+			certs[b] = append(certs[b], x509Certs...)
+		}
+	}
+
+	return certs, nil
+}
+
+// lintImports lints the certificates to be imported into each bundle
+// as of the given time. It returns the results with findings for each
+// bundle, and the number of certificates with errors.
+func lintImports(imports map[string][]*x509.Certificate, when time.Time) (map[string][]*lint.Result, int) {
+	results := map[string][]*lint.Result{}
+	var failed int
+	for b, certs := range imports {
+		for _, cert := range certs {
+			result := lint.Certificate(cert, b, when)
+			if len(result.Findings) == 0 {
+				continue
+			}
+
+			results[b] = append(results[b], result)
+			if result.Errors() > 0 {
+				failed++
+			}
+		}
+	}
+
+	return results, failed
+}
+
+// nextVersion returns the latest release of each bundle, and the
+// version of the release following the latest release of either.
+func nextVersion(db *sql.DB) (map[string]*certdb.Release, string, error) {
+	var latest = map[string]*certdb.Release{}
+	var next release.Release
+	for i, b := range Bundles {
+		rel, err := certdb.LatestRelease(db, b)
+		if err == sql.ErrNoRows {
+			return nil, "", errors.New("publish: there is no " + b + " release to roll from")
+		} else if err != nil {
+			return nil, "", err
+		}
+		latest[b] = rel
+
+		version, err := release.Parse(rel.Version)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if i == 0 || version.Cmp(next) > 0 {
+			next = version
+		}
+	}
+
+	next, err := next.Inc()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return latest, next.String(), nil
+}
+
+// A stagedFile is written out next to its destination, and is moved
+// into place once everything else has succeeded.
+type stagedFile struct {
+	tmp  string
+	path string
+}
+
+func stage(path string, data []byte) (*stagedFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &stagedFile{tmp: f.Name(), path: path}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(sf.tmp)
+		return nil, err
+	}
+
+	return sf, nil
+}
+
+// BundleCertificates returns the certificates in a release that go
+// into its published bundle. The bundles are TLS bundles, so
+// certificates only trusted for other purposes, such as S/MIME roots,
+// are left out, as are those partially distrusted as of the release;
+// the latter are returned separately.
+func BundleCertificates(tx *sql.Tx, rel *certdb.Release) (certs, distrusted []*certdb.Certificate, err error) {
+	certs, err = certdb.CollectPurpose(rel.Bundle, rel.Version, certdb.PurposeServerAuth, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certdb.ExcludeDistrusted(tx, rel, certs)
+}
+
+func publishBundle(tx *sql.Tx, from *certdb.Release, version string, imports []*x509.Certificate, opts *Options) (*Bundle, []byte, error) {
+	to, err := certdb.NewRelease(from.Bundle, version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = to.Insert(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roll, err := RollRelease(tx, from, to, opts.Window)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundle := &Bundle{
+		Bundle:   to.Bundle,
+		From:     from.Version,
+		To:       to.Version,
+		Path:     filepath.Join(opts.Dir, Files[to.Bundle]),
+		Rolled:   len(roll.Included),
+		Imported: []*diff.Certificate{},
+		Skipped:  roll.Skipped,
+	}
+
+	for _, cert := range imports {
+		c, added, err := certdb.Import(tx, cert, to)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if added {
+			bundle.Imported = append(bundle.Imported, diff.NewCertificate(c))
+		}
+	}
+
+	certs, distrusted, err := BundleCertificates(tx, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, cert := range distrusted {
+		bundle.Distrusted = append(bundle.Distrusted, diff.NewCertificate(cert))
+	}
+
+	pemBundle := EncodeBundle(certs)
+	digest := sha256.Sum256(pemBundle)
+	bundle.Total = len(certs)
+	bundle.SHA256 = hex.EncodeToString(digest[:])
+
+	current, err := ioutil.ReadFile(bundle.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	bundle.Changed = !bytes.Equal(current, pemBundle)
+
+	return bundle, pemBundle, nil
+}
+
+// Publish rolls a new release of each bundle from its latest release,
+// imports any new certificates into it, and writes out bundles of the
+// certificates trusted for serverAuth, with their listings. The new
+// certificates are linted first, and a *LintError is returned if any
+// fail unless opts.Force is set. The database changes are committed,
+// and the files moved into place, only once everything else has
+// succeeded.
+func Publish(db *sql.DB, opts *Options) (*Summary, error) {
+	imports, err := loadImports(opts.Imports)
+	if err != nil {
+		return nil, err
+	}
+
+	lintResults, failed := lintImports(imports, time.Now())
+	if failed > 0 && !opts.Force {
+		lerr := &LintError{Failed: failed}
+		for _, b := range Bundles {
+			lerr.Results = append(lerr.Results, lintResults[b]...)
+		}
+		return nil, lerr
+	}
+
+	// The latest releases are looked up before starting the
+	// transaction, as LatestRelease runs its own.
+	latest, version, err := nextVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	summary := &Summary{
+		Version: version,
+		Bundles: []*Bundle{},
+	}
+
+	var pemBundles = map[string][]byte{}
+	for _, b := range Bundles {
+		bundle, pemBundle, err := publishBundle(tx, latest[b], version, imports[b], opts)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Lint = lintResults[b]
+
+		summary.Bundles = append(summary.Bundles, bundle)
+		summary.Changed = summary.Changed || bundle.Changed
+		pemBundles[b] = pemBundle
+	}
+
+	if !summary.Changed && opts.SkipUnchanged {
+		return summary, nil
+	}
+
+	var staged []*stagedFile
+	defer func() {
+		for _, sf := range staged {
+			os.Remove(sf.tmp)
+		}
+	}()
+
+	for _, bundle := range summary.Bundles {
+		sf, err := stage(bundle.Path, pemBundles[bundle.Bundle])
+		if err != nil {
+			return nil, err
+		}
+		staged = append(staged, sf)
+
+		if opts.Lister == nil {
+			continue
+		}
+
+		listing, err := opts.Lister(Files[bundle.Bundle], pemBundles[bundle.Bundle])
+		if err != nil {
+			return nil, err
+		}
+
+		listingDir := filepath.Join(opts.Dir, ListingDir)
+		err = os.MkdirAll(listingDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.Listing = filepath.Join(listingDir, ListingFile(bundle.Bundle))
+		sf, err = stage(bundle.Listing, listing)
+		if err != nil {
+			return nil, err
+		}
+		staged = append(staged, sf)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for len(staged) > 0 {
+		err = os.Rename(staged[0].tmp, staged[0].path)
+		if err != nil {
+			return nil, err
+		}
+		staged = staged[1:]
+	}
+
+	summary.Published = true
+	return summary, nil
+}
@@ -0,0 +1,403 @@
+package publish
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func countLister(name string, pemBundle []byte) ([]byte, error) {
+	var count int
+	for block, rest := pem.Decode(pemBundle); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+	return []byte(fmt.Sprintf("%s: %d certificates\n", name, count)), nil
+}
+
+type identities struct {
+	root, expired, intermediate *certdbtest.Identity
+}
+
+func newIdentities(t *testing.T) *identities {
+	var ids = &identities{}
+	var err error
+	ids.root, err = certdbtest.NewRoot("Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids.expired, err = certdbtest.NewRoot("Expired", date(2017, 1, 1), date(2018, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids.intermediate, err = ids.root.Issue("Intermediate", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ids
+}
+
+// setup builds a database with a 2017.6.0 release of each bundle; the
+// ca release includes a root that has since expired.
+func setup(t *testing.T, ids *identities) *sql.DB {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.6.0", date(2017, 6, 1), ids.root.Cert, ids.expired.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2017.6.0", date(2017, 6, 1), ids.intermediate.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids := newIdentities(t)
+	db := setup(t, ids)
+	defer db.Close()
+
+	summary, err := Publish(db, &Options{
+		Dir:           dir,
+		Lister:        countLister,
+		SkipUnchanged: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !summary.Published || !summary.Changed {
+		t.Fatal("expected the first release to be published")
+	}
+
+	ca := summary.Bundles[1]
+	if ca.Bundle != "ca" || ca.Total != 1 || len(ca.Skipped) != 1 || ca.Skipped[0].Reason != certdb.ExcludedExpired {
+		t.Fatalf("expected the expired root to be skipped, have %+v", ca)
+	}
+
+	listing, err := ioutil.ReadFile(filepath.Join(dir, ListingDir, "ca-bundle.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(listing) != "ca-bundle.crt: 1 certificates\n" {
+		t.Fatalf("unexpected listing '%s'", listing)
+	}
+
+	latest, err := certdb.LatestRelease(db, "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.Version != summary.Version {
+		t.Fatalf("expected the int release %s to have been committed, but the latest is %s", summary.Version, latest.Version)
+	}
+
+	// Rolling the same releases from a fresh database shouldn't
+	// change the published bundles.
+	db = setup(t, ids)
+	defer db.Close()
+
+	summary, err = Publish(db, &Options{
+		Dir:           dir,
+		SkipUnchanged: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Published || summary.Changed {
+		t.Fatal("an unchanged release shouldn't be published")
+	}
+
+	latest, err = certdb.LatestRelease(db, "ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.Version != "2017.6.0" {
+		t.Fatalf("an unpublished release shouldn't be committed, but the latest release is %s", latest.Version)
+	}
+
+	newRoot, err := certdbtest.NewRoot("New Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing root is included to check that it isn't
+	// reported as imported.
+	rootsFile := filepath.Join(dir, "NEW_ROOTS.pem")
+	roots := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newRoot.Cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ids.root.Cert.Raw})...)
+	err = ioutil.WriteFile(rootsFile, roots, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err = Publish(db, &Options{
+		Dir:           dir,
+		Imports:       map[string][]string{"ca": {rootsFile}},
+		SkipUnchanged: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca = summary.Bundles[1]
+	if !summary.Published || summary.Bundles[0].Changed || !ca.Changed {
+		t.Fatal("expected only the ca bundle to change")
+	}
+
+	if len(ca.Imported) != 1 || ca.Imported[0].Subject != "/New Root/O=cfssl_trust test" || ca.Total != 2 {
+		t.Fatalf("expected the new root to be imported, have %d imported", len(ca.Imported))
+	}
+
+	pemBundle, err := ioutil.ReadFile(filepath.Join(dir, Files["ca"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing, err = countLister("", pemBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(listing) != ": 2 certificates\n" {
+		t.Fatalf("expected ca-bundle.crt to be rewritten with both roots, have '%s'", listing)
+	}
+}
+
+// TestPublishDistrusted checks that a partial distrust is carried into
+// the new release, and that the root is left out of the PEM bundle once
+// its distrust date has passed.
+func TestPublishDistrusted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids := newIdentities(t)
+	db := setup(t, ids)
+	defer db.Close()
+
+	future, err := certdbtest.NewRoot("Future Distrust", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The release is looked up before the transaction is started,
+	// as FetchRelease runs its own.
+	from, err := certdb.FetchRelease(db, "ca", "2017.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	futureCert, _, err := certdb.Import(tx, future.Cert, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cert, after := range map[*certdb.Certificate]time.Time{
+		certdb.NewCertificate(ids.root.Cert): date(2018, 1, 1),
+		futureCert:                           date(2099, 1, 1),
+	} {
+		_, err = certdb.NewCertificateRelease(cert, from).SetDistrust(tx, after.Unix(), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := Publish(db, &Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := summary.Bundles[1]
+	if ca.Total != 1 || len(ca.Distrusted) != 1 || ca.Distrusted[0].SKI != certdb.NewCertificate(ids.root.Cert).SKI {
+		t.Fatalf("expected only the root distrusted in the past to be left out, have %+v", ca)
+	}
+
+	to, err := certdb.FetchRelease(db, "ca", summary.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	d, err := certdb.NewCertificateRelease(futureCert, to).Distrust(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.DistrustAfter != date(2099, 1, 1).Unix() {
+		t.Fatalf("expected the distrust date to be carried into the new release, have %+v", d)
+	}
+}
+
+// TestPublishLint checks that certificates failing linting are only
+// imported with Force.
+func TestPublishLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids := newIdentities(t)
+	db := setup(t, ids)
+	defer db.Close()
+
+	leaf, err := ids.intermediate.Issue("Leaf", date(2017, 1, 1), date(2100, 1, 1), func(template *x509.Certificate) {
+		template.IsCA = false
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intsFile := filepath.Join(dir, "NEW_INTERMEDIATES.pem")
+	err = ioutil.WriteFile(intsFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Cert.Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{
+		Dir:     dir,
+		Imports: map[string][]string{"int": {intsFile}},
+	}
+
+	_, err = Publish(db, opts)
+	lerr, ok := err.(*LintError)
+	if !ok || lerr.Failed != 1 || len(lerr.Results) != 1 {
+		t.Fatalf("expected the leaf to fail linting, but have %v", err)
+	}
+
+	latest, err := certdb.LatestRelease(db, "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.Version != "2017.6.0" {
+		t.Fatalf("nothing should be released when linting fails, but the latest release is %s", latest.Version)
+	}
+
+	opts.Force = true
+	summary, err := Publish(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intBundle := summary.Bundles[0]
+	if len(intBundle.Imported) != 1 || len(intBundle.Lint) != 1 || intBundle.Lint[0].Errors() == 0 {
+		t.Fatalf("expected the leaf to be imported with its lint errors, have %+v", intBundle)
+	}
+}
+
+// TestPublishPurposes checks that roots trusted only for email stay in
+// the ca release but are left out of the published TLS bundle.
+func TestPublishPurposes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-trust-publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids := newIdentities(t)
+	db := setup(t, ids)
+	defer db.Close()
+
+	smime, err := certdbtest.NewRoot("S/MIME Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := certdb.FetchRelease(db, "ca", "2017.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smimeCert, _, err := certdb.Import(tx, smime.Cert, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdb.NewCertificateRelease(smimeCert, from).SetPurposes(tx, []string{certdb.PurposeEmailProtection})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := Publish(db, &Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := summary.Bundles[1]
+	if ca.Total != 1 {
+		t.Fatalf("expected only the TLS root in the bundle, have %d certificates", ca.Total)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease("ca", summary.Version, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certs) != 2 {
+		t.Fatalf("expected the S/MIME root to be carried over into the release, have %d certificates", len(certs))
+	}
+}
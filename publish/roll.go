@@ -0,0 +1,90 @@
+package publish
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// A Roll records the result of copying the certificates from one
+// release into the next.
+type Roll struct {
+	From     *certdb.Release
+	To       *certdb.Release
+	Included []*certdb.Certificate
+
+	// Skipped lists the certificates that weren't carried over;
+	// the reason is one of the certdb.Excluded* reasons.
+	Skipped []*diff.Certificate
+}
+
+// carryTrust copies the purposes a certificate is trusted for, and any
+// distrust date, from one release to the next.
+func carryTrust(tx *sql.Tx, from, to *certdb.CertificateRelease) error {
+	purposes, err := from.Purposes(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = to.SetPurposes(tx, purposes)
+	if err != nil {
+		return err
+	}
+
+	d, err := from.Distrust(tx)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = to.SetDistrust(tx, d.DistrustAfter, d.Reason)
+	return err
+}
+
+// RollRelease copies the certificates in the from release into the to
+// release, along with the purposes they are trusted for and any
+// distrust dates, skipping any that have been revoked or expire within
+// the window at the time the to release was made.
+func RollRelease(tx *sql.Tx, from, to *certdb.Release, window time.Duration) (*Roll, error) {
+	certs, err := certdb.CollectRelease(from.Bundle, from.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	roll := &Roll{
+		From:    from,
+		To:      to,
+		Skipped: []*diff.Certificate{},
+	}
+
+	for _, cert := range certs {
+		reason, err := cert.Excluded(tx, to.ReleasedAt, window)
+		if err != nil {
+			return nil, err
+		} else if reason != "" {
+			skipped := diff.NewCertificate(cert)
+			skipped.Reason = reason
+			roll.Skipped = append(roll.Skipped, skipped)
+			continue
+		}
+
+		cr := certdb.NewCertificateRelease(cert, to)
+		added, err := certdb.Ensure(cr, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if added {
+			err = carryTrust(tx, certdb.NewCertificateRelease(cert, from), cr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		roll.Included = append(roll.Included, cert)
+	}
+
+	return roll, nil
+}
@@ -0,0 +1,250 @@
+// Package revocation records the revocations that CAs publish for the
+// certificates in the trust database.
+package revocation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+)
+
+// MechanismCRL is the mechanism recorded for revocations found in
+// CRLs.
+const MechanismCRL = "crl"
+
+// SkippedSharedKey explains why a revocation wasn't recorded for a
+// certificate whose key is shared with another certificate in the
+// database: recording it would revoke the others too.
+const SkippedSharedKey = "other certificates share its key; revoke it by hand if they should go too"
+
+// oidReasonCode is the CRL entry extension holding the reason code
+// (RFC 5280 section 5.3.1).
+var oidReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// reasons names the CRL reason codes, as in RFC 5280 section 5.3.1.
+var reasons = map[int]string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "cACompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	8:  "removeFromCRL",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+// These reason codes don't revoke a certificate permanently, so
+// entries carrying them aren't recorded.
+const (
+	reasonCertificateHold = 6
+	reasonRemoveFromCRL   = 8
+)
+
+// An Entry is a certificate in the database listed on a CRL. Recorded
+// is set if the revocation was added to the database; Skipped explains
+// why it wasn't.
+type Entry struct {
+	Reason      string            `json:"reason" yaml:"reason"`
+	RevokedAt   time.Time         `json:"revoked_at" yaml:"revoked_at"`
+	Recorded    bool              `json:"recorded" yaml:"recorded"`
+	Skipped     string            `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+}
+
+// A CRLReport describes an ingested CRL: its issuer, how many entries
+// it holds, and the entries that matched certificates in the database.
+type CRLReport struct {
+	Issuer     *diff.Certificate `json:"issuer" yaml:"issuer"`
+	ThisUpdate time.Time         `json:"this_update" yaml:"this_update"`
+	NextUpdate time.Time         `json:"next_update" yaml:"next_update"`
+	Listed     int               `json:"listed" yaml:"listed"`
+	Matched    []*Entry          `json:"matched" yaml:"matched"`
+}
+
+// ParseCRLs parses one or more PEM-encoded CRLs, or a single DER
+// CRL.
+func ParseCRLs(in []byte) ([]*x509.RevocationList, error) {
+	if !bytes.Contains(in, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(in)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.RevocationList{crl}, nil
+	}
+
+	var crls []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, in = pem.Decode(in)
+		if block == nil {
+			break
+		} else if block.Type != "X509 CRL" {
+			continue
+		}
+
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, crl)
+	}
+
+	if len(crls) == 0 {
+		return nil, errors.New("revocation: no CRLs found")
+	}
+	return crls, nil
+}
+
+// reasonCode returns the reason code of a CRL entry; entries without
+// one are unspecified.
+func reasonCode(entry pkix.RevokedCertificate) (int, error) {
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidReasonCode) {
+			continue
+		}
+
+		var code asn1.Enumerated
+		rest, err := asn1.Unmarshal(ext.Value, &code)
+		if err != nil {
+			return 0, err
+		} else if len(rest) != 0 {
+			return 0, errors.New("revocation: trailing data after CRL reason code")
+		}
+		return int(code), nil
+	}
+
+	return 0, nil
+}
+
+// reasonName names a reason code, falling back to the number for
+// codes RFC 5280 doesn't define.
+func reasonName(code int) string {
+	if name, ok := reasons[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason code %d", code)
+}
+
+// findIssuer returns the CA certificate in the database whose
+// signature on the CRL verifies.
+func findIssuer(certs []*certdb.Certificate, crl *x509.RevocationList) (*certdb.Certificate, error) {
+	for _, cert := range certs {
+		issuer := cert.X509()
+		if issuer == nil || !issuer.IsCA || !bytes.Equal(issuer.RawSubject, crl.RawIssuer) {
+			continue
+		}
+
+		if len(crl.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 &&
+			!bytes.Equal(crl.AuthorityKeyId, issuer.SubjectKeyId) {
+			continue
+		}
+
+		if crl.CheckSignatureFrom(issuer) == nil {
+			return cert, nil
+		}
+	}
+
+	return nil, fmt.Errorf("revocation: no issuer in the database verifies the CRL from '%s'",
+		common.NameToString(crl.Issuer))
+}
+
+// IngestCRL verifies the CRL's signature against its issuer in the
+// database, and records a revocation with the CRL's reason code for
+// each certificate that issuer issued whose serial is listed on it.
+// Certificates that are already revoked are left alone, as are
+// entries that only put a certificate on hold. Revocations are keyed by
+// SKI, so certificates sharing their key with another certificate
+// (such as cross-signs) are reported but not recorded.
+func IngestCRL(tx *sql.Tx, crl *x509.RevocationList) (*CRLReport, error) {
+	certs, err := certdb.AllCertificates(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := findIssuer(certs, crl)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CRLReport{
+		Issuer:     diff.NewCertificate(issuer),
+		ThisUpdate: crl.ThisUpdate.UTC(),
+		NextUpdate: crl.NextUpdate.UTC(),
+		Listed:     len(crl.RevokedCertificates),
+		Matched:    []*Entry{},
+	}
+
+	listed := map[string]pkix.RevokedCertificate{}
+	for _, entry := range crl.RevokedCertificates {
+		listed[entry.SerialNumber.String()] = entry
+	}
+
+	for _, cert := range certs {
+		child := cert.X509()
+		if cert == issuer || cert.AKI != issuer.SKI || child == nil ||
+			!chain.SignedBy(child, issuer.X509()) {
+			continue
+		}
+
+		entry, ok := listed[child.SerialNumber.String()]
+		if !ok {
+			continue
+		}
+
+		code, err := reasonCode(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := &Entry{
+			Reason:      reasonName(code),
+			RevokedAt:   entry.RevocationTime.UTC(),
+			Certificate: diff.NewCertificate(cert),
+		}
+		report.Matched = append(report.Matched, matched)
+
+		if code == reasonCertificateHold || code == reasonRemoveFromCRL {
+			matched.Skipped = "not a permanent revocation"
+			continue
+		}
+
+		rev := &certdb.Revocation{SKI: cert.SKI}
+		err = rev.Select(tx)
+		if err == nil {
+			matched.Skipped = fmt.Sprintf("already revoked (%s) as of %s", rev.Mechanism,
+				time.Unix(rev.RevokedAt, 0).UTC().Format(common.DateFormat))
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		shared, err := cert.SharesKey(tx)
+		if err != nil {
+			return nil, err
+		} else if shared {
+			matched.Skipped = SkippedSharedKey
+			continue
+		}
+
+		err = cert.Revoke(tx, MechanismCRL, matched.Reason, entry.RevocationTime.Unix())
+		if err != nil {
+			return nil, err
+		}
+		matched.Recorded = true
+	}
+
+	return report, nil
+}
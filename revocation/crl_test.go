@@ -0,0 +1,234 @@
+package revocation
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// revoked builds a CRL entry for the certificate with the given
+// reason code.
+func revoked(cert *x509.Certificate, when time.Time, code int) pkix.RevokedCertificate {
+	value, _ := asn1.Marshal(asn1.Enumerated(code))
+	return pkix.RevokedCertificate{
+		SerialNumber:   cert.SerialNumber,
+		RevocationTime: when,
+		Extensions:     []pkix.Extension{{Id: oidReasonCode, Value: value}},
+	}
+}
+
+func newCRL(t *testing.T, issuer *certdbtest.Identity, entries ...pkix.RevokedCertificate) []byte {
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          date(2020, 1, 1),
+		NextUpdate:          date(2020, 2, 1),
+		RevokedCertificates: entries,
+	}, issuer.Cert, issuer.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestIngestCRL(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stranger, err := certdbtest.NewRoot("stranger", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compromised, err := root.Issue("compromised", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held, err := root.Issue("held", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fine, err := root.Issue("fine", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), compromised.Cert, held.Cert, fine.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der := newCRL(t, root,
+		revoked(compromised.Cert, date(2019, 6, 1), 1),
+		revoked(held.Cert, date(2019, 6, 1), reasonCertificateHold),
+		pkix.RevokedCertificate{SerialNumber: big.NewInt(42), RevocationTime: date(2019, 6, 1)})
+	in := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+
+	crls, err := ParseCRLs(in)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(crls) != 1 {
+		t.Fatalf("expected 1 CRL, but have %d", len(crls))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	report, err := IngestCRL(tx, crls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Listed != 3 || len(report.Matched) != 2 {
+		t.Fatalf("expected 3 entries and 2 matches, but have %d and %d", report.Listed, len(report.Matched))
+	}
+
+	for _, entry := range report.Matched {
+		switch entry.Certificate.Subject {
+		case "/compromised/O=cfssl_trust test":
+			if !entry.Recorded || entry.Reason != "keyCompromise" {
+				t.Fatalf("expected the compromised intermediate to be revoked for keyCompromise, but have %+v", entry)
+			}
+		case "/held/O=cfssl_trust test":
+			if entry.Recorded || entry.Skipped == "" {
+				t.Fatalf("expected the held intermediate to be skipped, but have %+v", entry)
+			}
+		default:
+			t.Fatalf("unexpected match %s", entry.Certificate.Subject)
+		}
+	}
+
+	rev := &certdb.Revocation{SKI: certdb.NewCertificate(compromised.Cert).SKI}
+	err = rev.Select(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.Mechanism != MechanismCRL || rev.Reason != "keyCompromise" || rev.RevokedAt != date(2019, 6, 1).Unix() {
+		t.Fatalf("unexpected revocation %+v", rev)
+	}
+
+	isRevoked, err := certdb.NewCertificate(fine.Cert).Revoked(tx, date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	} else if isRevoked {
+		t.Fatal("expected the unlisted intermediate not to be revoked")
+	}
+
+	// Ingesting the CRL again leaves the revocation alone.
+	report, err = IngestCRL(tx, crls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range report.Matched {
+		if entry.Recorded {
+			t.Fatalf("expected nothing to be recorded again, but have %+v", entry)
+		}
+	}
+
+	// A CRL whose issuer isn't in the database is rejected.
+	crls, err = ParseCRLs(newCRL(t, stranger, revoked(compromised.Cert, date(2019, 6, 1), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = IngestCRL(tx, crls[0])
+	if err == nil {
+		t.Fatal("expected a CRL from an unknown issuer to be rejected")
+	}
+}
+
+func TestIngestCRLSharedKey(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	oldRoot, err := certdbtest.NewRoot("old root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot, err := certdbtest.NewRoot("new root", date(2019, 1, 1), date(2040, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cross, err := oldRoot.CrossSign(newRoot, date(2019, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), oldRoot.Cert, newRoot.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), cross.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crls, err := ParseCRLs(newCRL(t, oldRoot, revoked(cross.Cert, date(2019, 6, 1), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	report, err := IngestCRL(tx, crls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Matched) != 1 {
+		t.Fatalf("expected the cross-sign to match, but have %d matches", len(report.Matched))
+	}
+
+	entry := report.Matched[0]
+	if entry.Recorded || entry.Skipped != SkippedSharedKey {
+		t.Fatalf("expected the cross-sign to be skipped, but have %+v", entry)
+	}
+
+	isRevoked, err := certdb.NewCertificate(newRoot.Cert).Revoked(tx, date(2020, 1, 1).Unix())
+	if err != nil {
+		t.Fatal(err)
+	} else if isRevoked {
+		t.Fatal("expected the self-signed root sharing the cross-sign's key not to be revoked")
+	}
+}
@@ -0,0 +1,231 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/chain"
+	"github.com/cloudflare/cfssl_trust/common"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"golang.org/x/crypto/ocsp"
+)
+
+// MechanismOCSP is the mechanism recorded for revocations reported by
+// OCSP responders.
+const MechanismOCSP = "ocsp"
+
+// maxResponseSize bounds the responses read from OCSP responders.
+const maxResponseSize = 1 << 20
+
+// These are the results of an OCSP check.
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+	StatusFailed  = "failed"
+)
+
+// A Check is the OCSP status of a certificate. For revoked
+// certificates, Reason and RevokedAt come from the response, and
+// Recorded is set if the revocation was added to the database. Error
+// explains failed checks, and why revocations weren't recorded.
+type Check struct {
+	Status      string            `json:"status" yaml:"status"`
+	URL         string            `json:"url" yaml:"url"`
+	Reason      string            `json:"reason,omitempty" yaml:"reason,omitempty"`
+	RevokedAt   *time.Time        `json:"revoked_at,omitempty" yaml:"revoked_at,omitempty"`
+	Recorded    bool              `json:"recorded" yaml:"recorded"`
+	Error       string            `json:"error,omitempty" yaml:"error,omitempty"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+}
+
+// An OCSPReport lists the OCSP checks made for a set of certificates.
+// Certificates without an OCSP URL aren't checked.
+type OCSPReport struct {
+	Checked int      `json:"checked" yaml:"checked"`
+	Good    int      `json:"good" yaml:"good"`
+	Revoked int      `json:"revoked" yaml:"revoked"`
+	Unknown int      `json:"unknown" yaml:"unknown"`
+	Failed  int      `json:"failed" yaml:"failed"`
+	Checks  []*Check `json:"checks" yaml:"checks"`
+}
+
+// QueryOCSP asks the OCSP responder at the URL for the status of the
+// certificate. The response must be signed by the issuer, or by a
+// responder the issuer delegated OCSP signing to, and must be current
+// at the given time.
+func QueryOCSP(client *http.Client, url string, cert, issuer *x509.Certificate, when time.Time) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("revocation: %s returned %s", url, resp.Status)
+	}
+
+	in, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	ocspResp, err := ocsp.ParseResponseForCert(in, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	// ParseResponseForCert checks that a delegated responder was
+	// issued by the issuer, but not that it may sign OCSP responses.
+	if responder := ocspResp.Certificate; responder != nil && !bytes.Equal(responder.Raw, issuer.Raw) {
+		delegated := false
+		for _, usage := range responder.ExtKeyUsage {
+			delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+		}
+
+		if !delegated {
+			return nil, errors.New("revocation: the OCSP responder's certificate isn't authorised to sign responses")
+		}
+	}
+
+	if ocspResp.ThisUpdate.After(when) {
+		return nil, errors.New("revocation: the OCSP response isn't valid yet")
+	} else if !ocspResp.NextUpdate.IsZero() && ocspResp.NextUpdate.Before(when) {
+		return nil, fmt.Errorf("revocation: the OCSP response expired at %s",
+			ocspResp.NextUpdate.UTC().Format(common.DateFormat))
+	}
+
+	return ocspResp, nil
+}
+
+// findCertIssuer returns a certificate in the database that issued
+// the certificate.
+func findCertIssuer(certs []*certdb.Certificate, cert *certdb.Certificate) *x509.Certificate {
+	for _, candidate := range certs {
+		issuer := candidate.X509()
+		if candidate.SKI == cert.AKI && issuer != nil && issuer.IsCA && chain.SignedBy(cert.X509(), issuer) {
+			return issuer
+		}
+	}
+	return nil
+}
+
+// check makes the OCSP check for a certificate, and records the
+// revocation if the responder reports it revoked and no other
+// certificate shares its key.
+func check(tx *sql.Tx, client *http.Client, all []*certdb.Certificate, cert *certdb.Certificate, when time.Time) (*Check, error) {
+	x509Cert := cert.X509()
+	result := &Check{
+		Status:      StatusFailed,
+		URL:         x509Cert.OCSPServer[0],
+		Certificate: diff.NewCertificate(cert),
+	}
+
+	issuer := findCertIssuer(all, cert)
+	if issuer == nil {
+		result.Error = "the issuer isn't in the database"
+		return result, nil
+	}
+
+	resp, err := QueryOCSP(client, result.URL, x509Cert, issuer, when)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		result.Status = StatusGood
+		return result, nil
+	case ocsp.Unknown:
+		result.Status = StatusUnknown
+		return result, nil
+	}
+
+	revokedAt := resp.RevokedAt.UTC()
+	result.Status = StatusRevoked
+	result.Reason = reasonName(resp.RevocationReason)
+	result.RevokedAt = &revokedAt
+
+	if resp.RevocationReason == ocsp.CertificateHold {
+		result.Error = "not a permanent revocation"
+		return result, nil
+	}
+
+	rev := &certdb.Revocation{SKI: cert.SKI}
+	err = rev.Select(tx)
+	if err == nil {
+		result.Error = fmt.Sprintf("already revoked (%s) as of %s", rev.Mechanism,
+			time.Unix(rev.RevokedAt, 0).UTC().Format(common.DateFormat))
+		return result, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	shared, err := cert.SharesKey(tx)
+	if err != nil {
+		return nil, err
+	} else if shared {
+		result.Error = SkippedSharedKey
+		return result, nil
+	}
+
+	err = cert.Revoke(tx, MechanismOCSP, result.Reason, revokedAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	result.Recorded = true
+	return result, nil
+}
+
+// CheckOCSP checks the status of each of the certificates that has an
+// OCSP URL with its responder, using its issuer from the database,
+// and records a revocation for those reported revoked. Certificates
+// that are already revoked are left alone, as are those only put on
+// hold. Failed checks are reported, not returned as errors.
+func CheckOCSP(tx *sql.Tx, client *http.Client, certs []*certdb.Certificate, when time.Time) (*OCSPReport, error) {
+	all, err := certdb.AllCertificates(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OCSPReport{Checks: []*Check{}}
+	for _, cert := range certs {
+		if cert.X509() == nil || len(cert.X509().OCSPServer) == 0 {
+			continue
+		}
+
+		result, err := check(tx, client, all, cert, when)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Checked++
+		switch result.Status {
+		case StatusGood:
+			report.Good++
+		case StatusRevoked:
+			report.Revoked++
+		case StatusUnknown:
+			report.Unknown++
+		default:
+			report.Failed++
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,249 @@
+package revocation
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+	"golang.org/x/crypto/ocsp"
+)
+
+// responder stands in for a CA's OCSP responder: it answers with the
+// status recorded for each serial number, signed by the signer.
+type responder struct {
+	issuer   *certdbtest.Identity
+	signer   *certdbtest.Identity
+	statuses map[string]int
+}
+
+func (r *responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	in, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ocspReq, err := ocsp.ParseRequest(in)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, ok := r.statuses[ocspReq.SerialNumber.String()]
+	if !ok {
+		status = ocsp.Unknown
+	}
+
+	template := ocsp.Response{
+		Status:       status,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   date(2020, 1, 1),
+		NextUpdate:   date(2020, 2, 1),
+	}
+	if status == ocsp.Revoked {
+		template.RevokedAt = date(2019, 6, 1)
+		template.RevocationReason = ocsp.KeyCompromise
+	}
+	if r.signer != r.issuer {
+		template.Certificate = r.signer.Cert
+	}
+
+	out, err := ocsp.CreateResponse(r.issuer.Cert, r.signer.Cert, template, r.signer.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(out)
+}
+
+func TestCheckOCSP(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root, err := certdbtest.NewRoot("root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The responder for /forged signs with a certificate that
+	// hasn't been delegated OCSP signing.
+	impostor, err := root.Issue("impostor", date(2017, 1, 1), date(2030, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := &responder{issuer: root, signer: root, statuses: map[string]int{}}
+	forged := &responder{issuer: root, signer: impostor, statuses: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.Handle("/", good)
+	mux.Handle("/forged", forged)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	withOCSP := func(path string) certdbtest.Option {
+		return func(template *x509.Certificate) {
+			template.OCSPServer = []string{srv.URL + path}
+		}
+	}
+
+	names := []string{"valid", "revoked", "forged", "offline"}
+	ints := map[string]*certdbtest.Identity{}
+	var certs []*x509.Certificate
+	for _, name := range names {
+		path := "/"
+		if name == "forged" {
+			path = "/forged"
+		}
+
+		var opts []certdbtest.Option
+		if name != "offline" {
+			opts = append(opts, withOCSP(path))
+		}
+
+		ints[name], err = root.Issue(name, date(2017, 1, 1), date(2030, 1, 1), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, ints[name].Cert)
+	}
+
+	good.statuses[ints["valid"].Cert.SerialNumber.String()] = ocsp.Good
+	good.statuses[ints["revoked"].Cert.SerialNumber.String()] = ocsp.Revoked
+	forged.statuses[ints["forged"].Cert.SerialNumber.String()] = ocsp.Revoked
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), certs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	released, err := certdb.CollectRelease(intRel.Bundle, intRel.Version, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckOCSP(tx, srv.Client(), released, date(2020, 1, 15))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Checked != 3 || report.Good != 1 || report.Revoked != 1 || report.Failed != 1 {
+		t.Fatalf("expected 3 checks with 1 good, 1 revoked and 1 failed, but have %+v", report)
+	}
+
+	for _, result := range report.Checks {
+		if result.Status == StatusFailed && result.Certificate.Subject != "/forged/O=cfssl_trust test" {
+			t.Fatalf("expected the forged response to fail, but have %+v", result)
+		}
+	}
+
+	for name, expected := range map[string]bool{"valid": false, "revoked": true, "forged": false} {
+		rev := &certdb.Revocation{SKI: certdb.NewCertificate(ints[name].Cert).SKI}
+		err = rev.Select(tx)
+		if expected && err != nil {
+			t.Fatalf("expected %s to be revoked, but have %v", name, err)
+		} else if !expected && err == nil {
+			t.Fatalf("expected %s not to be revoked", name)
+		}
+
+		if expected && (rev.Mechanism != MechanismOCSP || rev.Reason != "keyCompromise" || rev.RevokedAt != date(2019, 6, 1).Unix()) {
+			t.Fatalf("unexpected revocation %+v", rev)
+		}
+	}
+
+	// Responses are rejected once they expire.
+	report, err = CheckOCSP(tx, srv.Client(), released, date(2020, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Failed != 3 {
+		t.Fatalf("expected every check to fail with expired responses, but have %+v", report)
+	}
+}
+
+// TestCheckOCSPSharedKey checks that a revoked cross-sign doesn't take
+// the self-signed root sharing its key down with it.
+func TestCheckOCSPSharedKey(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	oldRoot, err := certdbtest.NewRoot("old root", date(2017, 1, 1), date(2035, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot, err := certdbtest.NewRoot("new root", date(2019, 1, 1), date(2040, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := &responder{issuer: oldRoot, signer: oldRoot, statuses: map[string]int{}}
+	srv := httptest.NewServer(good)
+	defer srv.Close()
+
+	cross, err := oldRoot.CrossSign(newRoot, date(2019, 1, 1), date(2030, 1, 1), func(template *x509.Certificate) {
+		template.OCSPServer = []string{srv.URL}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good.statuses[cross.Cert.SerialNumber.String()] = ocsp.Revoked
+
+	_, err = certdbtest.AddRelease(db, "ca", "2020.1.0", date(2020, 1, 1), oldRoot.Cert, newRoot.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intRel, err := certdbtest.AddRelease(db, "int", "2020.1.0", date(2020, 1, 1), cross.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	released, err := certdb.CollectRelease(intRel.Bundle, intRel.Version, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckOCSP(tx, srv.Client(), released, date(2020, 1, 15))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Revoked != 1 || report.Checks[0].Recorded || report.Checks[0].Error != SkippedSharedKey {
+		t.Fatalf("expected the revoked cross-sign not to be recorded, but have %+v", report.Checks[0])
+	}
+
+	excluded, err := certdb.NewCertificate(newRoot.Cert).Excluded(tx, date(2020, 2, 1).Unix(), 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if excluded != "" {
+		t.Fatalf("expected the self-signed root to survive, but it's %s", excluded)
+	}
+}
@@ -0,0 +1,322 @@
+// Package server exposes the trust database over a read-only HTTP
+// API.
+//
+// The API serves the following endpoints; certificates and releases
+// are encoded as they are by the --output json flag of the command
+// line tool.
+//
+//	GET /releases?bundle=int        releases of a bundle, newest first
+//	GET /bundles/{bundle}/{version} PEM bundle for a release ("latest" for the latest)
+//	GET /certificates/{ski}         certificates with the SKI (?format=pem for PEM)
+//	GET /search?q=term&q=term       certificates matching the info.Query terms
+//	GET /expiring?bundle=int        certificates that won't be in the next release
+//
+// As with the command line tool, the bundle defaults to int. The
+// /expiring endpoint also takes a version and a window (a duration,
+// defaulting to 720h). Bundles are served with an ETag derived from
+// their SHA-256 digest.
+package server
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/publish"
+)
+
+// These are the content types of the API responses.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypePEM  = "application/x-pem-file"
+)
+
+// DefaultWindow is the expiration window used by /expiring if none
+// is given.
+const DefaultWindow = 30 * 24 * time.Hour
+
+// A Server answers API requests from a trust database.
+type Server struct {
+	db  *sql.DB
+	mux *http.ServeMux
+}
+
+// New returns a Server backed by the database.
+func New(db *sql.DB) *Server {
+	srv := &Server{
+		db:  db,
+		mux: http.NewServeMux(),
+	}
+
+	srv.mux.HandleFunc("/releases", srv.releases)
+	srv.mux.HandleFunc("/bundles/", srv.bundle)
+	srv.mux.HandleFunc("/certificates/", srv.certificates)
+	srv.mux.HandleFunc("/search", srv.search)
+	srv.mux.HandleFunc("/expiring", srv.expiring)
+	return srv
+}
+
+// ServeHTTP implements http.Handler. Only GET and HEAD requests are
+// accepted.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" isn't allowed")
+		return
+	}
+
+	srv.mux.ServeHTTP(w, r)
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(append(out, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	out, _ := json.Marshal(&apiError{Error: message})
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(append(out, '\n'))
+}
+
+// writeDatabaseError reports a failed lookup, treating a missing row
+// as a missing resource.
+func writeDatabaseError(w http.ResponseWriter, err error, what string) {
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, what+" not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// validBundle checks the bundle before it is used to build a query.
+func validBundle(w http.ResponseWriter, bundle string) bool {
+	if _, ok := publish.Files[bundle]; !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid bundle '%s' (valid bundles are ca|int)", bundle))
+		return false
+	}
+	return true
+}
+
+func bundleParam(r *http.Request) string {
+	if bundle := r.URL.Query().Get("bundle"); bundle != "" {
+		return bundle
+	}
+	return "int"
+}
+
+func (srv *Server) releases(w http.ResponseWriter, r *http.Request) {
+	bundle := bundleParam(r)
+	if !validBundle(w, bundle) {
+		return
+	}
+
+	releases, err := certdb.AllReleases(srv.db, bundle)
+	if err != nil {
+		writeDatabaseError(w, err, "releases")
+		return
+	}
+
+	if releases == nil {
+		releases = []*certdb.Release{}
+	}
+	writeJSON(w, http.StatusOK, releases)
+}
+
+// bundleETag returns the entity tag for a PEM bundle.
+func bundleETag(pemBundle []byte) string {
+	digest := sha256.Sum256(pemBundle)
+	return `"` + hex.EncodeToString(digest[:]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of the request
+// lists the entity tag.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (srv *Server) fetchBundle(rel *certdb.Release) ([]byte, error) {
+	tx, err := srv.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	certs, err := certdb.CollectRelease(rel.Bundle, rel.Version, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, _, err = certdb.ExcludeDistrusted(tx, rel, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return publish.EncodeBundle(certs), tx.Commit()
+}
+
+func (srv *Server) bundle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/bundles/"), "/")
+	if len(parts) != 2 || parts[1] == "" {
+		writeError(w, http.StatusNotFound, "expected /bundles/{bundle}/{version}")
+		return
+	}
+
+	bundle, version := parts[0], parts[1]
+	if !validBundle(w, bundle) {
+		return
+	}
+
+	var rel *certdb.Release
+	var err error
+	if version == "latest" {
+		rel, err = certdb.LatestRelease(srv.db, bundle)
+	} else {
+		rel, err = certdb.FetchRelease(srv.db, bundle, version)
+	}
+	if err != nil {
+		writeDatabaseError(w, err, "release "+bundle+"-"+version)
+		return
+	}
+
+	pemBundle, err := srv.fetchBundle(rel)
+	if err != nil {
+		writeDatabaseError(w, err, "release "+bundle+"-"+version)
+		return
+	}
+
+	etag := bundleETag(pemBundle)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Release-Version", rel.Version)
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypePEM)
+	w.Header().Set("Content-Disposition", "attachment; filename="+publish.Files[bundle])
+	w.Write(pemBundle)
+}
+
+func (srv *Server) loadMetadata(certs []*certdb.Certificate) ([]*info.CertificateMetadata, error) {
+	tx, err := srv.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	metadata := make([]*info.CertificateMetadata, 0, len(certs))
+	for _, cert := range certs {
+		cm, err := info.LoadCertificateMetadata(tx, cert)
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, cm)
+	}
+
+	return metadata, tx.Commit()
+}
+
+func (srv *Server) certificates(w http.ResponseWriter, r *http.Request) {
+	ski := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/certificates/"))
+	if ski == "" || strings.Contains(ski, "/") {
+		writeError(w, http.StatusNotFound, "expected /certificates/{ski}")
+		return
+	}
+
+	certs, err := certdb.FindCertificateBySKI(srv.db, ski)
+	if err != nil {
+		writeDatabaseError(w, err, "certificate "+ski)
+		return
+	} else if len(certs) == 0 {
+		writeError(w, http.StatusNotFound, "certificate "+ski+" not found")
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "pem":
+		w.Header().Set("Content-Type", ContentTypePEM)
+		for _, cert := range certs {
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+	case "", "json":
+		metadata, err := srv.loadMetadata(certs)
+		if err != nil {
+			writeDatabaseError(w, err, "certificate "+ski)
+			return
+		}
+		writeJSON(w, http.StatusOK, metadata)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown format '%s' (valid formats are json|pem)", format))
+	}
+}
+
+func (srv *Server) search(w http.ResponseWriter, r *http.Request) {
+	terms := r.URL.Query()["q"]
+	for _, term := range terms {
+		if _, err := info.ParseQuery(term); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	results, err := info.Query(srv.db, terms)
+	if err != nil {
+		writeDatabaseError(w, err, "certificates")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (srv *Server) expiring(w http.ResponseWriter, r *http.Request) {
+	bundle := bundleParam(r)
+	if !validBundle(w, bundle) {
+		return
+	}
+
+	window := DefaultWindow
+	if s := r.URL.Query().Get("window"); s != "" {
+		var err error
+		window, err = time.ParseDuration(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	version := r.URL.Query().Get("version")
+	report, err := info.Expiring(srv.db, bundle, version, window)
+	if err != nil {
+		writeDatabaseError(w, err, "release "+bundle+"-"+version)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// setup builds a database with two ca releases: 2017.6.0 contains a
+// root, and 2017.8.0 adds a second root that expires shortly.
+func setup(t *testing.T) (*sql.DB, *certdbtest.Identity, *certdbtest.Identity) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := certdbtest.NewRoot("Root", date(2017, 1, 1), date(2100, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiring, err := certdbtest.NewRoot("Expiring", date(2017, 1, 1), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.6.0", date(2017, 6, 1), root.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "ca", "2017.8.0", date(2017, 8, 1), root.Cert, expiring.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, root, expiring
+}
+
+type response struct {
+	*http.Response
+	body []byte
+}
+
+func get(t *testing.T, srv *httptest.Server, path string, header http.Header) *response {
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &response{Response: resp, body: body}
+}
+
+func (resp *response) check(t *testing.T, status int, contentType string) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s: expected status %d, have %d (%s)", resp.Request.URL.Path, status, resp.StatusCode, resp.body)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != contentType {
+		t.Fatalf("%s: expected content type %s, have %s", resp.Request.URL.Path, contentType, ct)
+	}
+}
+
+func (resp *response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(resp.body, v)
+	if err != nil {
+		t.Fatalf("%s: %s", resp.Request.URL.Path, err)
+	}
+}
+
+func countPEM(in []byte) int {
+	var count int
+	for block, rest := pem.Decode(in); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+	return count
+}
+
+func TestReleases(t *testing.T) {
+	db, _, _ := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	resp := get(t, srv, "/releases?bundle=ca", nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+
+	var releases []struct {
+		Bundle     string `json:"bundle"`
+		Version    string `json:"version"`
+		ReleasedAt string `json:"released_at"`
+	}
+	resp.decode(t, &releases)
+
+	if len(releases) != 2 || releases[0].Version != "2017.8.0" || releases[0].ReleasedAt != "2017-08-01T00:00:00Z" {
+		t.Fatalf("unexpected releases %+v", releases)
+	}
+
+	resp = get(t, srv, "/releases", nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+	if strings.TrimSpace(string(resp.body)) != "[]" {
+		t.Fatalf("expected no int releases, have %s", resp.body)
+	}
+
+	resp = get(t, srv, "/releases?bundle=nope", nil)
+	resp.check(t, http.StatusBadRequest, ContentTypeJSON)
+}
+
+func TestBundle(t *testing.T) {
+	db, _, _ := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	resp := get(t, srv, "/bundles/ca/2017.6.0", nil)
+	resp.check(t, http.StatusOK, ContentTypePEM)
+	if countPEM(resp.body) != 1 {
+		t.Fatalf("expected one certificate in ca-2017.6.0, have\n%s", resp.body)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" || etag != bundleETag(resp.body) {
+		t.Fatalf("expected the ETag to be the bundle digest, have '%s'", etag)
+	}
+
+	resp = get(t, srv, "/bundles/ca/latest", nil)
+	resp.check(t, http.StatusOK, ContentTypePEM)
+	if countPEM(resp.body) != 2 || resp.Header.Get("X-Release-Version") != "2017.8.0" {
+		t.Fatalf("expected the latest release to be 2017.8.0 with two certificates, have\n%s", resp.body)
+	}
+
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("releases with different contents should have different ETags")
+	}
+
+	resp = get(t, srv, "/bundles/ca/2017.6.0", http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusNotModified || len(resp.body) != 0 {
+		t.Fatalf("expected a matching ETag to return 304, have %d", resp.StatusCode)
+	}
+
+	resp = get(t, srv, "/bundles/ca/2017.7.0", nil)
+	resp.check(t, http.StatusNotFound, ContentTypeJSON)
+
+	resp = get(t, srv, "/bundles/nope/latest", nil)
+	resp.check(t, http.StatusBadRequest, ContentTypeJSON)
+
+	resp = get(t, srv, "/bundles/ca", nil)
+	resp.check(t, http.StatusNotFound, ContentTypeJSON)
+}
+
+func TestCertificates(t *testing.T) {
+	db, root, _ := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	ski := certdb.NewCertificate(root.Cert).SKI
+	resp := get(t, srv, "/certificates/"+ski, nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+
+	var certs []struct {
+		SKI      string `json:"ski"`
+		Subject  string `json:"subject"`
+		Releases []struct {
+			Version string `json:"version"`
+		} `json:"releases"`
+	}
+	resp.decode(t, &certs)
+
+	if len(certs) != 1 || certs[0].SKI != ski || len(certs[0].Releases) != 2 {
+		t.Fatalf("unexpected certificates %+v", certs)
+	}
+
+	resp = get(t, srv, "/certificates/"+ski+"?format=pem", nil)
+	resp.check(t, http.StatusOK, ContentTypePEM)
+	block, _ := pem.Decode(resp.body)
+	if block == nil || string(block.Bytes) != string(root.Cert.Raw) {
+		t.Fatal("expected the PEM-encoded root")
+	}
+
+	resp = get(t, srv, "/certificates/00", nil)
+	resp.check(t, http.StatusNotFound, ContentTypeJSON)
+
+	resp = get(t, srv, "/certificates/"+ski+"?format=der", nil)
+	resp.check(t, http.StatusBadRequest, ContentTypeJSON)
+}
+
+func TestSearch(t *testing.T) {
+	db, _, _ := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	resp := get(t, srv, "/search?q=subject:Expiring&q=release:2017.8.0", nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+
+	var certs []struct {
+		Subject string `json:"subject"`
+	}
+	resp.decode(t, &certs)
+
+	if len(certs) != 1 || !strings.Contains(certs[0].Subject, "Expiring") {
+		t.Fatalf("unexpected search results %+v", certs)
+	}
+
+	resp = get(t, srv, "/search?q=colour:blue", nil)
+	resp.check(t, http.StatusBadRequest, ContentTypeJSON)
+}
+
+func TestExpiring(t *testing.T) {
+	db, _, expiring := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	resp := get(t, srv, "/expiring?bundle=ca", nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+
+	var report struct {
+		Release struct {
+			Version string `json:"version"`
+		} `json:"release"`
+		Window       string `json:"window"`
+		Expired      int    `json:"expired"`
+		Certificates []struct {
+			Reason      string `json:"reason"`
+			Certificate struct {
+				SKI string `json:"ski"`
+			} `json:"certificate"`
+		} `json:"certificates"`
+	}
+	resp.decode(t, &report)
+
+	if report.Release.Version != "2017.8.0" || report.Window != DefaultWindow.String() || report.Expired != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	ski := certdb.NewCertificate(expiring.Cert).SKI
+	if report.Certificates[0].Reason != certdb.ExcludedExpired || report.Certificates[0].Certificate.SKI != ski {
+		t.Fatalf("expected the expiring root to be reported, have %+v", report.Certificates)
+	}
+
+	resp = get(t, srv, "/expiring?bundle=ca&window=1h", nil)
+	resp.check(t, http.StatusOK, ContentTypeJSON)
+	resp.decode(t, &report)
+	if report.Expired != 0 {
+		t.Fatalf("nothing expires within an hour, have %+v", report)
+	}
+
+	resp = get(t, srv, "/expiring?bundle=ca&window=soon", nil)
+	resp.check(t, http.StatusBadRequest, ContentTypeJSON)
+
+	resp = get(t, srv, "/expiring?bundle=ca&version=2017.7.0", nil)
+	resp.check(t, http.StatusNotFound, ContentTypeJSON)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	db, _, _ := setup(t)
+	defer db.Close()
+
+	srv := httptest.NewServer(New(db))
+	defer srv.Close()
+
+	resp, err := srv.Client().Post(srv.URL+"/releases", "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Fatalf("expected POST to be rejected, have %d", resp.StatusCode)
+	}
+}
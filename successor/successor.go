@@ -0,0 +1,231 @@
+// Package successor looks for the certificates that could replace
+// the expiring and revoked certificates in a release: certificates
+// with the same subject that remain valid for longer.
+package successor
+
+import (
+	"bytes"
+	"crypto/x509"
+	"database/sql"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/aia"
+	"github.com/cloudflare/cfssl_trust/diff"
+	"github.com/cloudflare/cfssl_trust/info"
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/platform"
+)
+
+// These are the places a successor may be found.
+const (
+	SourceDatabase = "database"
+	SourcePlatform = "platform"
+	SourceAIA      = "aia"
+)
+
+// A Candidate is a possible successor to a certificate. Platform is
+// set for candidates found in a platform trust store, and URL for
+// those fetched from a CA Issuers URL. SameKey is true if the
+// candidate has the same public key as the certificate it replaces,
+// so that certificates issued under the old one still chain to it.
+type Candidate struct {
+	Source      string            `json:"source" yaml:"source"`
+	Platform    string            `json:"platform,omitempty" yaml:"platform,omitempty"`
+	URL         string            `json:"url,omitempty" yaml:"url,omitempty"`
+	SameKey     bool              `json:"same_key" yaml:"same_key"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+}
+
+// An Expiring certificate is paired with its candidate successors,
+// same-key ones first. Reason is one of the certdb.Excluded* reasons.
+// AIAError records why its CA Issuers URL couldn't be fetched.
+type Expiring struct {
+	Reason      string            `json:"reason" yaml:"reason"`
+	Certificate *diff.Certificate `json:"certificate" yaml:"certificate"`
+	Successors  []*Candidate      `json:"successors" yaml:"successors"`
+	AIAError    string            `json:"aia_error,omitempty" yaml:"aia_error,omitempty"`
+}
+
+// A Report pairs the certificates in a release that won't be carried
+// over into the next release with their candidate successors.
+// Unreplaced counts those without any.
+type Report struct {
+	Release      *certdb.Release `json:"release" yaml:"release"`
+	Window       string          `json:"window" yaml:"window"`
+	Replaced     int             `json:"replaced" yaml:"replaced"`
+	Unreplaced   int             `json:"unreplaced" yaml:"unreplaced"`
+	Certificates []*Expiring     `json:"certificates" yaml:"certificates"`
+}
+
+// Options selects the places successors are looked for besides the
+// database. If Client is nil, CA Issuers URLs aren't fetched.
+type Options struct {
+	Keystores []*platform.Keystore
+	Client    *http.Client
+}
+
+// finder checks candidates against an expiring certificate.
+type finder struct {
+	tx       *sql.Tx
+	now      int64
+	validTo  int64
+	expiring *Expiring
+	old      *x509.Certificate
+	seen     map[string]bool
+}
+
+// consider adds the candidate if it has the same subject as the
+// expiring certificate, isn't revoked, and remains valid past the
+// window and past the expiring certificate.
+func (f *finder) consider(cert *x509.Certificate, source, platformName, url string) error {
+	if bytes.Equal(cert.Raw, f.old.Raw) || !bytes.Equal(cert.RawSubject, f.old.RawSubject) {
+		return nil
+	}
+
+	if cert.NotAfter.Unix() <= f.validTo || !cert.NotAfter.After(f.old.NotAfter) {
+		return nil
+	}
+
+	key := source + platformName + string(cert.Raw)
+	if f.seen[key] {
+		return nil
+	}
+	f.seen[key] = true
+
+	c := certdb.NewCertificate(cert)
+	if source == SourceDatabase {
+		if isRevoked, err := c.Revoked(f.tx, f.now); err != nil {
+			return err
+		} else if isRevoked {
+			return nil
+		}
+	}
+
+	f.expiring.Successors = append(f.expiring.Successors, &Candidate{
+		Source:      source,
+		Platform:    platformName,
+		URL:         url,
+		SameKey:     bytes.Equal(cert.RawSubjectPublicKeyInfo, f.old.RawSubjectPublicKeyInfo),
+		Certificate: diff.NewCertificate(c),
+	})
+	return nil
+}
+
+// Find pairs the certificates that the expiring command reports for
+// a release with candidate successors from the database, the platform
+// keystores, and the CA Issuers URL recorded for certificates issued
+// by them. If version is empty, the latest release of the bundle is
+// used.
+func Find(db *sql.DB, bundle, version string, window time.Duration, opts *Options) (*Report, error) {
+	expiring, err := info.Expiring(db, bundle, version, window)
+	if err != nil {
+		return nil, err
+	}
+
+	keystores := map[string][]*x509.Certificate{}
+	for _, ks := range opts.Keystores {
+		keystores[ks.Platform], err = ks.Load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	all, err := certdb.AllCertificates(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Release:      expiring.Release,
+		Window:       expiring.Window,
+		Certificates: []*Expiring{},
+	}
+
+	now := time.Now()
+	for _, ec := range expiring.Certificates {
+		f := &finder{
+			tx:      tx,
+			now:     now.Unix(),
+			validTo: now.Add(window).Unix(),
+			expiring: &Expiring{
+				Reason:      ec.Reason,
+				Certificate: diff.NewCertificate(ec.Cert),
+				Successors:  []*Candidate{},
+			},
+			old:  ec.Cert.X509(),
+			seen: map[string]bool{},
+		}
+
+		for _, cert := range all {
+			if err = f.consider(cert.X509(), SourceDatabase, "", ""); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, ks := range opts.Keystores {
+			for _, cert := range keystores[ks.Platform] {
+				if err = f.consider(cert, SourcePlatform, ks.Platform, ""); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if opts.Client != nil {
+			err = f.fetch(opts.Client)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		sort.SliceStable(f.expiring.Successors, func(i, j int) bool {
+			a, b := f.expiring.Successors[i], f.expiring.Successors[j]
+			if a.SameKey != b.SameKey {
+				return a.SameKey
+			}
+			return a.Certificate.NotAfter.After(b.Certificate.NotAfter)
+		})
+
+		if len(f.expiring.Successors) > 0 {
+			report.Replaced++
+		} else {
+			report.Unreplaced++
+		}
+		report.Certificates = append(report.Certificates, f.expiring)
+	}
+
+	return report, nil
+}
+
+// fetch looks for successors at the CA Issuers URL recorded for the
+// certificates issued by the expiring certificate; CAs usually publish
+// the renewed certificate in place of the old one.
+func (f *finder) fetch(client *http.Client) error {
+	record := &certdb.AIA{SKI: f.expiring.Certificate.SKI}
+	err := record.Select(f.tx)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	certs, err := aia.Fetch(client, record.URL)
+	if err != nil {
+		f.expiring.AIAError = err.Error()
+		return nil
+	}
+
+	for _, cert := range certs {
+		if err = f.consider(cert, SourceAIA, "", record.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
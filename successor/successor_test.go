@@ -0,0 +1,169 @@
+package successor
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl_trust/model/certdb"
+	"github.com/cloudflare/cfssl_trust/model/certdb/certdbtest"
+	"github.com/cloudflare/cfssl_trust/platform"
+)
+
+// renew reissues a certificate with the same subject and key, valid
+// until notAfter.
+func renew(t *testing.T, issuer, old *certdbtest.Identity, notAfter time.Time) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               old.Cert.Subject,
+		NotBefore:             old.Cert.NotBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              old.Cert.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          old.Cert.SubjectKeyId,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer.Cert, old.Key.Public(), issuer.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// TestFind releases two intermediates that expire within the window:
+// renewed has a successor with a new key in the database, one in a
+// platform keystore, and one with the same key at the CA Issuers URL
+// of the certificates it issued; abandoned has none, and neither does
+// the child renewed issued, which also expires.
+func TestFind(t *testing.T) {
+	db, err := certdbtest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	soon := now.AddDate(0, 0, 10)
+	later := now.AddDate(5, 0, 0)
+
+	root, err := certdbtest.NewRoot("root", now.AddDate(-1, 0, 0), later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := root.Issue("renewed", now.AddDate(-1, 0, 0), soon)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abandoned, err := root.Issue("abandoned", now.AddDate(-1, 0, 0), soon)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inDatabase, err := root.Issue("renewed", now, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inKeystore, err := root.Issue("renewed", now, later.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atAIA := renew(t, root, renewed, later)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(atAIA.Raw)
+	}))
+	defer srv.Close()
+
+	child, err := renewed.Issue("child", now.AddDate(-1, 0, 0), soon, func(template *x509.Certificate) {
+		template.IssuingCertificateURL = []string{srv.URL + "/renewed.der"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certdbtest.AddRelease(db, "int", "2020.1.0", now.AddDate(0, -1, 0),
+		renewed.Cert, abandoned.Cert, child.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = certdb.Import(tx, inDatabase.Cert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keystore := filepath.Join(t.TempDir(), "nss.pem")
+	err = ioutil.WriteFile(keystore, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: inKeystore.Cert.Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{
+		Keystores: []*platform.Keystore{{Platform: "nss", Path: keystore}},
+		Client:    srv.Client(),
+	}
+
+	report, err := Find(db, "int", "", 30*24*time.Hour, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Replaced != 1 || report.Unreplaced != 2 {
+		t.Fatalf("expected 1 replaced and 2 unreplaced certificates, but have %d and %d",
+			report.Replaced, report.Unreplaced)
+	}
+
+	for _, expiring := range report.Certificates {
+		cn := expiring.Certificate.Cert.X509().Subject.CommonName
+		if cn != "renewed" {
+			if len(expiring.Successors) != 0 {
+				t.Fatalf("expected %s to have no successors, but have %d", cn, len(expiring.Successors))
+			}
+			continue
+		}
+
+		if len(expiring.Successors) != 3 {
+			t.Fatalf("expected renewed to have 3 successors, but have %d", len(expiring.Successors))
+		}
+
+		first := expiring.Successors[0]
+		if first.Source != SourceAIA || !first.SameKey || first.URL != srv.URL+"/renewed.der" {
+			t.Fatalf("expected the same-key successor from the AIA URL first, but have %s (same key: %v)",
+				first.Source, first.SameKey)
+		}
+
+		if second := expiring.Successors[1]; second.Source != SourcePlatform || second.Platform != "nss" {
+			t.Fatalf("expected the keystore successor second, but have %s", second.Source)
+		}
+
+		if third := expiring.Successors[2]; third.Source != SourceDatabase || third.SameKey {
+			t.Fatalf("expected the database successor last, but have %s", third.Source)
+		}
+	}
+}